@@ -0,0 +1,40 @@
+package xsk
+
+import "golang.org/x/sys/unix"
+
+// 忙轮询（内核 >= 5.11）与 xdpsock 的 -B 参数相同：套接字设置 SO_PREFER_BUSY_POLL、SO_BUSY_POLL 和 SO_BUSY_POLL_BUDGET 后，
+// 由应用程序在 recvfrom/sendto 中直接驱动网卡的 NAPI，而不是等待中断：
+//
+//	if (opt_busy_poll || xsk_ring_prod__needs_wakeup(&umem->fq))
+//		recvfrom(xsk_socket__fd(xsk->xsk), NULL, 0, MSG_DONTWAIT, NULL, NULL);
+//
+// 为了让 NAPI 只在应用程序中运行，网卡还需要设置 napi_defer_hard_irqs 和 gro_flush_timeout，例如：
+//
+//	echo 2 > /sys/class/net/eth0/napi_defer_hard_irqs
+//	echo 200000 > /sys/class/net/eth0/gro_flush_timeout
+
+// xskSetBusyPollOpts 设置套接字的忙轮询选项，值为 0 的选项保持内核的默认值。
+func xskSetBusyPollOpts(fd int, cfg *XskSocketConfig) error {
+	if cfg.PreferBusyPoll {
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_PREFER_BUSY_POLL, 1); err != nil {
+			return err
+		}
+	}
+	if cfg.BusyPoll != 0 {
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_BUSY_POLL, int(cfg.BusyPoll)); err != nil {
+			return err
+		}
+	}
+	if cfg.BusyPollBudget != 0 {
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_BUSY_POLL_BUDGET, int(cfg.BusyPollBudget)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// XskSocketBusyPoll 返回套接字是否以忙轮询模式运行（XskSocketConfig.BusyPoll 不为 0）。
+// 忙轮询模式下 XskSocketKickTx 和 XskSocketWakeupRx 总是调用 sendto 和 recvfrom 以驱动 NAPI。
+func XskSocketBusyPoll(xsk *XskSocket) bool {
+	return xsk.Config.BusyPoll != 0
+}
@@ -0,0 +1,43 @@
+package xsk
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestXskSetBusyPollOpts(t *testing.T) {
+	fd, err := unix.Socket(unix.AF_XDP, unix.SOCK_RAW, 0)
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	defer unix.Close(fd)
+
+	cfg := XskSocketConfig{BusyPoll: 20, BusyPollBudget: 64, PreferBusyPoll: true}
+	if err := xskSetBusyPollOpts(fd, &cfg); err != nil {
+		t.Fatalf("xskSetBusyPollOpts failed: %v", err)
+	}
+	// 内核不支持读取 SO_BUSY_POLL_BUDGET
+	for opt, want := range map[int]int{unix.SO_BUSY_POLL: 20, unix.SO_PREFER_BUSY_POLL: 1} {
+		if got, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, opt); err != nil || got != want {
+			t.Errorf("option %#x: expected %d, got %d, %v", opt, want, got, err)
+		}
+	}
+
+	// 忙轮询模式下即使环没有设置 XDP_RING_NEED_WAKEUP 也会调用 sendto 和 recvfrom
+	var flags uint32
+	xsk := &XskSocket{
+		Tx:     &XskRingProd{Flags: &flags},
+		Ctx:    &XskCtx{Fill: &XskRingProd{Flags: &flags}, Umem: &XskUmem{needWakeup: true}},
+		Config: cfg,
+		Fd:     fd,
+	}
+	if !XskSocketBusyPoll(xsk) {
+		t.Fatal("Expected busy poll mode")
+	}
+	XskSocketKickTx(xsk)
+	XskSocketWakeupRx(xsk)
+	if stats := XskSocketGetWakeupStats(xsk); stats != (XskWakeupStats{TxKicks: 1, RxWakeups: 1}) {
+		t.Errorf("Unexpected wakeup stats %+v", stats)
+	}
+}
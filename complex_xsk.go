@@ -1,8 +1,12 @@
 package xsk
 
 import (
+	"context"
+	"log/slog"
+	"sync/atomic"
 	"unsafe"
 
+	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/link"
 	"golang.org/x/sys/unix"
 )
@@ -10,16 +14,28 @@ import (
 type XDPDesc = unix.XDPDesc
 
 type ComplexXsk struct {
-	xsk      *XskSocket
-	umemArea []byte
-	umem     *XskUmem
-	config   ComplexXskConfig
-	fill     XskRingProd
-	comp     XskRingCons
-	rx       XskRingCons
-	tx       XskRingProd
+	xsk       *XskSocket
+	umemArea  []byte
+	umem      *XskUmem
+	config    ComplexXskConfig
+	fill      *XskRingProd
+	comp      *XskRingCons
+	rx        XskRingCons
+	tx        XskRingProd
+	zeroCopy  bool
+	allocator UmemAllocator
+	txFrags   [][]byte
+	shared    *SharedUmem
+	// compBase 为套接字创建时 completion ring 的生产者位置，用于计算 tx ring 中尚未完成发送的描述符
+	compBase uint32
 }
 
+// ComplexUmemConfig 描述 ComplexXsk 的 umem 配置。
+// Flags 中设置 unix.XDP_UMEM_UNALIGNED_CHUNK_FLAG 时使用非对齐块模式，此时 FrameSize 可以不是 2 的幂，帧依次紧密排列。
+// TxMetadataLen 非 0（通常为 XSK_TX_METADATA_LEN）时启用 TX 元数据，NewComplexXsk 返回的描述符会在帧内预留该长度，
+// 之后可以通过 TxMetadata 为每个描述符请求校验和卸载、发送时间和发送时间戳。
+// Allocator 决定 umem 区域的分配方式（大页、memfd 或调用者提供的内存），为 nil 时使用匿名映射。
+// Logger 见 XskUmemConfig。
 type ComplexUmemConfig struct {
 	FillSize      uint32
 	CompSize      uint32
@@ -27,13 +43,30 @@ type ComplexUmemConfig struct {
 	FrameSize     uint32
 	FrameHeadroom uint32
 	Flags         uint32
+	TxMetadataLen uint32
+	Allocator     UmemAllocator
+	Logger        *slog.Logger
 }
+
+// ComplexSocketConfig 描述 ComplexXsk 的套接字配置。
+// BindFlags 中设置 unix.XDP_USE_SG 时启用多缓冲区模式，一个数据包可以由多个以 XDP_PKT_CONTD 串联的描述符组成，
+// 默认 XDP 程序也会以支持分片的方式加载。
+// BindMode 决定以零拷贝还是复制模式绑定（见 XSK_BIND_MODE__*），默认直接使用 BindFlags。
+// XdpFlags 默认为 XDP_MODE_AUTO，先以驱动模式挂载 XDP 程序，失败时退回通用模式；指定模式时失败直接返回错误。
+// BusyPoll、BusyPollBudget 和 PreferBusyPoll 为忙轮询选项（见 XskSocketConfig），BusyPoll 不为 0 时
+// RecvBatch 在 rx ring 为空时、SendBatch 在提交后总是调用 recvfrom 和 sendto 驱动 NAPI，不需要 Poll。
+// Logger 见 XskSocketConfig。
 type ComplexSocketConfig struct {
-	RxSize      uint32
-	TxSize      uint32
-	LibbpfFlags uint32
-	XdpFlags    link.XDPAttachFlags
-	BindFlags   uint16
+	RxSize         uint32
+	TxSize         uint32
+	LibbpfFlags    uint32
+	XdpFlags       link.XDPAttachFlags
+	BindFlags      uint16
+	BindMode       uint32
+	BusyPoll       uint32
+	BusyPollBudget uint16
+	PreferBusyPoll bool
+	Logger         *slog.Logger
 }
 
 type ComplexXskConfig struct {
@@ -57,7 +90,7 @@ func DefaultComplexSocketConfig() *ComplexSocketConfig {
 		RxSize:      2048,
 		TxSize:      2048,
 		LibbpfFlags: 0,
-		XdpFlags:    link.XDPGenericMode,
+		XdpFlags:    XDP_MODE_AUTO,
 		BindFlags:   unix.XDP_USE_NEED_WAKEUP,
 	}
 }
@@ -85,43 +118,33 @@ func NewComplexXsk(ifaceName string, queueID uint32, config *ComplexXskConfig) (
 		}
 	}
 
-	complexXsk.umemArea, err = unix.Mmap(-1, 0, int(complexXsk.config.UmemConfig.FrameNum)*int(complexXsk.config.UmemConfig.FrameSize),
-		unix.PROT_READ|unix.PROT_WRITE,
-		unix.MAP_PRIVATE|unix.MAP_ANONYMOUS|unix.MAP_POPULATE)
+	complexXsk.allocator = complexXsk.config.UmemConfig.Allocator
+	if complexXsk.allocator == nil {
+		complexXsk.allocator = AnonUmemAllocator{}
+	}
+	complexXsk.umemArea, err = complexXsk.allocator.Alloc(int(complexXsk.config.UmemConfig.FrameNum) * int(complexXsk.config.UmemConfig.FrameSize))
 	if err != nil {
 		return nil, nil, err
 	}
 
+	complexXsk.fill = new(XskRingProd)
+	complexXsk.comp = new(XskRingCons)
 	complexXsk.umem, err = XskUmemCreate(unsafe.Pointer(&complexXsk.umemArea[0]),
-		uint64(complexXsk.config.UmemConfig.FrameNum*complexXsk.config.UmemConfig.FrameSize),
-		&complexXsk.fill, &complexXsk.comp,
-		&XskUmemConfig{
-			FillSize:      complexXsk.config.UmemConfig.FillSize,
-			CompSize:      complexXsk.config.UmemConfig.CompSize,
-			FrameSize:     complexXsk.config.UmemConfig.FrameSize,
-			FrameHeadroom: uint32(0),
-			Flags:         uint32(0),
-		})
+		uint64(complexXsk.config.UmemConfig.FrameNum)*uint64(complexXsk.config.UmemConfig.FrameSize),
+		complexXsk.fill, complexXsk.comp, complexUmemConfig(complexXsk.config.UmemConfig))
 	if err != nil {
 		goto outFreeUmemArea
 	}
 
 	complexXsk.xsk, err = XskSocketCreate(ifaceName, uint32(queueID),
 		complexXsk.umem, &complexXsk.rx, &complexXsk.tx,
-		&XskSocketConfig{
-			RxSize:      complexXsk.config.SocketConfig.RxSize,
-			TxSize:      complexXsk.config.SocketConfig.TxSize,
-			XdpFlags:    complexXsk.config.SocketConfig.XdpFlags,
-			BindFlags:   complexXsk.config.SocketConfig.BindFlags,
-			LibbpfFlags: complexXsk.config.SocketConfig.LibbpfFlags,
-		})
+		complexSocketConfig(complexXsk.config.SocketConfig))
 	if err != nil {
 		goto outFreeUmem
 	}
-	descs = make([]XDPDesc, complexXsk.config.UmemConfig.FrameNum)
-	for i := uint32(0); i < complexXsk.config.UmemConfig.FrameNum; i++ {
-		descs[i].Addr = uint64(i * complexXsk.config.UmemConfig.FrameSize)
-	}
+	complexXsk.zeroCopy = xskIsZeroCopy(complexXsk.xsk.Fd)
+	complexXsk.compBase = atomic.LoadUint32(complexXsk.comp.Producer)
+	descs = complexXskDescs(complexXsk.umem, complexXsk.config.UmemConfig)
 
 	return complexXsk, descs, nil
 
@@ -129,67 +152,204 @@ outFreeUmem:
 	XskUmemDelete(complexXsk.umem)
 
 outFreeUmemArea:
-	unix.Munmap(complexXsk.umemArea)
+	complexXsk.allocator.Free(complexXsk.umemArea)
 	return nil, nil, err
 }
 
-func (xsk *ComplexXsk) PopulateFillRing(descs []XDPDesc) []XDPDesc {
-	pos := uint32(0)
-	freeSize := XskProdNbFree(&xsk.fill, uint32(len(descs)))
-	if freeSize > uint32(len(descs)) {
-		freeSize = uint32(len(descs))
+// complexUmemConfig 将 ComplexUmemConfig 转换为 XskUmemConfig。
+func complexUmemConfig(config *ComplexUmemConfig) *XskUmemConfig {
+	return &XskUmemConfig{
+		FillSize:      config.FillSize,
+		CompSize:      config.CompSize,
+		FrameSize:     config.FrameSize,
+		FrameHeadroom: config.FrameHeadroom,
+		Flags:         config.Flags,
+		TxMetadataLen: config.TxMetadataLen,
+		Logger:        config.Logger,
 	}
-	nb := XskRingProdReserve(&xsk.fill, freeSize, &pos)
-	for i := uint32(0); i < nb; i++ {
-		*XskRingProdFillAddr(&xsk.fill, pos+i) = descs[i].Addr
+}
+
+// complexSocketConfig 将 ComplexSocketConfig 转换为 XskSocketConfig。
+func complexSocketConfig(config *ComplexSocketConfig) *XskSocketConfig {
+	return &XskSocketConfig{
+		RxSize:         config.RxSize,
+		TxSize:         config.TxSize,
+		XdpFlags:       config.XdpFlags,
+		BindFlags:      config.BindFlags,
+		LibbpfFlags:    config.LibbpfFlags,
+		BindMode:       config.BindMode,
+		BusyPoll:       config.BusyPoll,
+		BusyPollBudget: config.BusyPollBudget,
+		PreferBusyPoll: config.PreferBusyPoll,
+		Logger:         config.Logger,
 	}
-	XskRingProdSubmit(&xsk.fill, nb)
-	leftDescs := make([]XDPDesc, len(descs)-int(nb))
+}
+
+// complexXskDescs 返回 umem 中所有帧的描述符，启用 TX 元数据时数据之前预留元数据的空间。
+func complexXskDescs(umem *XskUmem, config *ComplexUmemConfig) []XDPDesc {
+	descs := make([]XDPDesc, config.FrameNum)
+	for i := uint32(0); i < config.FrameNum; i++ {
+		descs[i].Addr = XskUmemAddrWithOffset(umem, uint64(i)*uint64(config.FrameSize), uint64(config.TxMetadataLen))
+	}
+	return descs
+}
+
+// PopulateFillRing 将描述符对应的帧放入 fill ring，返回未能放入的描述符。
+// 描述符可以直接来自 RecycleRxRing 或 RecycleCompRing，地址会先归一化为帧起始地址。
+// 每次调用都会分配新的切片，热路径中应使用 FillBatch。
+func (xsk *ComplexXsk) PopulateFillRing(descs []XDPDesc) []XDPDesc {
+	nb := xsk.FillBatch(descs)
+	leftDescs := make([]XDPDesc, len(descs)-nb)
 	copy(leftDescs, descs[nb:])
 	return leftDescs
 }
 
+// RecycleRxRing 从 rx ring 中取出已接收的描述符。
+// 描述符地址保持内核返回的原样（可能包含 headroom 偏移，非对齐模式下偏移位于高 16 位），
+// 应通过 UmemArea 访问数据，可以直接交给 PopulateTxRing 转发或交给 PopulateFillRing 回收。
+// 多缓冲区（XDP_USE_SG）模式下只返回完整的数据包，末尾未接收完整的片段留在 rx ring 中等待下次调用，
+// 可以通过 SplitPacket 逐个拆分数据包。
+// 每次调用都会分配新的切片，热路径中应使用 RecvBatch。
 func (xsk *ComplexXsk) RecycleRxRing() []XDPDesc {
+	descs := make([]XDPDesc, XskConsNbAvail(&xsk.rx, xsk.config.SocketConfig.RxSize))
+	return descs[:xsk.RecvBatch(descs)]
+}
+
+// PopulateTxRing 将描述符放入 tx ring，返回未能放入的描述符。
+// 描述符的 Options 会被原样提交，多缓冲区模式下以 XDP_PKT_CONTD 串联的片段只会整包放入，不会从中间截断。
+// 带有 XDP_TX_METADATA 的描述符在复制模式下（例如 veth 或 XDP_FLAGS_SKB_MODE）由软件完成校验和卸载请求，时间戳请求被忽略，
+// 帧中的 TX 元数据请求随之清除；没有剩余请求时写入 tx ring 的描述符去掉 XDP_TX_METADATA，descs 本身不会被修改。
+// 每次调用都会分配新的切片，热路径中应使用 SendBatch。
+func (xsk *ComplexXsk) PopulateTxRing(descs []XDPDesc) []XDPDesc {
+	nb := xsk.SendBatch(descs)
+	leftDescs := make([]XDPDesc, len(descs)-nb)
+	copy(leftDescs, descs[nb:])
+	return leftDescs
+}
+
+// RecycleCompRing 从 completion ring 中取出发送完成的描述符，地址与提交到 tx ring 时相同。
+// 每次调用都会分配新的切片，热路径中应使用 CompleteBatch。
+func (xsk *ComplexXsk) RecycleCompRing() []XDPDesc {
+	descs := make([]XDPDesc, XskConsNbAvail(xsk.comp, xsk.umem.Config.CompSize))
+	return descs[:xsk.CompleteBatch(descs)]
+}
+
+// FillBatch 与 PopulateFillRing 相同，但不分配内存：将 src 中描述符对应的帧放入 fill ring，
+// 返回放入的数量 n，src[n:] 为未能放入的描述符。放入后如果 fill ring 需要唤醒则调用 WakeupRx。
+func (xsk *ComplexXsk) FillBatch(src []XDPDesc) int {
 	pos := uint32(0)
-	nPkts := XskRingConsPeek(&xsk.rx, xsk.config.SocketConfig.RxSize, &pos)
-	descs := make([]XDPDesc, nPkts)
+	freeSize := XskProdNbFree(xsk.fill, uint32(len(src)))
+	if freeSize > uint32(len(src)) {
+		freeSize = uint32(len(src))
+	}
+	nb := XskRingProdReserve(xsk.fill, freeSize, &pos)
+	for i := uint32(0); i < nb; i++ {
+		*XskRingProdFillAddr(xsk.fill, pos+i) = XskUmemFrameAddr(xsk.umem, src[i].Addr)
+	}
+	XskRingProdSubmit(xsk.fill, nb)
+	if nb > 0 {
+		XskSocketWakeupRx(xsk.xsk)
+	}
+	return int(nb)
+}
+
+// RecvBatch 与 RecycleRxRing 相同，但不分配内存：从 rx ring 中取出最多 len(dst) 个描述符写入 dst，返回写入的数量。
+// 多缓冲区模式下只返回完整的数据包，dst 至少要能容纳一个最大数据包的全部片段，否则总是返回 0。
+// rx ring 为空时如果 fill ring 需要唤醒则调用 WakeupRx。
+func (xsk *ComplexXsk) RecvBatch(dst []XDPDesc) int {
+	pos := uint32(0)
+	nPkts := XskRingConsPeek(&xsk.rx, uint32(len(dst)), &pos)
 	for i := uint32(0); i < nPkts; i++ {
-		desc := XskRingConsRxDesc(&xsk.rx, pos+i)
-		descs[i] = *desc
+		dst[i] = *XskRingConsRxDesc(&xsk.rx, pos+i)
 	}
-	XskRingConsRelease(&xsk.rx, nPkts)
-	return descs
+	partial := nPkts - uint32(xskPacketBoundary(dst[:nPkts]))
+	XskRingConsCancel(&xsk.rx, partial)
+	XskRingConsRelease(&xsk.rx, nPkts-partial)
+	if nPkts == 0 {
+		XskSocketWakeupRx(xsk.xsk)
+	}
+	return int(nPkts - partial)
 }
 
-func (xsk *ComplexXsk) PopulateTxRing(descs []XDPDesc) []XDPDesc {
+// SendBatch 与 PopulateTxRing 相同，但不分配内存：将 src 中的描述符放入 tx ring，
+// 返回放入的数量 n，src[n:] 为未能放入的描述符。提交后调用 KickTx 通知内核发送，tx ring 已满时也会调用以便腾出空间。
+func (xsk *ComplexXsk) SendBatch(src []XDPDesc) int {
 	pos := uint32(0)
-	freeSize := XskProdNbFree(&xsk.tx, uint32(len(descs)))
-	if freeSize > uint32(len(descs)) {
-		freeSize = uint32(len(descs))
+	freeSize := XskProdNbFree(&xsk.tx, uint32(len(src)))
+	if freeSize > uint32(len(src)) {
+		freeSize = uint32(len(src))
 	}
+	freeSize = uint32(xskPacketBoundary(src[:freeSize]))
 	nb := XskRingProdReserve(&xsk.tx, freeSize, &pos)
 	for i := uint32(0); i < nb; i++ {
-		XskRingProdTxDesc(&xsk.tx, pos+i).Addr = descs[i].Addr
-		XskRingProdTxDesc(&xsk.tx, pos+i).Len = descs[i].Len
+		*XskRingProdTxDesc(&xsk.tx, pos+i) = src[i]
+	}
+	if !xsk.zeroCopy && xsk.config.UmemConfig.TxMetadataLen != 0 {
+		xsk.txMetadataCopyMode(src[:nb], pos)
 	}
 	XskRingProdSubmit(&xsk.tx, nb)
-	leftDescs := make([]XDPDesc, len(descs)-int(nb))
-	copy(leftDescs, descs[nb:])
-	return leftDescs
+	if len(src) > 0 {
+		XskSocketKickTx(xsk.xsk)
+	}
+	return int(nb)
 }
 
-func (xsk *ComplexXsk) RecycleCompRing() []XDPDesc {
+// CompleteBatch 与 RecycleCompRing 相同，但不分配内存：从 completion ring 中取出最多 len(dst) 个发送完成的描述符写入 dst，
+// 返回写入的数量。只有 Addr 有效，Len 和 Options 被置为 0。
+// completion ring 为空而 tx ring 中仍有未发送的描述符时调用 KickTx，避免复制模式下发送停滞。
+func (xsk *ComplexXsk) CompleteBatch(dst []XDPDesc) int {
 	pos := uint32(0)
-	nPkts := XskRingConsPeek(&xsk.comp, xsk.umem.Config.CompSize, &pos)
-	descs := make([]XDPDesc, nPkts)
+	nPkts := XskRingConsPeek(xsk.comp, uint32(len(dst)), &pos)
 	for i := uint32(0); i < nPkts; i++ {
-		descs[i].Addr = *XskRingConsCompAddr(&xsk.comp, pos+i)
+		dst[i] = XDPDesc{Addr: *XskRingConsCompAddr(xsk.comp, pos+i)}
 	}
-	XskRingConsRelease(&xsk.comp, nPkts)
-	return descs
+	XskRingConsRelease(xsk.comp, nPkts)
+	if nPkts == 0 && XskProdNbFree(&xsk.tx, xsk.tx.Size) < xsk.tx.Size {
+		XskSocketKickTx(xsk.xsk)
+	}
+	return int(nPkts)
+}
+
+// Shutdown 在关闭套接字之前等待已提交到 tx ring 的数据包发送完成：不断调用 KickTx 通知内核发送，
+// 直到 completion ring 追上 tx ring 或 ctx 结束，然后调用 Close。调用 Shutdown 之前应停止调用 SendBatch。
+// 只有本套接字使用 completion ring 时，其中尚未取出的描述符会被丢弃，以免 completion ring 已满导致内核停止发送；
+// 同一队列上还有其他共享 umem 的套接字时，它们的发送完成也会被计入，只能近似地等待。
+// ctx 结束时仍然会关闭套接字，返回的错误包含 ctx 结束的原因和未完成的描述符数量。
+func (xsk *ComplexXsk) Shutdown(ctx context.Context) error {
+	if xsk.xsk == nil {
+		return nil
+	}
+	var err error
+	if xsk.xsk.Tx != nil {
+		exclusive := xsk.xsk.Ctx.Refcount == 1
+		err = xskDrainTx(ctx, xsk.xsk, func() uint32 {
+			if exclusive {
+				pos := uint32(0)
+				XskRingConsRelease(xsk.comp, XskRingConsPeek(xsk.comp, xsk.comp.Size, &pos))
+			}
+			return xsk.txPending()
+		})
+	}
+	xsk.Close()
+	return err
+}
+
+// txPending 返回已提交到 tx ring 但 completion ring 中还没有对应完成的描述符数量。
+func (xsk *ComplexXsk) txPending() uint32 {
+	completed := atomic.LoadUint32(xsk.comp.Producer) - xsk.compBase
+	pending := int32(atomic.LoadUint32(xsk.tx.Producer) - completed)
+	if pending < 0 {
+		return 0
+	}
+	return uint32(pending)
 }
 
 func (xsk *ComplexXsk) Close() {
+	if xsk.shared != nil {
+		// umem 属于 SharedUmem，只关闭套接字
+		xsk.shared.closeSocket(xsk)
+		return
+	}
 	if xsk.xsk != nil {
 		XskSocketDelete(xsk.xsk)
 		xsk.xsk = nil
@@ -201,11 +361,79 @@ func (xsk *ComplexXsk) Close() {
 	}
 
 	if xsk.umemArea != nil {
-		unix.Munmap(xsk.umemArea)
+		if err := xsk.allocator.Free(xsk.umemArea); err != nil {
+			xskLogger(xsk.config.UmemConfig.Logger).Warn("free umem area failed", "err", err)
+		}
 		xsk.umemArea = nil
 	}
 }
 
+// ZeroCopy 返回套接字是否以零拷贝模式运行，复制模式下的吞吐量通常明显更低。
+func (xsk *ComplexXsk) ZeroCopy() bool {
+	return xsk.zeroCopy
+}
+
+// XdpAttachMode 返回网卡上 XDP 程序实际的挂载模式（见 XskSocket.XdpAttachMode）。
+func (xsk *ComplexXsk) XdpAttachMode() (link.XDPAttachFlags, error) {
+	return xsk.xsk.XdpAttachMode()
+}
+
+// UpdateXskmap 以 key 为键把套接字写入调用者的 xsksMap（见 XskSocketUpdateXskmapKey），Close 时删除。
+func (xsk *ComplexXsk) UpdateXskmap(xsksMap *ebpf.Map, key uint32) error {
+	return XskSocketUpdateXskmapKey(xsk.xsk, xsksMap, key)
+}
+
+// Filter 返回默认程序的过滤规则表（见 XskSocketGetFilter），需要在 LibbpfFlags 中设置 XSK_LIBBPF_FLAGS__FILTER。
+func (xsk *ComplexXsk) Filter() (*XskFilter, error) {
+	return XskSocketGetFilter(xsk.xsk)
+}
+
+// SetSampleConfig 修改套接字所在队列的采样配置（见 XskSocketSetSampleConfig），需要在 LibbpfFlags 中设置 XSK_LIBBPF_FLAGS__SAMPLE。
+func (xsk *ComplexXsk) SetSampleConfig(config XskSampleConfig) error {
+	return XskSocketSetSampleConfig(xsk.xsk, config)
+}
+
+// SampleConfig 返回套接字所在队列的采样配置。
+func (xsk *ComplexXsk) SampleConfig() (XskSampleConfig, error) {
+	return XskSocketGetSampleConfig(xsk.xsk)
+}
+
+// SampleStats 返回套接字所在队列的采样统计。
+func (xsk *ComplexXsk) SampleStats() (XskSampleStats, error) {
+	return XskSocketGetSampleStats(xsk.xsk)
+}
+
+// Fanout 返回套接字所在队列的分发表（见 XskSocketGetFanout），需要在 LibbpfFlags 中设置 XSK_LIBBPF_FLAGS__FANOUT。
+func (xsk *ComplexXsk) Fanout() (*XskFanout, error) {
+	return XskSocketGetFanout(xsk.xsk)
+}
+
+// FanoutSlot 返回套接字在队列中占用的分发槽位。
+func (xsk *ComplexXsk) FanoutSlot() (uint32, error) {
+	return XskSocketFanoutSlot(xsk.xsk)
+}
+
+// Statistics 返回套接字的统计信息（见 XskSocket.Statistics）。
+// 接收速率低于发送速率时，Rx_fill_ring_empty_descs 增长说明 fill ring 补充不及时，Rx_ring_full 增长说明 rx ring 处理不及时。
+func (xsk *ComplexXsk) Statistics() (unix.XDPStatistics, error) {
+	return xsk.xsk.Statistics()
+}
+
+// KickTx 通知内核发送 tx ring 中已提交的描述符（见 XskSocketKickTx），SendBatch 和 CompleteBatch 会在需要时自动调用。
+func (xsk *ComplexXsk) KickTx() error {
+	return XskSocketKickTx(xsk.xsk)
+}
+
+// WakeupRx 在 fill ring 需要唤醒时唤醒内核接收（见 XskSocketWakeupRx），FillBatch 和 RecvBatch 会在需要时自动调用。
+func (xsk *ComplexXsk) WakeupRx() error {
+	return XskSocketWakeupRx(xsk.xsk)
+}
+
+// WakeupStats 返回套接字唤醒内核的次数。
+func (xsk *ComplexXsk) WakeupStats() XskWakeupStats {
+	return XskSocketGetWakeupStats(xsk.xsk)
+}
+
 func (xsk *ComplexXsk) Poll(events int16, timeout int) int16 {
 	pollFds := []unix.PollFd{
 		{
@@ -217,6 +445,136 @@ func (xsk *ComplexXsk) Poll(events int16, timeout int) int16 {
 	return pollFds[0].Revents
 }
 
+// UmemArea 返回描述符指向的数据区域，从数据起始位置到所在帧的末尾。
+// 对齐和非对齐模式下的地址都会被正确解码。
 func (xsk *ComplexXsk) UmemArea(desc XDPDesc) []byte {
-	return xsk.umemArea[desc.Addr : desc.Addr+uint64(xsk.config.UmemConfig.FrameSize)]
+	data := XskUmemDataAddr(xsk.umem, desc.Addr)
+	end := XskUmemFrameAddr(xsk.umem, desc.Addr) + uint64(xsk.config.UmemConfig.FrameSize)
+	if size := uint64(xsk.config.UmemConfig.FrameNum) * uint64(xsk.config.UmemConfig.FrameSize); end > size {
+		end = size
+	}
+	return xsk.umemArea[data:end]
+}
+
+// xskPacketBoundary 返回 descs 中完整数据包占用的描述符数量，即最后一个不带 XDP_PKT_CONTD 的描述符之后的位置。
+func xskPacketBoundary(descs []XDPDesc) int {
+	for i := len(descs) - 1; i >= 0; i-- {
+		if descs[i].Options&unix.XDP_PKT_CONTD == 0 {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// SplitPacket 从 descs 中拆分出第一个数据包的全部描述符，返回该数据包的描述符和剩余的描述符。
+// 非多缓冲区模式下每个数据包只有一个描述符。如果 descs 中没有完整的数据包，pkt 为 nil。
+func SplitPacket(descs []XDPDesc) (pkt []XDPDesc, rest []XDPDesc) {
+	for i := range descs {
+		if descs[i].Options&unix.XDP_PKT_CONTD == 0 {
+			return descs[:i+1], descs[i+1:]
+		}
+	}
+	return nil, descs
+}
+
+// AppendPacket 将一个数据包所有片段的数据依次追加到 dst 中并返回结果，descs 通常来自 SplitPacket。
+func (xsk *ComplexXsk) AppendPacket(dst []byte, descs []XDPDesc) []byte {
+	for _, desc := range descs {
+		dst = append(dst, xsk.UmemArea(desc)[:desc.Len]...)
+	}
+	return dst
+}
+
+// WriteTxPacket 将 data 写入 descs 指向的帧中，超过单帧容量的数据会被拆分到后续的描述符，
+// 除最后一个片段外都设置 XDP_PKT_CONTD（需要以 XDP_USE_SG 绑定套接字）。
+// 返回使用的描述符数量，使用的描述符可以直接交给 PopulateTxRing；data 为空或 descs 不足以容纳 data 时不做任何修改并返回 0。
+func (xsk *ComplexXsk) WriteTxPacket(descs []XDPDesc, data []byte) int {
+	if len(data) == 0 {
+		// 内核会拒绝长度为 0 的 tx 描述符
+		return 0
+	}
+	total := 0
+	n := 0
+	for n < len(descs) {
+		total += len(xsk.UmemArea(descs[n]))
+		n++
+		if total >= len(data) {
+			break
+		}
+	}
+	if total < len(data) || n == 0 {
+		return 0
+	}
+	for i := 0; i < n; i++ {
+		copied := copy(xsk.UmemArea(descs[i]), data)
+		data = data[copied:]
+		descs[i].Len = uint32(copied)
+		descs[i].Options = unix.XDP_PKT_CONTD
+	}
+	descs[n-1].Options = 0
+	return n
+}
+
+// RxMetadata 返回从 RecycleRxRing 取出的描述符之前的 RX 元数据，多缓冲区模式下只有数据包的第一个描述符带有元数据。
+// 需要在 LibbpfFlags 中设置 XSK_LIBBPF_FLAGS__RX_METADATA，元数据不可用时返回 false。
+func (xsk *ComplexXsk) RxMetadata(desc XDPDesc) (XskRxMetadata, bool) {
+	if xsk.config.SocketConfig.LibbpfFlags&XSK_LIBBPF_FLAGS__RX_METADATA == 0 {
+		return XskRxMetadata{}, false
+	}
+	return XskGetRxMetadata(xsk.umemArea, XskUmemDataAddr(xsk.umem, desc.Addr))
+}
+
+// TxMetadata 返回 desc 的 TX 元数据并在 desc.Options 中设置 XDP_TX_METADATA，之后可以调用其 Request 系列方法，
+// desc 首次设置时会清空元数据中残留的请求。只有数据包的第一个描述符需要设置，且描述符地址之前需要预留 TxMetadataLen 字节。
+// 没有配置 TxMetadataLen 时返回 nil。
+func (xsk *ComplexXsk) TxMetadata(desc *XDPDesc) *XskTxMetadata {
+	meta := XskUmemTxMetadata(xsk.umem, desc.Addr)
+	if meta == nil {
+		return nil
+	}
+	if desc.Options&unix.XDP_TX_METADATA == 0 {
+		*meta = XskTxMetadata{}
+		desc.Options |= unix.XDP_TX_METADATA
+	}
+	return meta
+}
+
+// TxTimestamp 返回从 RecycleCompRing 回收的描述符的发送时间戳，只对通过 TxMetadata 请求了时间戳的描述符有效，
+// 复制模式下总是返回 false。
+func (xsk *ComplexXsk) TxTimestamp(desc XDPDesc) (uint64, bool) {
+	meta := XskUmemTxMetadata(xsk.umem, desc.Addr)
+	if meta == nil {
+		return 0, false
+	}
+	return meta.TxTimestamp()
+}
+
+// txMetadataCopyMode 在复制模式下处理 descs 中数据包的 TX 元数据请求（见 xskTxMetadataCopyMode），
+// descs 已经从 pos 开始写入 tx ring，需要去掉 XDP_TX_METADATA 时只修改 tx ring 中的描述符，不修改调用者的 descs。
+// 内核从 6.11 开始也可以通过 XDP_UMEM_TX_SW_CSUM 计算校验和，这里在用户态计算以兼容更早的内核。
+func (xsk *ComplexXsk) txMetadataCopyMode(descs []XDPDesc, pos uint32) {
+	for len(descs) > 0 {
+		pkt, rest := SplitPacket(descs)
+		if pkt == nil {
+			return
+		}
+		descs = rest
+		first := pos
+		pos += uint32(len(pkt))
+		if pkt[0].Options&unix.XDP_TX_METADATA == 0 {
+			continue
+		}
+		// 复用 txFrags，避免在发送路径上分配内存
+		frags := xsk.txFrags[:0]
+		for _, desc := range pkt {
+			frags = append(frags, xsk.UmemArea(desc)[:desc.Len])
+		}
+		xsk.txFrags = frags
+		meta := XskUmemTxMetadata(xsk.umem, pkt[0].Addr)
+		xskTxMetadataCopyMode(meta, frags)
+		if meta.Flags == 0 {
+			// 没有其他请求时不再提交元数据，兼容不支持 XDP_TX_METADATA 的内核
+			XskRingProdTxDesc(&xsk.tx, first).Options &^= unix.XDP_TX_METADATA
+		}
+	}
 }
@@ -7,6 +7,7 @@ import (
 	"sync/atomic"
 	"testing"
 	"time"
+	"unsafe"
 
 	"github.com/cilium/ebpf/link"
 	"github.com/google/gopacket"
@@ -270,3 +271,234 @@ func TestComplexXsk(t *testing.T) {
 		rxDesc[i] = descs[i+2048]
 	}
 }
+
+func TestComplexXskWriteTxPacket(t *testing.T) {
+	umemConfig := &ComplexUmemConfig{FrameNum: 4, FrameSize: 2048}
+	xsk := &ComplexXsk{
+		umemArea: make([]byte, 4*2048),
+		umem:     &XskUmem{Config: XskUmemConfig{FrameSize: 2048}},
+		config:   ComplexXskConfig{UmemConfig: umemConfig},
+	}
+	descs := make([]XDPDesc, 4)
+	for i := range descs {
+		descs[i].Addr = uint64(i) * 2048
+	}
+	data := make([]byte, 5000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	if n := xsk.WriteTxPacket(descs[:2], data); n != 0 {
+		t.Fatalf("Expected WriteTxPacket to fail with 2 frames, got %d", n)
+	}
+	if n := xsk.WriteTxPacket(descs, nil); n != 0 || descs[0].Len != 0 {
+		t.Fatalf("Expected WriteTxPacket to skip empty data, got %d", n)
+	}
+	n := xsk.WriteTxPacket(descs, data)
+	if n != 3 {
+		t.Fatalf("Expected WriteTxPacket to use 3 frames, got %d", n)
+	}
+	if descs[0].Options != unix.XDP_PKT_CONTD || descs[1].Options != unix.XDP_PKT_CONTD || descs[2].Options != 0 {
+		t.Errorf("Unexpected options %d %d %d", descs[0].Options, descs[1].Options, descs[2].Options)
+	}
+	if descs[2].Len != 5000-2*2048 {
+		t.Errorf("Expected last frag len to be %d, got %d", 5000-2*2048, descs[2].Len)
+	}
+
+	pkt, rest := SplitPacket(descs[:n])
+	if len(pkt) != 3 || len(rest) != 0 {
+		t.Fatalf("Expected SplitPacket to return 3 descs, got %d (rest %d)", len(pkt), len(rest))
+	}
+	got := xsk.AppendPacket(nil, pkt)
+	if string(got) != string(data) {
+		t.Errorf("AppendPacket mismatch")
+	}
+	if pkt, rest := SplitPacket(descs[:2]); pkt != nil || len(rest) != 2 {
+		t.Errorf("Expected SplitPacket to return no packet for partial descs")
+	}
+	if boundary := xskPacketBoundary(descs[:2]); boundary != 0 {
+		t.Errorf("Expected packet boundary to be 0, got %d", boundary)
+	}
+}
+
+// newTestRings 创建一对共享同一块内存的生产者和消费者环，用于在没有套接字的情况下测试批量接口。
+func newTestRings(size uint32, entrySize uintptr) (*XskRingProd, *XskRingCons) {
+	ring := make([]byte, uintptr(size)*entrySize)
+	producer, consumer, flags := new(uint32), new(uint32), new(uint32)
+	prod := &XskRingProd{Mask: size - 1, Size: size, CachedCons: size,
+		Producer: producer, Consumer: consumer, Ring: unsafe.Pointer(&ring[0]), Flags: flags}
+	cons := &XskRingCons{Mask: size - 1, Size: size,
+		Producer: producer, Consumer: consumer, Ring: unsafe.Pointer(&ring[0]), Flags: flags}
+	return prod, cons
+}
+
+func TestComplexXskBatch(t *testing.T) {
+	const ringSize = 8
+	xsk := &ComplexXsk{
+		umem: &XskUmem{Config: XskUmemConfig{FrameSize: 2048, FrameHeadroom: 0, CompSize: ringSize}},
+		config: ComplexXskConfig{
+			UmemConfig:   &ComplexUmemConfig{FrameNum: 16, FrameSize: 2048},
+			SocketConfig: &ComplexSocketConfig{RxSize: ringSize},
+		},
+	}
+	fill, fillCons := newTestRings(ringSize, 8)
+	compProd, comp := newTestRings(ringSize, 8)
+	rxProd, rx := newTestRings(ringSize, unsafe.Sizeof(XDPDesc{}))
+	tx, txCons := newTestRings(ringSize, unsafe.Sizeof(XDPDesc{}))
+	xsk.fill, xsk.comp, xsk.rx, xsk.tx = fill, comp, *rx, *tx
+	// 环没有设置 XDP_RING_NEED_WAKEUP，批量接口不会唤醒内核
+	xsk.xsk = &XskSocket{Tx: &xsk.tx, Ctx: &XskCtx{Fill: fill, Umem: &XskUmem{needWakeup: true}}, Fd: -1}
+
+	descs := make([]XDPDesc, 10)
+	for i := range descs {
+		descs[i].Addr = uint64(i)*2048 + 256
+	}
+	if n := xsk.FillBatch(descs); n != ringSize {
+		t.Fatalf("Expected FillBatch to place %d descs, got %d", ringSize, n)
+	}
+	pos := uint32(0)
+	if n := XskRingConsPeek(fillCons, ringSize, &pos); n != ringSize || *XskRingConsCompAddr(fillCons, pos+1) != 2048 {
+		t.Errorf("Expected fill ring to hold %d frame addresses, got %d", ringSize, n)
+	}
+
+	// rx ring 中有 2 个完整的数据包和 1 个未接收完整的片段
+	nb := XskRingProdReserve(rxProd, 4, &pos)
+	for i := uint32(0); i < nb; i++ {
+		*XskRingProdTxDesc(rxProd, pos+i) = XDPDesc{Addr: uint64(i) * 2048, Len: 64}
+	}
+	XskRingProdTxDesc(rxProd, pos+1).Options = unix.XDP_PKT_CONTD
+	XskRingProdTxDesc(rxProd, pos+3).Options = unix.XDP_PKT_CONTD
+	XskRingProdSubmit(rxProd, nb)
+	dst := make([]XDPDesc, ringSize)
+	if n := xsk.RecvBatch(dst); n != 3 {
+		t.Fatalf("Expected RecvBatch to return 3 descs, got %d", n)
+	}
+	if n := xsk.RecvBatch(dst); n != 0 {
+		t.Errorf("Expected partial packet to stay in rx ring, got %d descs", n)
+	}
+
+	// 多缓冲区数据包不会被截断
+	descs[ringSize-1].Options = unix.XDP_PKT_CONTD
+	if n := xsk.SendBatch(descs); n != ringSize-1 {
+		t.Fatalf("Expected SendBatch to place %d descs, got %d", ringSize-1, n)
+	}
+	if n := XskRingConsPeek(txCons, ringSize, &pos); n != ringSize-1 || XskRingConsRxDesc(txCons, pos+2).Addr != descs[2].Addr {
+		t.Errorf("Unexpected tx ring content")
+	}
+	XskRingConsRelease(txCons, ringSize-1)
+
+	nb = XskRingProdReserve(compProd, 2, &pos)
+	*XskRingProdFillAddr(compProd, pos) = 4096
+	*XskRingProdFillAddr(compProd, pos+1) = 6144
+	XskRingProdSubmit(compProd, nb)
+	if n := xsk.CompleteBatch(dst); n != 2 || dst[1] != (XDPDesc{Addr: 6144}) {
+		t.Errorf("Unexpected CompleteBatch result %d %v", n, dst[:n])
+	}
+
+	descs[ringSize-1].Options = 0
+	allocs := testing.AllocsPerRun(100, func() {
+		XskRingConsRelease(fillCons, XskRingConsPeek(fillCons, ringSize, &pos))
+		xsk.FillBatch(descs[:4])
+		xsk.RecvBatch(dst)
+		XskRingConsRelease(txCons, XskRingConsPeek(txCons, ringSize, &pos))
+		xsk.SendBatch(descs[:4])
+		xsk.CompleteBatch(dst)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected batch APIs to be allocation free, got %f allocations", allocs)
+	}
+	if stats := xsk.WakeupStats(); stats != (XskWakeupStats{}) {
+		t.Errorf("Expected no wakeups, got %+v", stats)
+	}
+}
+
+func TestComplexXskSendBatchTxMetadata(t *testing.T) {
+	const ringSize = 4
+	area := make([]byte, 4*2048)
+	umem := &XskUmem{Config: XskUmemConfig{FrameSize: 2048, TxMetadataLen: XSK_TX_METADATA_LEN}, UmemArea: unsafe.Pointer(&area[0])}
+	xsk := &ComplexXsk{
+		umemArea: area,
+		umem:     umem,
+		config:   ComplexXskConfig{UmemConfig: &ComplexUmemConfig{FrameNum: 4, FrameSize: 2048, TxMetadataLen: XSK_TX_METADATA_LEN}},
+	}
+	tx, txCons := newTestRings(ringSize, unsafe.Sizeof(XDPDesc{}))
+	xsk.tx = *tx
+	xsk.xsk = &XskSocket{Tx: &xsk.tx, Ctx: &XskCtx{Umem: &XskUmem{needWakeup: true}}, Fd: -1}
+
+	descs := make([]XDPDesc, 3)
+	for i := range descs {
+		descs[i] = XDPDesc{Addr: uint64(i)*2048 + XSK_TX_METADATA_LEN, Len: 64}
+	}
+	pos := uint32(0)
+	// 第二次发送时 tx ring 回绕，检查修改的是 tx ring 中对应的描述符
+	for round := 0; round < 2; round++ {
+		// 复制模式下时间戳请求被忽略，没有剩余请求；发送时间请求仍然提交
+		xsk.TxMetadata(&descs[0]).RequestTimestamp()
+		xsk.TxMetadata(&descs[1]).RequestLaunchTime(1)
+		want := append([]XDPDesc(nil), descs...)
+		if n := xsk.SendBatch(descs); n != len(descs) {
+			t.Fatalf("Expected SendBatch to place %d descs, got %d", len(descs), n)
+		}
+		for i := range descs {
+			if descs[i] != want[i] {
+				t.Errorf("round %d: SendBatch modified desc %d: %v, want %v", round, i, descs[i], want[i])
+			}
+		}
+		if n := XskRingConsPeek(txCons, ringSize, &pos); n != uint32(len(descs)) {
+			t.Fatalf("round %d: Expected %d descs in tx ring, got %d", round, len(descs), n)
+		}
+		if options := XskRingConsRxDesc(txCons, pos).Options; options != 0 {
+			t.Errorf("round %d: Expected XDP_TX_METADATA to be cleared in tx ring, got %d", round, options)
+		}
+		if options := XskRingConsRxDesc(txCons, pos+1).Options; options != unix.XDP_TX_METADATA {
+			t.Errorf("round %d: Expected XDP_TX_METADATA to be kept in tx ring, got %d", round, options)
+		}
+		XskRingConsRelease(txCons, uint32(len(descs)))
+	}
+}
+
+// retryOnBusy 在 f 返回 EBUSY 时重试：关闭套接字后内核异步释放队列，立即重新绑定同一队列会返回 EBUSY。
+func retryOnBusy(f func() error) error {
+	for i := 0; ; i++ {
+		err := f()
+		if !errors.Is(err, unix.EBUSY) || i == 50 {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestComplexXskBindMode(t *testing.T) {
+	// lo 不支持零拷贝，也不支持查询队列数量，这里不载入 XDP 程序
+	config := DefaultComplexXskConfig()
+	config.SocketConfig.LibbpfFlags = XSK_LIBBPF_FLAGS__INHIBIT_PROG_LOAD
+	config.SocketConfig.BindMode = XSK_BIND_MODE__ZEROCOPY_REQUIRED
+	err := retryOnBusy(func() error {
+		_, _, err := NewComplexXsk("lo", 0, config)
+		return err
+	})
+	if !errors.Is(err, ErrZeroCopyNotSupported) || !errors.Is(err, unix.EOPNOTSUPP) {
+		t.Fatalf("Expected ErrZeroCopyNotSupported, got %v", err)
+	}
+
+	for _, mode := range []uint32{XSK_BIND_MODE__ZEROCOPY_PREFERRED, XSK_BIND_MODE__COPY_ONLY} {
+		config.SocketConfig.BindMode = mode
+		var complexXsk *ComplexXsk
+		err := retryOnBusy(func() (err error) {
+			complexXsk, _, err = NewComplexXsk("lo", 0, config)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("NewComplexXsk with bind mode %d failed: %v", mode, err)
+		}
+		if complexXsk.ZeroCopy() {
+			t.Errorf("Expected copy mode with bind mode %d", mode)
+		}
+		complexXsk.Close()
+	}
+
+	config.SocketConfig.BindMode = XSK_BIND_MODE__COPY_ONLY + 1
+	if _, _, err := NewComplexXsk("lo", 0, config); err != unix.EINVAL {
+		t.Errorf("Expected EINVAL for unknown bind mode, got %v", err)
+	}
+}
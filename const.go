@@ -1,5 +1,7 @@
 package xsk
 
+import "github.com/cilium/ebpf/link"
+
 const (
 	XSK_RING_CONS__DEFAULT_NUM_DESCS           = 2048
 	XSK_RING_PROD__DEFAULT_NUM_DESCS           = 2048
@@ -8,7 +10,84 @@ const (
 	XSK_UMEM__DEFAULT_FRAME_HEADROOM           = 0
 	XSK_UMEM__DEFAULT_FLAGS                    = 0
 	XSK_LIBBPF_FLAGS__INHIBIT_PROG_LOAD uint32 = (1 << 0)
+	XSK_LIBBPF_FLAGS__RX_METADATA       uint32 = (1 << 1)
+	XSK_LIBBPF_FLAGS__XDP_DISPATCHER    uint32 = (1 << 2)
+	XSK_LIBBPF_FLAGS__FILTER            uint32 = (1 << 3)
+	XSK_LIBBPF_FLAGS__SAMPLE            uint32 = (1 << 4)
+	XSK_LIBBPF_FLAGS__FANOUT            uint32 = (1 << 5)
 	INIT_NS                                    = 1
 	XSK_UNALIGNED_BUF_OFFSET_SHIFT             = 48
 	XSK_UNALIGNED_BUF_ADDR_MASK                = (1 << XSK_UNALIGNED_BUF_OFFSET_SHIFT) - 1
+	XDP_ABORTED                                = 0
+	XDP_DROP                                   = 1
+	XDP_PASS                                   = 2
+	XDP_TX                                     = 3
+	XDP_REDIRECT                               = 4
+	XDP_TXMD_FLAGS_LAUNCH_TIME                 = (1 << 2)
+	XSK_TX_METADATA_LEN                        = 24
+	XSK_RX_METADATA_LEN                        = 32
+	XSK_RX_METADATA_MAGIC                      = 0x78736b6d
+	XSK_RX_METADATA__TIMESTAMP                 = (1 << 0)
+	XSK_RX_METADATA__HASH                      = (1 << 1)
+	XSK_RX_METADATA__VLAN_TAG                  = (1 << 2)
+	XDP_ATTACHED_NONE                          = 0
+	XDP_ATTACHED_DRV                           = 1
+	XDP_ATTACHED_SKB                           = 2
+	XDP_ATTACHED_HW                            = 3
+	XDP_ATTACHED_MULTI                         = 4
+)
+
+// XDP_MODE_AUTO 用于 XdpFlags 中不指定挂载模式时：先以驱动模式挂载 XDP 程序，失败时退回通用模式（与 libxdp 的 XDP_MODE_UNSPEC 相同）。
+// 指定了 link.XDPDriverMode 等模式时只尝试该模式，不会静默降级。实际使用的模式可以通过 XdpAttachMode 查询。
+const XDP_MODE_AUTO link.XDPAttachFlags = 0
+
+// xskXdpModeMask 为 XdpFlags 中表示挂载模式的位
+const xskXdpModeMask = link.XDPGenericMode | link.XDPDriverMode | link.XDPOffloadMode
+
+// 绑定模式（XskSocketConfig.BindMode）
+const (
+	// XSK_BIND_MODE__DEFAULT 直接使用 BindFlags 绑定，由内核决定零拷贝或复制模式
+	XSK_BIND_MODE__DEFAULT uint32 = iota
+	// XSK_BIND_MODE__ZEROCOPY_REQUIRED 以 XDP_ZEROCOPY 绑定，驱动不支持时返回 ErrZeroCopyNotSupported
+	XSK_BIND_MODE__ZEROCOPY_REQUIRED
+	// XSK_BIND_MODE__ZEROCOPY_PREFERRED 先以 XDP_ZEROCOPY 绑定，驱动不支持（EOPNOTSUPP）时以 XDP_COPY 重试
+	XSK_BIND_MODE__ZEROCOPY_PREFERRED
+	// XSK_BIND_MODE__COPY_ONLY 以 XDP_COPY 绑定
+	XSK_BIND_MODE__COPY_ONLY
+)
+
+// SimpleXsk 的生命周期状态（SimpleXsk.State），只会按 CREATED ⇄ RUNNING → STOPPING → CLOSED 的顺序转换
+const (
+	// SIMPLE_XSK_STATE__CREATED 套接字已创建，没有正在运行的收发循环
+	SIMPLE_XSK_STATE__CREATED uint32 = iota
+	// SIMPLE_XSK_STATE__RUNNING 至少有一个收发循环正在运行
+	SIMPLE_XSK_STATE__RUNNING
+	// SIMPLE_XSK_STATE__STOPPING Shutdown 或 Close 正在停止收发循环，不能再启动新的循环
+	SIMPLE_XSK_STATE__STOPPING
+	// SIMPLE_XSK_STATE__CLOSED 套接字已删除，umem 已释放
+	SIMPLE_XSK_STATE__CLOSED
+)
+
+// XSK_LIBBPF_FLAGS__SAMPLE 程序的采样模式（XskSampleConfig.Mode）
+const (
+	// XSK_SAMPLE_MODE__ALL 重定向所有数据包，为队列的默认模式
+	XSK_SAMPLE_MODE__ALL uint32 = iota
+	// XSK_SAMPLE_MODE__ONE_IN_N 每 Rate 个数据包重定向一个
+	XSK_SAMPLE_MODE__ONE_IN_N
+	// XSK_SAMPLE_MODE__PER_SECOND 每秒最多重定向 Rate 个数据包
+	XSK_SAMPLE_MODE__PER_SECOND
+)
+
+// libxdp 分发程序（见 dispatcher.go）
+const (
+	XDP_DISPATCHER_VERSION = 2
+	XDP_DISPATCHER_MAGIC   = 236
+	// XDP_DISPATCHER_RETVAL 为分发程序中空函数的返回值，总是继续调用下一个程序
+	XDP_DISPATCHER_RETVAL  = 31
+	MAX_DISPATCHER_ACTIONS = 10
+	// 未指定运行配置的程序的优先级和继续调用下一个程序的动作
+	XDP_DEFAULT_RUN_PRIO           = 50
+	XDP_DEFAULT_CHAIN_CALL_ACTIONS = (1 << XDP_PASS)
+	// XSK_DEF_PROG_RUN_PRIO 为默认 XDP 程序在分发程序中的优先级，与 libxdp 相同
+	XSK_DEF_PROG_RUN_PRIO = 20
 )
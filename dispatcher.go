@@ -0,0 +1,757 @@
+package xsk
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"unsafe"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// 以下实现 libxdp 的多程序分发协议（xdp-dispatcher.c，版本 2），分发程序由 xdp/xdp_dispatcher.c 编译。
+//
+// 分发程序以 netlink 挂载到网卡上，每个组件程序以 freplace（BPF_PROG_TYPE_EXT）替换其中一个 progN 函数，
+// 组件按优先级排序，返回值在 chain_call_actions 中时继续运行下一个组件。增删组件时生成新的分发程序并原子地替换旧的分发程序。
+// 状态保存在 bpffs 的 xdp/dispatch-<ifindex>-<分发程序 ID> 目录中，prog<N>-prog 和 prog<N>-link 为第 N 个组件及其 freplace link，
+// 所有修改都在 xdpLockAcquire 的锁中进行，与 libxdp、xdp-loader 共用同一套状态，可以与它们加载的程序共存。
+
+/*
+	struct xdp_dispatcher_config {
+		__u8 magic;
+		__u8 dispatcher_version;
+		__u8 num_progs_enabled;
+		__u8 is_xdp_frags;
+		__u32 chain_call_actions[MAX_DISPATCHER_ACTIONS];
+		__u32 run_prios[MAX_DISPATCHER_ACTIONS];
+		__u32 program_flags[MAX_DISPATCHER_ACTIONS];
+	};
+*/
+type xdpDispatcherConfig struct {
+	Magic             uint8
+	DispatcherVersion uint8
+	NumProgsEnabled   uint8
+	IsXdpFrags        uint8
+	ChainCallActions  [MAX_DISPATCHER_ACTIONS]uint32
+	RunPrios          [MAX_DISPATCHER_ACTIONS]uint32
+	ProgramFlags      [MAX_DISPATCHER_ACTIONS]uint32
+}
+
+// XdpRunConfig 是程序在分发程序中的运行配置，与 libxdp 的 XDP_RUN_CONFIG 相同。
+// Priority 越小越先运行，相同时按程序名称排序；ChainCallActions 为 1<<XDP_PASS 等动作的位掩码，
+// 程序返回其中的动作时继续运行下一个程序，否则直接返回。
+type XdpRunConfig struct {
+	Priority         uint32
+	ChainCallActions uint32
+}
+
+// xdpLoadDispatcher 载入使用 config 的分发程序。
+func xdpLoadDispatcher(config *xdpDispatcherConfig) (*ebpf.Program, error) {
+	spec, err := loadXdp_dispatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err = spec.RewriteConstants(map[string]interface{}{"conf": *config}); err != nil {
+		return nil, err
+	}
+	progSpec, ok := spec.Programs["xdp_dispatcher"]
+	if !ok {
+		return nil, unix.ENOENT
+	}
+	if config.IsXdpFrags != 0 {
+		progSpec.Flags |= unix.BPF_F_XDP_HAS_FRAGS
+	}
+	coll, err := ebpf.NewCollection(spec)
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	return coll.Programs["xdp_dispatcher"].Clone()
+}
+
+// xdpDispatcherGetConfig 读取分发程序的配置，prog 不是分发程序时返回 false。
+func xdpDispatcherGetConfig(prog *ebpf.Program) (*xdpDispatcherConfig, bool, error) {
+	info, err := prog.Info()
+	if err != nil {
+		return nil, false, err
+	}
+	ids, _ := info.MapIDs()
+	if info.Name != "xdp_dispatcher" || len(ids) != 1 {
+		return nil, false, nil
+	}
+	rodata, err := ebpf.NewMapFromID(ids[0])
+	if err != nil {
+		return nil, false, err
+	}
+	defer rodata.Close()
+	config := new(xdpDispatcherConfig)
+	if rodata.ValueSize() != uint32(unsafe.Sizeof(*config)) {
+		return nil, false, fmt.Errorf("不支持的分发程序配置大小 %d: %w", rodata.ValueSize(), unix.EOPNOTSUPP)
+	}
+	if err = rodata.Lookup(uint32(0), config); err != nil {
+		return nil, false, err
+	}
+	if config.Magic != XDP_DISPATCHER_MAGIC || config.DispatcherVersion > XDP_DISPATCHER_VERSION {
+		return nil, false, fmt.Errorf("不支持的分发程序版本 %d: %w", config.DispatcherVersion, unix.EOPNOTSUPP)
+	}
+	return config, true, nil
+}
+
+// xdpDispatcherDir 返回分发程序在 bpffs 中的状态目录。
+func xdpDispatcherDir(ifindex int, id ebpf.ProgramID) (string, error) {
+	dir, err := getBpffsDir()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/dispatch-%d-%d", dir, ifindex, id), nil
+}
+
+// xdpSetLinkXdpFd 通过 netlink 把 fd 对应的程序以 flags 挂载到网卡上，fd 为 -1 时卸载。
+// old 不为 nil 时只在网卡上的程序仍然是 old 时替换（XDP_FLAGS_REPLACE），否则只在网卡上没有程序时挂载。
+func xdpSetLinkXdpFd(ifindex int, fd int, flags link.XDPAttachFlags, old *ebpf.Program) error {
+	req := nl.NewNetlinkRequest(unix.RTM_SETLINK, unix.NLM_F_ACK)
+	msg := nl.NewIfInfomsg(unix.AF_UNSPEC)
+	msg.Index = int32(ifindex)
+	req.AddData(msg)
+	xdpFlags := uint32(flags)
+	attr := nl.NewRtAttr(unix.IFLA_XDP|unix.NLA_F_NESTED, nil)
+	attr.AddRtAttr(unix.IFLA_XDP_FD, nl.Uint32Attr(uint32(int32(fd))))
+	if old != nil {
+		xdpFlags |= unix.XDP_FLAGS_REPLACE
+		attr.AddRtAttr(unix.IFLA_XDP_EXPECTED_FD, nl.Uint32Attr(uint32(old.FD())))
+	} else if fd >= 0 {
+		xdpFlags |= unix.XDP_FLAGS_UPDATE_IF_NOEXIST
+	}
+	attr.AddRtAttr(unix.IFLA_XDP_FLAGS, nl.Uint32Attr(xdpFlags))
+	req.AddData(attr)
+	_, err := req.Execute(unix.NETLINK_ROUTE, 0)
+	return err
+}
+
+// xdpSetExtension 把 XDP 程序的 spec 改为替换 dispatcher 中 attachTo 函数的 freplace 程序。
+func xdpSetExtension(progSpec *ebpf.ProgramSpec, dispatcher *ebpf.Program, attachTo string, frags bool) {
+	progSpec.Type = ebpf.Extension
+	progSpec.AttachType = ebpf.AttachNone
+	progSpec.AttachTarget = dispatcher
+	progSpec.AttachTo = attachTo
+	if frags {
+		progSpec.Flags |= unix.BPF_F_XDP_HAS_FRAGS
+	} else {
+		progSpec.Flags &^= unix.BPF_F_XDP_HAS_FRAGS
+	}
+}
+
+// xdpMultiprogProg 是分发程序中的一个组件程序。
+type xdpMultiprogProg struct {
+	prog      *ebpf.Program
+	name      string
+	id        ebpf.ProgramID
+	runConfig XdpRunConfig
+	flags     uint32
+	// load 用于载入新加入的组件，以 freplace 程序替换 dispatcher 中的 attachTo 函数，
+	// frags 表示分发程序是否支持分片，组件程序的 BPF_F_XDP_HAS_FRAGS 必须与之相同
+	load func(dispatcher *ebpf.Program, attachTo string, frags bool) (*ebpf.Program, error)
+}
+
+// setProg 设置组件程序，并从内核读取程序的名称和 ID。
+func (p *xdpMultiprogProg) setProg(prog *ebpf.Program) error {
+	info, err := prog.Info()
+	if err != nil {
+		return err
+	}
+	p.prog = prog
+	p.name = info.Name
+	p.id, _ = info.ID()
+	return nil
+}
+
+// xdpMultiprog 是网卡上的分发程序及其组件程序（相当于 libxdp 的 struct xdp_multiprog）。
+type xdpMultiprog struct {
+	ifindex    int
+	ifname     string
+	dispatcher *ebpf.Program
+	mode       link.XDPAttachFlags
+	progs      []*xdpMultiprogProg
+}
+
+// xdpMultiprogGet 读取网卡上的分发程序及其组件程序，网卡上没有程序时返回空的 xdpMultiprog。
+// 网卡上的程序不是分发程序时返回 EBUSY。需要在 xdpLockAcquire 的锁中调用。
+func xdpMultiprogGet(ifindex int) (*xdpMultiprog, error) {
+	ifLink, err := netlink.LinkByIndex(ifindex)
+	if err != nil {
+		return nil, err
+	}
+	mp := &xdpMultiprog{ifindex: ifindex, ifname: ifLink.Attrs().Name}
+	if ifLink.Attrs().Xdp == nil || !ifLink.Attrs().Xdp.Attached {
+		return mp, nil
+	}
+	progID := ifLink.Attrs().Xdp.ProgId
+	prog, err := ebpf.NewProgramFromID(ebpf.ProgramID(progID))
+	if err != nil {
+		return nil, err
+	}
+	config, ok, err := xdpDispatcherGetConfig(prog)
+	if err == nil && !ok {
+		err = fmt.Errorf("%s 上已挂载的 XDP 程序 %d 不是分发程序: %w", mp.ifname, progID, unix.EBUSY)
+	}
+	if err != nil {
+		prog.Close()
+		return nil, err
+	}
+	mp.dispatcher = prog
+	mp.mode, err = xskGetXdpAttachMode(ifindex, progID)
+	if err != nil {
+		mp.Close()
+		return nil, err
+	}
+	dir, err := xdpDispatcherDir(ifindex, ebpf.ProgramID(progID))
+	if err != nil {
+		mp.Close()
+		return nil, err
+	}
+	for i := 0; i < int(config.NumProgsEnabled); i++ {
+		p := &xdpMultiprogProg{
+			runConfig: XdpRunConfig{
+				Priority:         config.RunPrios[i],
+				ChainCallActions: config.ChainCallActions[i] &^ (1 << XDP_DISPATCHER_RETVAL),
+			},
+			flags: config.ProgramFlags[i],
+		}
+		prog, err := ebpf.LoadPinnedProgram(fmt.Sprintf("%s/prog%d-prog", dir, i), nil)
+		if err == nil {
+			err = p.setProg(prog)
+		}
+		if err != nil {
+			prog.Close()
+			mp.Close()
+			return nil, fmt.Errorf("读取 %s 上分发程序的第 %d 个程序失败: %w", mp.ifname, i, err)
+		}
+		mp.progs = append(mp.progs, p)
+	}
+	return mp, nil
+}
+
+// find 返回名称为 name 的组件程序。
+func (mp *xdpMultiprog) find(name string) *xdpMultiprogProg {
+	for _, p := range mp.progs {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// without 返回除 ID 为 id 的程序以外的组件程序。
+func (mp *xdpMultiprog) without(id ebpf.ProgramID) []*xdpMultiprogProg {
+	var progs []*xdpMultiprogProg
+	for _, p := range mp.progs {
+		if p.id != id {
+			progs = append(progs, p)
+		}
+	}
+	return progs
+}
+
+// update 以 progs 生成新的分发程序，替换网卡上的分发程序，progs 为空时卸载分发程序。
+// progs 中 prog 为 nil 的程序通过 load 载入。网卡上已有分发程序时沿用其挂载模式，xdpFlags 指定了其他模式时返回 EBUSY；
+// 否则 xdpFlags 为 XDP_MODE_AUTO 时先尝试驱动模式，失败时退回通用模式。需要在 xdpLockAcquire 的锁中调用。
+func (mp *xdpMultiprog) update(progs []*xdpMultiprogProg, xdpFlags link.XDPAttachFlags) error {
+	var config xdpDispatcherConfig
+	var dispatcher *ebpf.Program
+	var links []link.Link
+	var loaded []*xdpMultiprogProg
+	var modes []link.XDPAttachFlags
+	var attachErr error
+	var oldDir, dir string
+	var err error
+
+	wantMode := xdpFlags & xskXdpModeMask
+	if mp.dispatcher != nil && wantMode != XDP_MODE_AUTO && mp.mode&wantMode == 0 {
+		return fmt.Errorf("%s 上分发程序的模式 %s 与请求的 %s 不一致: %w",
+			mp.ifname, xskXdpModeString(mp.mode), xskXdpModeString(wantMode), unix.EBUSY)
+	}
+	if len(progs) > MAX_DISPATCHER_ACTIONS {
+		return fmt.Errorf("%s 上的分发程序最多运行 %d 个程序: %w", mp.ifname, MAX_DISPATCHER_ACTIONS, unix.E2BIG)
+	}
+	if mp.dispatcher != nil {
+		info, err := mp.dispatcher.Info()
+		if err != nil {
+			return err
+		}
+		id, _ := info.ID()
+		oldDir, err = xdpDispatcherDir(mp.ifindex, id)
+		if err != nil {
+			return err
+		}
+	}
+	if len(progs) == 0 {
+		if mp.dispatcher == nil {
+			return nil
+		}
+		err = xdpSetLinkXdpFd(mp.ifindex, -1, mp.mode, mp.dispatcher)
+		if err != nil {
+			return err
+		}
+		os.RemoveAll(oldDir)
+		mp.Close()
+		return nil
+	}
+
+	progs = append([]*xdpMultiprogProg(nil), progs...)
+	sort.SliceStable(progs, func(i, j int) bool {
+		if progs[i].runConfig.Priority != progs[j].runConfig.Priority {
+			return progs[i].runConfig.Priority < progs[j].runConfig.Priority
+		}
+		return progs[i].name < progs[j].name
+	})
+	config.Magic = XDP_DISPATCHER_MAGIC
+	config.DispatcherVersion = XDP_DISPATCHER_VERSION
+	config.NumProgsEnabled = uint8(len(progs))
+	config.IsXdpFrags = 1
+	for i, p := range progs {
+		config.ChainCallActions[i] = p.runConfig.ChainCallActions | (1 << XDP_DISPATCHER_RETVAL)
+		config.RunPrios[i] = p.runConfig.Priority
+		config.ProgramFlags[i] = p.flags
+		// 所有程序都支持分片时分发程序才支持分片
+		if p.flags&unix.BPF_F_XDP_HAS_FRAGS == 0 {
+			config.IsXdpFrags = 0
+		}
+	}
+	dispatcher, err = xdpLoadDispatcher(&config)
+	if err != nil {
+		return err
+	}
+
+	// 新程序以 freplace 程序载入，已有的程序重新挂载到新的分发程序上，旧的分发程序仍然保持运行
+	for i, p := range progs {
+		var l link.Link
+		attachTo := fmt.Sprintf("prog%d", i)
+		if p.prog == nil {
+			var prog *ebpf.Program
+			prog, err = p.load(dispatcher, attachTo, config.IsXdpFrags != 0)
+			if err == nil {
+				err = p.setProg(prog)
+				if err != nil {
+					prog.Close()
+				}
+			}
+			if err != nil {
+				goto out
+			}
+			loaded = append(loaded, p)
+			l, err = link.AttachFreplace(nil, "", p.prog)
+		} else {
+			l, err = link.AttachFreplace(dispatcher, attachTo, p.prog)
+		}
+		if err != nil {
+			err = fmt.Errorf("把 %s 挂载到分发程序的 %s 失败: %w", p.name, attachTo, err)
+			goto out
+		}
+		links = append(links, l)
+	}
+
+	if mp.dispatcher != nil {
+		modes = []link.XDPAttachFlags{mp.mode}
+	} else if wantMode == XDP_MODE_AUTO {
+		modes = []link.XDPAttachFlags{xdpFlags | link.XDPDriverMode, xdpFlags | link.XDPGenericMode}
+	} else {
+		modes = []link.XDPAttachFlags{xdpFlags}
+	}
+	for _, mode := range modes {
+		err = xdpSetLinkXdpFd(mp.ifindex, dispatcher.FD(), mode, mp.dispatcher)
+		if err == nil {
+			mp.mode = mode & xskXdpModeMask
+			break
+		}
+		attachErr = errors.Join(attachErr, fmt.Errorf("以 %s 模式挂载分发程序失败: %w", xskXdpModeString(mode), err))
+	}
+	if err != nil {
+		err = fmt.Errorf("%s: %w", mp.ifname, attachErr)
+		goto out
+	}
+
+	dir, err = xdpMultiprogPin(mp.ifindex, dispatcher, progs, links)
+	if err != nil {
+		// 恢复网卡上原来的程序
+		if mp.dispatcher != nil {
+			xdpSetLinkXdpFd(mp.ifindex, mp.dispatcher.FD(), mp.mode, dispatcher)
+		} else {
+			xdpSetLinkXdpFd(mp.ifindex, -1, mp.mode, dispatcher)
+		}
+		os.RemoveAll(dir)
+		goto out
+	}
+	if oldDir != "" {
+		os.RemoveAll(oldDir)
+	}
+	for _, p := range mp.progs {
+		if !slices.Contains(progs, p) {
+			p.prog.Close()
+		}
+	}
+	mp.dispatcher.Close()
+	mp.dispatcher = dispatcher
+	mp.progs = progs
+	dispatcher = nil
+	loaded = nil
+
+out:
+	// link 已经固定在 bpffs 中，或者挂载失败需要解除
+	for _, l := range links {
+		l.Close()
+	}
+	for _, p := range loaded {
+		p.prog.Close()
+		p.prog = nil
+	}
+	dispatcher.Close()
+	return err
+}
+
+// xdpMultiprogPin 把组件程序及其 link 固定到分发程序的状态目录中，返回目录。
+func xdpMultiprogPin(ifindex int, dispatcher *ebpf.Program, progs []*xdpMultiprogProg, links []link.Link) (string, error) {
+	info, err := dispatcher.Info()
+	if err != nil {
+		return "", err
+	}
+	id, _ := info.ID()
+	dir, err := xdpDispatcherDir(ifindex, id)
+	if err != nil {
+		return "", err
+	}
+	err = os.Mkdir(dir, unix.S_IRWXU)
+	if err != nil {
+		return "", err
+	}
+	for i, p := range progs {
+		err = links[i].Pin(fmt.Sprintf("%s/prog%d-link", dir, i))
+		if err != nil {
+			return dir, err
+		}
+		// 从旧目录载入的程序已经固定，Pin 会移动原来的文件，这里固定一个副本
+		prog, err := p.prog.Clone()
+		if err != nil {
+			return dir, err
+		}
+		err = prog.Pin(fmt.Sprintf("%s/prog%d-prog", dir, i))
+		prog.Close()
+		if err != nil {
+			return dir, err
+		}
+	}
+	return dir, nil
+}
+
+// Close 关闭 xdpMultiprog 持有的文件描述符，不会改变网卡上的程序。
+func (mp *xdpMultiprog) Close() {
+	for _, p := range mp.progs {
+		p.prog.Close()
+	}
+	mp.progs = nil
+	mp.dispatcher.Close()
+	mp.dispatcher = nil
+}
+
+// XdpProgramAttach 把 spec 中名为 progName 的程序加入 ifname 上的分发程序（相当于 libxdp 的 xdp_program__attach），
+// 网卡上没有程序时创建分发程序。程序以 freplace 程序载入，可以与 libxdp、xdp-loader 以及 XSK_LIBBPF_FLAGS__XDP_DISPATCHER
+// 载入的默认程序共存。config 为 nil 时使用 XDP_DEFAULT_RUN_PRIO 和 XDP_DEFAULT_CHAIN_CALL_ACTIONS。
+// xdpFlags 只在创建分发程序时生效，网卡上已有分发程序时必须为 XDP_MODE_AUTO 或与其相同的模式。
+// 返回载入的 Collection，可以通过它访问程序的 map；程序固定在 bpffs 中，关闭 Collection 不会卸载程序。
+func XdpProgramAttach(ifname string, spec *ebpf.CollectionSpec, progName string, config *XdpRunConfig, xdpFlags link.XDPAttachFlags) (*ebpf.Collection, error) {
+	progSpec, ok := spec.Programs[progName]
+	if !ok {
+		return nil, fmt.Errorf("CollectionSpec 中没有名为 %q 的程序: %w", progName, unix.ENOENT)
+	}
+	ifLink, err := xskLinkByName("find interface", ifname, 0)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := xdpLockAcquire()
+	if err != nil {
+		return nil, err
+	}
+	defer xdpLockRelease(lock)
+	mp, err := xdpMultiprogGet(ifLink.Attrs().Index)
+	if err != nil {
+		return nil, err
+	}
+	defer mp.Close()
+
+	var coll *ebpf.Collection
+	newProg := &xdpMultiprogProg{
+		runConfig: XdpRunConfig{Priority: XDP_DEFAULT_RUN_PRIO, ChainCallActions: XDP_DEFAULT_CHAIN_CALL_ACTIONS},
+		flags:     progSpec.Flags & unix.BPF_F_XDP_HAS_FRAGS,
+		load: func(dispatcher *ebpf.Program, attachTo string, frags bool) (*ebpf.Program, error) {
+			spec := spec.Copy()
+			xdpSetExtension(spec.Programs[progName], dispatcher, attachTo, frags)
+			var err error
+			coll, err = ebpf.NewCollection(spec)
+			if err != nil {
+				return nil, err
+			}
+			return coll.Programs[progName].Clone()
+		},
+	}
+	if config != nil {
+		newProg.runConfig = *config
+	}
+	err = mp.update(append(mp.progs, newProg), xdpFlags)
+	if err != nil {
+		if coll != nil {
+			coll.Close()
+		}
+		return nil, err
+	}
+	return coll, nil
+}
+
+// XdpProgramDetach 从 ifname 上的分发程序中移除 prog（相当于 libxdp 的 xdp_program__detach），
+// 移除最后一个程序时卸载分发程序。prog 不在分发程序中时返回 ENOENT。
+func XdpProgramDetach(ifname string, prog *ebpf.Program) error {
+	info, err := prog.Info()
+	if err != nil {
+		return err
+	}
+	id, _ := info.ID()
+	ifLink, err := xskLinkByName("find interface", ifname, 0)
+	if err != nil {
+		return err
+	}
+	lock, err := xdpLockAcquire()
+	if err != nil {
+		return err
+	}
+	defer xdpLockRelease(lock)
+	return xdpMultiprogDetach(ifLink.Attrs().Index, id)
+}
+
+// xdpMultiprogDetach 从网卡上的分发程序中移除 ID 为 id 的程序，需要在 xdpLockAcquire 的锁中调用。
+func xdpMultiprogDetach(ifindex int, id ebpf.ProgramID) error {
+	mp, err := xdpMultiprogGet(ifindex)
+	if err != nil {
+		return err
+	}
+	defer mp.Close()
+	progs := mp.without(id)
+	if len(progs) == len(mp.progs) {
+		return fmt.Errorf("%s 上的分发程序中没有程序 %d: %w", mp.ifname, id, unix.ENOENT)
+	}
+	return mp.update(progs, XDP_MODE_AUTO)
+}
+
+// xskSetupDispatcherXdpProg 是设置了 XSK_LIBBPF_FLAGS__XDP_DISPATCHER 时的 xskSetupXdpProg。
+// 默认程序与 libxdp 相同，以名为 xsk_def_prog 的组件加入网卡上的分发程序，优先级为 XSK_DEF_PROG_RUN_PRIO，
+// 返回 XDP_PASS（没有套接字的队列）时继续运行后续的程序。分发程序中已有该组件时共享它并增加引用计数。
+func xskSetupDispatcherXdpProg(xsk *XskSocket, xsksMap **ebpf.Map) error {
+	ctx := xsk.Ctx
+	logger := xskSocketLogger(xsk)
+	var mp *xdpMultiprog
+	var p *xdpMultiprogProg
+	var progs []*xdpMultiprogProg
+	var channel *EthtoolChannels
+	var refcnt int
+	var maxQueue uint32
+
+	lockFile, err := xdpLockAcquire()
+	if err != nil {
+		return err
+	}
+	mp, err = xdpMultiprogGet(ctx.Ifindex)
+	if err != nil {
+		goto unlock
+	}
+	progs = mp.progs
+	if p = mp.find("xsk_def_prog"); p != nil {
+		ctx.RefcntMap, err = xskLookupRefcntMap(p.prog)
+		if err == nil && ctx.RefcntMap == nil {
+			err = fmt.Errorf("%s 上分发程序中的 xsk_def_prog 没有引用计数: %w", ctx.Ifname, unix.EBUSY)
+		}
+		if err != nil {
+			goto err_close
+		}
+		// 共享的程序必须附加了相同的处理
+		err = xskCheckProgFeatures(xsk, ctx.RefcntMap)
+		if wantMode := xsk.Config.XdpFlags & xskXdpModeMask; err == nil && wantMode != XDP_MODE_AUTO && mp.mode&wantMode == 0 {
+			err = fmt.Errorf("%s 上分发程序的模式 %s 与请求的 %s 不一致: %w",
+				ctx.Ifname, xskXdpModeString(mp.mode), xskXdpModeString(wantMode), unix.EBUSY)
+		}
+		if err != nil {
+			goto err_close
+		}
+		refcnt, err = xskUpdateProgRefcntLocked(ctx.RefcntMap, 1)
+		if err != nil {
+			goto err_close
+		}
+		logger.Debug("xdp prog refcount changed", "dispatcher", true, "refcnt", refcnt)
+		if refcnt == 0 {
+			// 程序等待卸载（上次释放没有完成），用新的程序替换它
+			ctx.RefcntMap.Close()
+			ctx.RefcntMap = nil
+			progs = mp.without(p.id)
+			p = nil
+		}
+	}
+
+	if p == nil {
+		// 获取最大RX队列
+		channel, err = GetEthChannels(ctx.Ifname)
+		if err != nil {
+			goto err_close
+		}
+		maxQueue = channel.MaxRX
+		if maxQueue == 0 {
+			maxQueue = channel.MaxCombined
+		}
+		p = &xdpMultiprogProg{
+			runConfig: XdpRunConfig{Priority: XSK_DEF_PROG_RUN_PRIO, ChainCallActions: 1 << XDP_PASS},
+			load: func(dispatcher *ebpf.Program, attachTo string, frags bool) (*ebpf.Program, error) {
+				return xskLoadDispatcherXdpProg(xsk, maxQueue, dispatcher, attachTo, frags)
+			},
+		}
+		if xsk.Config.BindFlags&unix.XDP_USE_SG != 0 {
+			p.flags = unix.BPF_F_XDP_HAS_FRAGS
+		}
+		err = mp.update(append(progs, p), xsk.Config.XdpFlags)
+		if err != nil {
+			goto err_close
+		}
+		logger.Info("xdp prog attached", "dispatcher", true, "prog_id", p.id, "mode", xskXdpModeString(mp.mode))
+		ctx.RefcntMap, err = xskLookupRefcntMap(p.prog)
+		if err == nil && ctx.RefcntMap == nil {
+			err = unix.ENOENT
+		}
+		if err != nil {
+			goto err_detach
+		}
+	}
+
+	ctx.XdpProg, err = p.prog.Clone()
+	if err != nil {
+		goto err_detach
+	}
+	ctx.XsksMap, err = xskLookupBPFMap(ctx.XdpProg)
+	if err == nil && ctx.XsksMap == nil {
+		err = unix.ENOENT
+	}
+	if err != nil {
+		goto err_detach
+	}
+	if xsk.Rx != nil {
+		err = xskRegisterSocketLocked(xsk)
+		if err != nil {
+			goto err_detach
+		}
+	}
+	if xsksMap != nil {
+		*xsksMap, _ = ctx.XsksMap.Clone()
+	}
+	mp.Close()
+	xdpLockRelease(lockFile)
+	return nil
+
+err_detach:
+	// 撤销本次的引用，最后一个引用时从分发程序中移除默认程序
+	if ctx.RefcntMap != nil {
+		if refcnt, _ = xskUpdateProgRefcntLocked(ctx.RefcntMap, -1); refcnt == 0 {
+			if uerr := mp.update(mp.without(p.id), XDP_MODE_AUTO); uerr != nil {
+				logger.Warn("detach xdp prog from dispatcher failed", "prog_id", p.id, "err", uerr)
+			} else {
+				logger.Info("xdp prog detached", "dispatcher", true, "prog_id", p.id)
+			}
+		}
+	}
+	if ctx.XsksMap != nil {
+		ctx.XsksMap.Close()
+		ctx.XsksMap = nil
+	}
+	ctx.XdpProg.Close()
+	ctx.XdpProg = nil
+err_close:
+	if ctx.RefcntMap != nil {
+		ctx.RefcntMap.Close()
+		ctx.RefcntMap = nil
+	}
+	mp.Close()
+unlock:
+	xdpLockRelease(lockFile)
+	return err
+}
+
+// xskLoadDispatcherXdpProg 以 freplace 程序载入默认程序，替换 dispatcher 中的 attachTo 函数。
+// freplace 程序不能绑定设备，设置 XSK_LIBBPF_FLAGS__RX_METADATA 时元数据不可用。
+func xskLoadDispatcherXdpProg(xsk *XskSocket, maxQueue uint32, dispatcher *ebpf.Program, attachTo string, frags bool) (*ebpf.Program, error) {
+	var progSpec *ebpf.ProgramSpec
+	var spec *ebpf.CollectionSpec
+	var coll *ebpf.Collection
+	var err error
+	if features := xskProgFeatures(xsk.Config.LibbpfFlags); features != 0 {
+		maps, err := xskCreateFeatureMaps(maxQueue, features)
+		if err != nil {
+			return nil, err
+		}
+		defer maps.Close()
+		progSpec, err = xskBuildXdpProg(maps, features)
+		if err != nil {
+			return nil, err
+		}
+		progSpec.Instructions = xskPatchKfuncs(progSpec.Instructions, false)
+		xdpSetExtension(progSpec, dispatcher, attachTo, frags)
+		return ebpf.NewProgram(progSpec)
+	}
+	spec, err = xskLoadDefXdpProg()
+	if err != nil {
+		return nil, err
+	}
+	if mapSpec, ok := spec.Maps["xsks_map"]; ok {
+		mapSpec.MaxEntries = maxQueue
+	}
+	progSpec, ok := spec.Programs["xsk_def_prog"]
+	if !ok {
+		return nil, unix.ENOENT
+	}
+	xdpSetExtension(progSpec, dispatcher, attachTo, frags)
+	coll, err = ebpf.NewCollection(spec)
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	return coll.Programs["xsk_def_prog"].Clone()
+}
+
+// xskReleaseDispatcherXdpProg 减少分发程序中默认程序的引用计数，减为 0 时在同一个锁中把它从分发程序中移除。
+func xskReleaseDispatcherXdpProg(xsk *XskSocket) {
+	ctx := xsk.Ctx
+	logger := xskSocketLogger(xsk)
+	lockFile, err := xdpLockAcquire()
+	if err != nil {
+		logger.Warn("acquire xdp lock failed, xdp prog refcount not decreased", "err", err)
+		return
+	}
+	defer xdpLockRelease(lockFile)
+	value, err := xskUpdateProgRefcntLocked(ctx.RefcntMap, -1)
+	if err != nil {
+		logger.Warn("decrease xdp prog refcount failed", "dispatcher", true, "err", err)
+		return
+	}
+	logger.Debug("xdp prog refcount changed", "dispatcher", true, "refcnt", value)
+	if value != 0 {
+		return
+	}
+	info, err := ctx.XdpProg.Info()
+	if err != nil {
+		logger.Warn("get xdp prog info failed, xdp prog not detached", "err", err)
+		return
+	}
+	id, _ := info.ID()
+	if err = xdpMultiprogDetach(ctx.Ifindex, id); err != nil {
+		logger.Warn("detach xdp prog from dispatcher failed", "prog_id", id, "err", err)
+		return
+	}
+	logger.Info("xdp prog detached", "dispatcher", true, "prog_id", id)
+}
@@ -0,0 +1,102 @@
+package xsk
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+)
+
+func TestXdpDispatcher(t *testing.T) {
+	tests := []struct {
+		numProgs int
+		chain    uint32
+		want     uint32
+	}{
+		// 没有程序时返回 XDP_PASS
+		{0, 0, XDP_PASS},
+		// 空函数返回 XDP_DISPATCHER_RETVAL，在 chain_call_actions 中时继续运行
+		{MAX_DISPATCHER_ACTIONS, 1 << XDP_DISPATCHER_RETVAL, XDP_PASS},
+		// 不在 chain_call_actions 中时直接返回
+		{1, 1 << XDP_PASS, XDP_DISPATCHER_RETVAL},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d_progs_chain_%#x", test.numProgs, test.chain), func(t *testing.T) {
+			config := xdpDispatcherConfig{
+				Magic:             XDP_DISPATCHER_MAGIC,
+				DispatcherVersion: XDP_DISPATCHER_VERSION,
+				NumProgsEnabled:   uint8(test.numProgs),
+			}
+			for i := 0; i < test.numProgs; i++ {
+				config.ChainCallActions[i] = test.chain
+				config.RunPrios[i] = uint32(i)
+			}
+			prog, err := xdpLoadDispatcher(&config)
+			if err != nil {
+				t.Fatalf("xdpLoadDispatcher failed: %v", err)
+			}
+			defer prog.Close()
+			ret, err := prog.Run(&ebpf.RunOptions{Data: make([]byte, 64)})
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			if ret != test.want {
+				t.Errorf("%d programs with chain %#x: expected %d, got %d", test.numProgs, test.chain, test.want, ret)
+			}
+			got, ok, err := xdpDispatcherGetConfig(prog)
+			if err != nil || !ok {
+				t.Fatalf("xdpDispatcherGetConfig failed: %v %v", ok, err)
+			}
+			if *got != config {
+				t.Errorf("Expected config %+v, got %+v", config, *got)
+			}
+		})
+	}
+}
+
+func TestXdpProgramAttach(t *testing.T) {
+	spec, err := xskLoadDefXdpProg()
+	if err != nil {
+		t.Fatalf("Failed to load spec: %v", err)
+	}
+	coll, err := XdpProgramAttach("lo", spec, "xsk_def_prog", &XdpRunConfig{Priority: 10, ChainCallActions: 1 << XDP_PASS}, XDP_MODE_AUTO)
+	if errors.Is(err, unix.EPERM) {
+		t.Skipf("freplace programs are not permitted: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("XdpProgramAttach failed: %v", err)
+	}
+	defer coll.Close()
+	other, err := XdpProgramAttach("lo", spec, "xsk_def_prog", nil, XDP_MODE_AUTO)
+	if err != nil {
+		XdpProgramDetach("lo", coll.Programs["xsk_def_prog"])
+		t.Fatalf("XdpProgramAttach failed: %v", err)
+	}
+	defer other.Close()
+
+	lock, err := xdpLockAcquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp, err := xdpMultiprogGet(1)
+	xdpLockRelease(lock)
+	if err != nil {
+		t.Fatalf("xdpMultiprogGet failed: %v", err)
+	}
+	if len(mp.progs) != 2 || mp.progs[0].runConfig.Priority != 10 || mp.progs[1].runConfig.Priority != XDP_DEFAULT_RUN_PRIO {
+		t.Errorf("Unexpected programs in dispatcher: %+v", mp.progs)
+	}
+	mp.Close()
+
+	if err := XdpProgramDetach("lo", coll.Programs["xsk_def_prog"]); err != nil {
+		t.Errorf("XdpProgramDetach failed: %v", err)
+	}
+	if err := XdpProgramDetach("lo", coll.Programs["xsk_def_prog"]); !errors.Is(err, unix.ENOENT) {
+		t.Errorf("Expected ENOENT, got %v", err)
+	}
+	if err := XdpProgramDetach("lo", other.Programs["xsk_def_prog"]); err != nil {
+		t.Errorf("XdpProgramDetach failed: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package xsk
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// 创建套接字失败的原因，通过 errors.Is 判断，底层的 errno 仍然可以直接判断（如 errors.Is(err, unix.EBUSY)）
+var (
+	// ErrQueueBusy 队列上已经绑定了其他套接字，或网卡上已挂载了不兼容的 XDP 程序（EBUSY）
+	ErrQueueBusy = errors.New("queue is busy")
+	// ErrPermission 缺少 CAP_NET_RAW、CAP_BPF 等权限（EPERM、EACCES）
+	ErrPermission = errors.New("operation not permitted")
+	// ErrNoMemory 内存不足，注册 umem 时通常是超过了 RLIMIT_MEMLOCK（ENOMEM、ENOBUFS）
+	ErrNoMemory = errors.New("out of memory")
+	// ErrNoDevice 网卡不存在或已被移除（ENODEV、ENXIO）
+	ErrNoDevice = errors.New("no such device")
+)
+
+// XskError 为注册 umem、映射环、绑定、挂载 XDP 程序和写入 xskmap 失败时返回的错误，Err 为底层的错误（通常是 unix.Errno）。
+// 除了 Err 本身，还可以通过 errors.Is 判断 ErrQueueBusy、ErrPermission、ErrNoMemory、ErrNoDevice，
+// 驱动不支持零拷贝时 Op 为 "bind"，Err 包含 ErrZeroCopyNotSupported。
+type XskError struct {
+	Op     string // 失败的操作，如 "umem reg"、"mmap fill ring"、"bind"、"attach prog"、"update xskmap"、"find interface"
+	Ifname string // 网卡名，与网卡无关的操作（创建 umem）为空
+	Queue  uint32 // 队列号，Ifname 为空时无意义
+	Err    error
+}
+
+func (e *XskError) Error() string {
+	if e.Ifname == "" {
+		return fmt.Sprintf("xsk %s: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("xsk %s %s queue %d: %v", e.Op, e.Ifname, e.Queue, e.Err)
+}
+
+func (e *XskError) Unwrap() error {
+	return e.Err
+}
+
+// Is 把底层的 errno 归类到 ErrQueueBusy 等错误。
+func (e *XskError) Is(target error) bool {
+	switch target {
+	case ErrQueueBusy:
+		return errors.Is(e.Err, unix.EBUSY)
+	case ErrPermission:
+		return errors.Is(e.Err, unix.EPERM) || errors.Is(e.Err, unix.EACCES)
+	case ErrNoMemory:
+		return errors.Is(e.Err, unix.ENOMEM) || errors.Is(e.Err, unix.ENOBUFS)
+	case ErrNoDevice:
+		return errors.Is(e.Err, unix.ENODEV) || errors.Is(e.Err, unix.ENXIO)
+	}
+	return false
+}
+
+// xskError 返回 ifname 队列 queueId 上 op 失败的 *XskError，err 中已经有 *XskError 时原样返回。
+func xskError(op string, ifname string, queueId uint32, err error) error {
+	var xskErr *XskError
+	if errors.As(err, &xskErr) {
+		return err
+	}
+	return &XskError{Op: op, Ifname: ifname, Queue: queueId, Err: err}
+}
+
+// xskLinkByName 查找网卡 ifname，失败时返回 op 的 *XskError，网卡不存在时 Err 包含 ENODEV，可以通过 errors.Is 判断 ErrNoDevice。
+func xskLinkByName(op string, ifname string, queueId uint32) (netlink.Link, error) {
+	ifLink, err := netlink.LinkByName(ifname)
+	if err != nil {
+		if errors.As(err, new(netlink.LinkNotFoundError)) {
+			err = fmt.Errorf("%w: %w", unix.ENODEV, err)
+		}
+		return nil, xskError(op, ifname, queueId, err)
+	}
+	return ifLink, nil
+}
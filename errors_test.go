@@ -0,0 +1,124 @@
+package xsk
+
+import (
+	"errors"
+	"testing"
+	"unsafe"
+
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+)
+
+func TestXskErrorIs(t *testing.T) {
+	for _, tt := range []struct {
+		errno  unix.Errno
+		target error
+	}{
+		{unix.EBUSY, ErrQueueBusy},
+		{unix.EPERM, ErrPermission},
+		{unix.EACCES, ErrPermission},
+		{unix.ENOMEM, ErrNoMemory},
+		{unix.ENOBUFS, ErrNoMemory},
+		{unix.ENODEV, ErrNoDevice},
+		{unix.ENXIO, ErrNoDevice},
+	} {
+		err := xskError("bind", "eth0", 1, tt.errno)
+		if !errors.Is(err, tt.target) || !errors.Is(err, tt.errno) {
+			t.Errorf("Expected %v to be %v", err, tt.target)
+		}
+		if errors.Is(err, ErrZeroCopyNotSupported) {
+			t.Errorf("Expected %v not to be ErrZeroCopyNotSupported", err)
+		}
+	}
+	if err := xskError("bind", "eth0", 1, unix.EINVAL); errors.Is(err, ErrQueueBusy) || errors.Is(err, ErrPermission) {
+		t.Errorf("Unexpected classification of %v", err)
+	}
+
+	// 已经是 *XskError 时不再包装
+	inner := xskError("update xskmap", "eth0", 1, unix.EPERM)
+	if err := xskError("attach prog", "eth0", 1, inner); err != inner {
+		t.Errorf("Expected %v, got %v", inner, err)
+	}
+	if got := inner.Error(); got != "xsk update xskmap eth0 queue 1: operation not permitted" {
+		t.Errorf("Unexpected message %q", got)
+	}
+	if got := xskError("umem reg", "", 0, unix.EINVAL).Error(); got != "xsk umem reg: invalid argument" {
+		t.Errorf("Unexpected message %q", got)
+	}
+}
+
+func TestXskErrorUmemReg(t *testing.T) {
+	umemArea, err := AnonUmemAllocator{}.Alloc(16 * 4096)
+	if err != nil {
+		t.Fatalf("Alloc failed: %v", err)
+	}
+	defer AnonUmemAllocator{}.Free(umemArea)
+
+	// 对齐模式下帧大小必须是 2 的幂
+	_, err = XskUmemCreate(unsafe.Pointer(&umemArea[0]), uint64(len(umemArea)), &XskRingProd{}, &XskRingCons{},
+		&XskUmemConfig{FillSize: 16, CompSize: 16, FrameSize: 3000})
+	var xskErr *XskError
+	if !errors.As(err, &xskErr) || xskErr.Op != "umem reg" || xskErr.Ifname != "" {
+		t.Fatalf("Expected umem reg XskError, got %v", err)
+	}
+	if !errors.Is(err, unix.EINVAL) {
+		t.Errorf("Expected EINVAL, got %v", err)
+	}
+}
+
+func TestXskErrorBind(t *testing.T) {
+	umemArea, err := AnonUmemAllocator{}.Alloc(16 * 4096)
+	if err != nil {
+		t.Fatalf("Alloc failed: %v", err)
+	}
+	defer AnonUmemAllocator{}.Free(umemArea)
+	var fill, tx XskRingProd
+	var comp, rx XskRingCons
+	umem, err := XskUmemCreate(unsafe.Pointer(&umemArea[0]), uint64(len(umemArea)), &fill, &comp,
+		&XskUmemConfig{FillSize: 16, CompSize: 16, FrameSize: 4096})
+	if err != nil {
+		t.Fatalf("XskUmemCreate failed: %v", err)
+	}
+	defer XskUmemDelete(umem)
+
+	// lo 只有一个队列
+	_, err = XskSocketCreate("lo", 100, umem, &rx, &tx, &XskSocketConfig{
+		RxSize: 16, TxSize: 16, LibbpfFlags: XSK_LIBBPF_FLAGS__INHIBIT_PROG_LOAD})
+	var xskErr *XskError
+	if !errors.As(err, &xskErr) || xskErr.Op != "bind" || xskErr.Ifname != "lo" || xskErr.Queue != 100 {
+		t.Fatalf("Expected bind XskError on lo queue 100, got %v", err)
+	}
+	if !errors.Is(err, unix.EINVAL) {
+		t.Errorf("Expected EINVAL, got %v", err)
+	}
+}
+
+func TestXskErrorNoDevice(t *testing.T) {
+	umemArea, err := AnonUmemAllocator{}.Alloc(16 * 4096)
+	if err != nil {
+		t.Fatalf("Alloc failed: %v", err)
+	}
+	defer AnonUmemAllocator{}.Free(umemArea)
+	var fill, tx XskRingProd
+	var comp, rx XskRingCons
+	umem, err := XskUmemCreate(unsafe.Pointer(&umemArea[0]), uint64(len(umemArea)), &fill, &comp,
+		&XskUmemConfig{FillSize: 16, CompSize: 16, FrameSize: 4096})
+	if err != nil {
+		t.Fatalf("XskUmemCreate failed: %v", err)
+	}
+	defer XskUmemDelete(umem)
+
+	_, err = XskSocketCreate("xsknodev0", 1, umem, &rx, &tx, &XskSocketConfig{
+		RxSize: 16, TxSize: 16, LibbpfFlags: XSK_LIBBPF_FLAGS__INHIBIT_PROG_LOAD})
+	var xskErr *XskError
+	if !errors.As(err, &xskErr) || xskErr.Op != "find interface" || xskErr.Ifname != "xsknodev0" || xskErr.Queue != 1 {
+		t.Fatalf("Expected find interface XskError on xsknodev0 queue 1, got %v", err)
+	}
+	if !errors.Is(err, ErrNoDevice) || !errors.Is(err, unix.ENODEV) {
+		t.Errorf("Expected ErrNoDevice, got %v", err)
+	}
+	spec := &ebpf.CollectionSpec{Programs: map[string]*ebpf.ProgramSpec{"prog": {}}}
+	if _, err := XdpProgramAttach("xsknodev0", spec, "prog", nil, XDP_MODE_AUTO); !errors.Is(err, ErrNoDevice) {
+		t.Errorf("Expected ErrNoDevice, got %v", err)
+	}
+}
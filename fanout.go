@@ -0,0 +1,310 @@
+package xsk
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+)
+
+// 设置 XSK_LIBBPF_FLAGS__FANOUT 时，默认程序把一个队列的数据包分散到该队列上的多个套接字（共享 umem），
+// 选择套接字由 xdp/xsk_features.h 中的 xsk_fanout_select 实现。
+//
+// 每个队列有 XSK_FANOUT_MAX_SOCKETS 个槽位，xsks_map 的键为 queue * XSK_FANOUT_MAX_SOCKETS + slot。
+// 套接字创建时占用队列中最小的空闲槽位，删除时释放，conf->slots 保存正在使用的槽位。
+// 套接字数量变化时按哈希分配的流会重新分布；指向没有套接字的槽位的导向规则不生效，数据包按哈希分配。
+
+// XSK_FANOUT_MAX_SOCKETS 为每个队列最多的套接字数
+const XSK_FANOUT_MAX_SOCKETS = 64
+
+// XSK_FANOUT_MAX_STEERING 为所有队列的导向规则总数的上限
+const XSK_FANOUT_MAX_STEERING = 4096
+
+// 分发使用的 map 名称
+const (
+	xskFanoutMapConfig = "xsk_fanout"
+	xskFanoutMapSteer  = "xsk_fan_steer"
+)
+
+/*
+	struct xsk_fanout_config {
+		__u32 num;
+		__u8 slots[XSK_FANOUT_MAX_SOCKETS];
+	};
+*/
+type xskFanoutConfig struct {
+	Num   uint32
+	Slots [XSK_FANOUT_MAX_SOCKETS]uint8
+}
+
+/*
+	struct xsk_fanout_steer_key {
+		__u32 queue;
+		__be16 dport;
+		__u16 pad;
+	};
+*/
+type xskFanoutSteerKey struct {
+	Queue uint32
+	Port  uint16
+	Pad   uint16
+}
+
+// xskFanoutMaps 是分发使用的 map。
+type xskFanoutMaps struct {
+	config *ebpf.Map
+	steer  *ebpf.Map
+}
+
+// xskCreateFanoutMaps 创建分发使用的 map，初始时所有队列都没有套接字。
+func xskCreateFanoutMaps(maxQueue uint32) (*xskFanoutMaps, error) {
+	config, err := ebpf.NewMap(&ebpf.MapSpec{
+		Name:       xskFanoutMapConfig,
+		Type:       ebpf.Array,
+		KeySize:    4,
+		ValueSize:  4 + XSK_FANOUT_MAX_SOCKETS,
+		MaxEntries: maxQueue,
+	})
+	if err != nil {
+		return nil, err
+	}
+	steer, err := ebpf.NewMap(&ebpf.MapSpec{
+		Name:       xskFanoutMapSteer,
+		Type:       ebpf.Hash,
+		KeySize:    8,
+		ValueSize:  4,
+		MaxEntries: XSK_FANOUT_MAX_STEERING,
+	})
+	if err != nil {
+		config.Close()
+		return nil, err
+	}
+	return &xskFanoutMaps{config: config, steer: steer}, nil
+}
+
+// xskLookupFanoutMaps 查找 prog 使用的分发 map，prog 没有设置 XSK_LIBBPF_FLAGS__FANOUT 时返回 ENOENT。
+func xskLookupFanoutMaps(prog *ebpf.Program) (*xskFanoutMaps, error) {
+	maps := &xskFanoutMaps{}
+	for _, entry := range []struct {
+		name string
+		m    **ebpf.Map
+	}{{xskFanoutMapConfig, &maps.config}, {xskFanoutMapSteer, &maps.steer}} {
+		m, err := xskLookupMap(prog, func(mapInfo *ebpf.MapInfo) bool {
+			return mapInfo.Name == entry.name
+		})
+		if err == nil && m == nil {
+			err = fmt.Errorf("XDP 程序中没有分发的 map %s: %w", entry.name, unix.ENOENT)
+		}
+		if err != nil {
+			maps.Close()
+			return nil, err
+		}
+		*entry.m = m
+	}
+	return maps, nil
+}
+
+// Close 关闭 map 的文件描述符。
+func (maps *xskFanoutMaps) Close() {
+	if maps.config != nil {
+		maps.config.Close()
+		maps.config = nil
+	}
+	if maps.steer != nil {
+		maps.steer.Close()
+		maps.steer = nil
+	}
+}
+
+// xskFanoutSocket 记录套接字在队列中占用的槽位。
+type xskFanoutSocket struct {
+	config *ebpf.Map
+	slot   uint32
+}
+
+// xskRegisterSocket 把套接字写入默认程序的 xsks_map，设置了 XSK_LIBBPF_FLAGS__FANOUT 时在 xdpLockAcquire 的锁中分配槽位。
+func xskRegisterSocket(xsk *XskSocket) error {
+	if xsk.Config.LibbpfFlags&XSK_LIBBPF_FLAGS__FANOUT == 0 {
+		return xskRegisterSocketLocked(xsk)
+	}
+	lockFile, err := xdpLockAcquire()
+	if err != nil {
+		return err
+	}
+	defer xdpLockRelease(lockFile)
+	return xskRegisterSocketLocked(xsk)
+}
+
+// xskRegisterSocketLocked 与 xskRegisterSocket 相同，调用者已经持有 xdpLockAcquire 的锁。
+func xskRegisterSocketLocked(xsk *XskSocket) error {
+	ctx := xsk.Ctx
+	if xsk.Config.LibbpfFlags&XSK_LIBBPF_FLAGS__FANOUT == 0 {
+		if err := ctx.XsksMap.Update(ctx.QueueId, int32(xsk.Fd), ebpf.UpdateAny); err != nil {
+			return xskError("update xskmap", ctx.Ifname, ctx.QueueId, err)
+		}
+		return nil
+	}
+	maps, err := xskLookupFanoutMaps(ctx.XdpProg)
+	if err != nil {
+		return err
+	}
+	defer maps.Close()
+	var config xskFanoutConfig
+	if err = maps.config.Lookup(ctx.QueueId, &config); err != nil {
+		return err
+	}
+	if config.Num > XSK_FANOUT_MAX_SOCKETS {
+		return fmt.Errorf("%s 队列 %d 的分发配置无效: %w", ctx.Ifname, ctx.QueueId, unix.EINVAL)
+	}
+	var used [XSK_FANOUT_MAX_SOCKETS]bool
+	for _, slot := range config.Slots[:config.Num] {
+		used[slot] = true
+	}
+	slot := uint32(0)
+	for slot < XSK_FANOUT_MAX_SOCKETS && used[slot] {
+		slot++
+	}
+	if slot == XSK_FANOUT_MAX_SOCKETS {
+		return fmt.Errorf("%s 队列 %d 已有 %d 个套接字: %w", ctx.Ifname, ctx.QueueId, XSK_FANOUT_MAX_SOCKETS, unix.ENOSPC)
+	}
+	// 先写入 xsks_map 再加入正在使用的槽位，程序不会选到没有套接字的槽位
+	if err = XskSocketUpdateXskmapKey(xsk, ctx.XsksMap, ctx.QueueId*XSK_FANOUT_MAX_SOCKETS+slot); err != nil {
+		return err
+	}
+	config.Slots[config.Num] = uint8(slot)
+	config.Num++
+	if err = maps.config.Update(ctx.QueueId, &config, ebpf.UpdateAny); err != nil {
+		xskDeleteXskmapEntries(xsk)
+		return err
+	}
+	xsk.fanout = &xskFanoutSocket{config: maps.config, slot: slot}
+	maps.config = nil
+	return nil
+}
+
+// xskUnregisterFanoutSocket 从队列正在使用的槽位中移除套接字，xsks_map 中的项由 xskDeleteXskmapEntries 删除。
+func xskUnregisterFanoutSocket(xsk *XskSocket) {
+	fanout := xsk.fanout
+	if fanout == nil {
+		return
+	}
+	xsk.fanout = nil
+	defer fanout.config.Close()
+	logger := xskSocketLogger(xsk)
+	lockFile, err := xdpLockAcquire()
+	if err != nil {
+		logger.Warn("acquire xdp lock failed, fanout slot not released", "slot", fanout.slot, "err", err)
+		return
+	}
+	defer xdpLockRelease(lockFile)
+	var config xskFanoutConfig
+	if err = fanout.config.Lookup(xsk.Ctx.QueueId, &config); err != nil || config.Num > XSK_FANOUT_MAX_SOCKETS {
+		logger.Warn("invalid fanout config, fanout slot not released", "slot", fanout.slot, "num", config.Num, "err", err)
+		return
+	}
+	for i, slot := range config.Slots[:config.Num] {
+		if uint32(slot) == fanout.slot {
+			config.Num--
+			config.Slots[i] = config.Slots[config.Num]
+			config.Slots[config.Num] = 0
+			if err = fanout.config.Update(xsk.Ctx.QueueId, &config, ebpf.UpdateAny); err != nil {
+				logger.Warn("release fanout slot failed", "slot", fanout.slot, "err", err)
+			}
+			return
+		}
+	}
+}
+
+// XskFanout 是 XSK_LIBBPF_FLAGS__FANOUT 程序中一个队列的分发表，修改立即对网卡上的程序生效。
+// 修改在 xdpLockAcquire 的锁中进行，可以由多个进程同时修改。
+type XskFanout struct {
+	queue uint32
+	maps  *xskFanoutMaps
+}
+
+// XskSocketGetFanout 返回套接字所在队列的分发表，套接字没有设置 XSK_LIBBPF_FLAGS__FANOUT 时返回 ENOENT。
+func XskSocketGetFanout(xsk *XskSocket) (*XskFanout, error) {
+	if xsk.Ctx.XdpProg == nil || xsk.Config.LibbpfFlags&XSK_LIBBPF_FLAGS__FANOUT == 0 {
+		return nil, fmt.Errorf("%s 队列 %d 的套接字没有载入分发程序: %w", xsk.Ctx.Ifname, xsk.Ctx.QueueId, unix.ENOENT)
+	}
+	maps, err := xskLookupFanoutMaps(xsk.Ctx.XdpProg)
+	if err != nil {
+		return nil, err
+	}
+	return &XskFanout{queue: xsk.Ctx.QueueId, maps: maps}, nil
+}
+
+// XskSocketFanoutSlot 返回套接字在队列中占用的槽位，用于 XskFanout.SetSteering。
+func XskSocketFanoutSlot(xsk *XskSocket) (uint32, error) {
+	if xsk.fanout == nil {
+		return 0, fmt.Errorf("%s 队列 %d 的套接字没有分发槽位: %w", xsk.Ctx.Ifname, xsk.Ctx.QueueId, unix.ENOENT)
+	}
+	return xsk.fanout.slot, nil
+}
+
+// Close 关闭分发表，不会改变分发配置。
+func (fanout *XskFanout) Close() {
+	fanout.maps.Close()
+}
+
+// Slots 返回队列中正在使用的槽位，按哈希分配时数据包在这些槽位的套接字之间分散。
+func (fanout *XskFanout) Slots() ([]uint32, error) {
+	var config xskFanoutConfig
+	if err := fanout.maps.config.Lookup(fanout.queue, &config); err != nil {
+		return nil, err
+	}
+	if config.Num > XSK_FANOUT_MAX_SOCKETS {
+		return nil, unix.EINVAL
+	}
+	slots := make([]uint32, 0, config.Num)
+	for _, slot := range config.Slots[:config.Num] {
+		slots = append(slots, uint32(slot))
+	}
+	return slots, nil
+}
+
+// SetSteering 把目的端口为 dport 的 TCP、UDP 和 SCTP 数据包导向 slot 上的套接字，slot 上没有套接字时数据包按哈希分配。
+func (fanout *XskFanout) SetSteering(dport uint16, slot uint32) error {
+	if slot >= XSK_FANOUT_MAX_SOCKETS {
+		return fmt.Errorf("无效的分发槽位 %d: %w", slot, unix.EINVAL)
+	}
+	lockFile, err := xdpLockAcquire()
+	if err != nil {
+		return err
+	}
+	defer xdpLockRelease(lockFile)
+	return fanout.maps.steer.Update(fanout.steerKey(dport), slot, ebpf.UpdateAny)
+}
+
+// DeleteSteering 删除目的端口为 dport 的导向规则，没有该规则时返回 ENOENT。
+func (fanout *XskFanout) DeleteSteering(dport uint16) error {
+	lockFile, err := xdpLockAcquire()
+	if err != nil {
+		return err
+	}
+	defer xdpLockRelease(lockFile)
+	err = fanout.maps.steer.Delete(fanout.steerKey(dport))
+	if err != nil {
+		return fmt.Errorf("删除端口 %d 的导向规则失败: %w", dport, err)
+	}
+	return nil
+}
+
+// Steering 返回队列的导向规则，键为目的端口，值为槽位。
+func (fanout *XskFanout) Steering() (map[uint16]uint32, error) {
+	var key xskFanoutSteerKey
+	var slot uint32
+	steering := make(map[uint16]uint32)
+	iter := fanout.maps.steer.Iterate()
+	for iter.Next(&key, &slot) {
+		if key.Queue == fanout.queue {
+			steering[uint16(xskBE16(key.Port))] = slot
+		}
+	}
+	return steering, iter.Err()
+}
+
+// steerKey 返回导向规则的键，端口以网络字节序保存，与程序从数据包中读出的值相同。
+func (fanout *XskFanout) steerKey(dport uint16) xskFanoutSteerKey {
+	return xskFanoutSteerKey{Queue: fanout.queue, Port: uint16(xskBE16(dport))}
+}
@@ -0,0 +1,111 @@
+package xsk
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+)
+
+func TestXskFanout(t *testing.T) {
+	maps, err := xskCreateFanoutMaps(1)
+	if err != nil {
+		t.Fatalf("Failed to create fanout maps: %v", err)
+	}
+	fanout := &XskFanout{queue: 0, maps: maps}
+	defer fanout.Close()
+	// 测试运行时无法向 XSKMAP 写入套接字，用普通的 map 代替 xsks_map，键存在即表示槽位上有套接字
+	xsks, err := ebpf.NewMap(&ebpf.MapSpec{Type: ebpf.Hash, KeySize: 4, ValueSize: 4, MaxEntries: XSK_FANOUT_MAX_SOCKETS})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer xsks.Close()
+
+	// 选中套接字时返回 xsks_map 的键
+	run := xskTestFeatureProg(t, "xsk_test_fanout", map[string]*ebpf.Map{
+		xskFanoutMapConfig: maps.config,
+		xskFanoutMapSteer:  maps.steer,
+		"xsks_map":         xsks,
+	})
+
+	v4 := netip.MustParseAddr
+	udp := func(sport, dport uint16) []byte {
+		return filterTestPacket(unix.ETH_P_IP, v4("10.0.0.1"), v4("10.0.0.2"), unix.IPPROTO_UDP, sport, dport)
+	}
+
+	// 没有套接字时交给内核
+	if ret := run(udp(1, 2)); ret != 0xffff {
+		t.Errorf("Expected pass without sockets, got %d", ret)
+	}
+
+	slots := []uint8{0, 2, 5}
+	config := xskFanoutConfig{Num: uint32(len(slots))}
+	copy(config.Slots[:], slots)
+	if err := maps.config.Update(uint32(0), &config, ebpf.UpdateAny); err != nil {
+		t.Fatal(err)
+	}
+	for _, slot := range slots {
+		if err := xsks.Update(uint32(slot), uint32(0), ebpf.UpdateAny); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := fanout.Slots(); err != nil || len(got) != len(slots) || got[1] != 2 {
+		t.Errorf("Slots returned %v, %v", got, err)
+	}
+
+	// 同一个流总是分配到同一个槽位，不同的流分散到所有槽位
+	hit := make(map[uint32]int)
+	for sport := uint16(1000); sport < 1064; sport++ {
+		ret := run(udp(sport, 80))
+		if ret != 0 && ret != 2 && ret != 5 {
+			t.Fatalf("sport %d: unexpected key %d", sport, ret)
+		}
+		if again := run(udp(sport, 80)); again != ret {
+			t.Errorf("sport %d: flow moved from %d to %d", sport, ret, again)
+		}
+		hit[ret]++
+	}
+	if len(hit) != len(slots) {
+		t.Errorf("Expected flows on all slots, got %v", hit)
+	}
+	ipv6 := filterTestPacket(unix.ETH_P_IPV6, v4("2001:db8::1"), v4("2001:db8::2"), unix.IPPROTO_TCP, 1, 2)
+	if ret := run(ipv6); ret != 0 && ret != 2 && ret != 5 {
+		t.Errorf("ipv6: unexpected key %d", ret)
+	}
+	// 非 IP 数据包的哈希为 0
+	if ret := run(filterTestPacket(unix.ETH_P_ARP, netip.Addr{}, netip.Addr{}, 0, 0, 0)); ret != 0 {
+		t.Errorf("arp: expected key 0, got %d", ret)
+	}
+
+	// 导向规则
+	if err := fanout.SetSteering(53, 5); err != nil {
+		t.Fatalf("SetSteering failed: %v", err)
+	}
+	if err := fanout.SetSteering(8080, 7); err != nil {
+		t.Fatalf("SetSteering failed: %v", err)
+	}
+	for sport := uint16(1000); sport < 1016; sport++ {
+		if ret := run(udp(sport, 53)); ret != 5 {
+			t.Errorf("sport %d dport 53: expected key 5, got %d", sport, ret)
+		}
+		// 槽位 7 没有套接字，按哈希分配
+		if ret, want := run(udp(sport, 8080)), run(udp(sport, 80)); ret == 7 || ret == 0xffff {
+			t.Errorf("sport %d dport 8080: unexpected key %d (hash %d)", sport, ret, want)
+		}
+	}
+	steering, err := fanout.Steering()
+	if err != nil || len(steering) != 2 || steering[53] != 5 || steering[8080] != 7 {
+		t.Errorf("Steering returned %v, %v", steering, err)
+	}
+	if err := fanout.DeleteSteering(53); err != nil {
+		t.Fatalf("DeleteSteering failed: %v", err)
+	}
+	if err := fanout.DeleteSteering(53); !errors.Is(err, ebpf.ErrKeyNotExist) {
+		t.Errorf("Expected ErrKeyNotExist, got %v", err)
+	}
+	if err := fanout.SetSteering(1, XSK_FANOUT_MAX_SOCKETS); !errors.Is(err, unix.EINVAL) {
+		t.Errorf("Expected EINVAL, got %v", err)
+	}
+}
@@ -0,0 +1,653 @@
+package xsk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+)
+
+// 设置 XSK_LIBBPF_FLAGS__FILTER 时，默认程序只把匹配规则的数据包重定向到套接字，其余数据包返回 XDP_PASS 交给内核协议栈，
+// 过滤由 xdp/xsk_features.h 中的 xsk_filter_match 实现。
+//
+// 每条规则占用掩码中的一位，各个 map 保存每个字段的取值匹配哪些规则，所有字段都匹配的规则对应的位保留在 match 中。
+// IPv4 地址以 IPv4 映射的 IPv6 地址（::ffff:a.b.c.d）保存在 LPM trie 中，每个前缀的掩码包含覆盖它的所有规则，
+// 不限制地址的规则以 ::/0 保存。规则保存在 xsk_filter 的 1 ~ XSK_FILTER_MAX_RULES 项中，修改时先在 active 中清除被删除的规则，
+// 写入各个 map 后再置位新的规则，因此数据包总是按照修改前或修改后的完整规则匹配。
+
+// XSK_FILTER_MAX_RULES 为过滤程序最多支持的规则数
+const XSK_FILTER_MAX_RULES = 64
+
+// 过滤程序使用的 map 名称，内核会截断超过 15 个字节的名称
+const (
+	xskFilterMapConfig = "xsk_filter"
+	xskFilterMapEth    = "xsk_filt_eth"
+	xskFilterMapProto  = "xsk_filt_proto"
+	xskFilterMapSrc    = "xsk_filt_src"
+	xskFilterMapDst    = "xsk_filt_dst"
+	xskFilterMapPort   = "xsk_filt_port"
+)
+
+/*
+	struct xsk_filter_config {
+		__u64 active;
+		__u64 any_eth;
+		__u64 any_proto;
+		__u64 any_src;
+		__u64 any_dst;
+		__u64 any_sport;
+		__u64 any_dport;
+	};
+*/
+type xskFilterConfig struct {
+	Active   uint64
+	AnyEth   uint64
+	AnyProto uint64
+	AnySrc   uint64
+	AnyDst   uint64
+	AnySport uint64
+	AnyDport uint64
+}
+
+// XskPortRange 是闭区间 [Low, High] 内的端口，零值表示任意端口。
+type XskPortRange struct {
+	Low  uint16
+	High uint16
+}
+
+// XskFilterRule 是一条过滤规则，数据包满足所有非零字段时匹配。
+// EtherType 为以太网类型（例如 unix.ETH_P_ARP）；IPProto 为 IPv4 的协议号或 IPv6 基本头部的下一个头部（不解析扩展头部）；
+// Src 和 Dst 为源、目的地址前缀，可以是 IPv4 或 IPv6；SrcPort 和 DstPort 只对 TCP、UDP 和 SCTP 的数据包
+// （IPv4 的后续分片除外）匹配。设置了 IPProto、地址或端口的规则不会匹配非 IP 的数据包，不解析 VLAN 标签。
+type XskFilterRule struct {
+	EtherType uint16
+	IPProto   uint8
+	Src       netip.Prefix
+	Dst       netip.Prefix
+	SrcPort   XskPortRange
+	DstPort   XskPortRange
+}
+
+// String 返回规则的可读形式。
+func (rule XskFilterRule) String() string {
+	var fields []string
+	if rule.EtherType != 0 {
+		fields = append(fields, fmt.Sprintf("ethertype %#04x", rule.EtherType))
+	}
+	if rule.IPProto != 0 {
+		fields = append(fields, fmt.Sprintf("proto %d", rule.IPProto))
+	}
+	if rule.Src.IsValid() {
+		fields = append(fields, "src "+rule.Src.String())
+	}
+	if rule.Dst.IsValid() {
+		fields = append(fields, "dst "+rule.Dst.String())
+	}
+	if rule.SrcPort != (XskPortRange{}) {
+		fields = append(fields, fmt.Sprintf("sport %d-%d", rule.SrcPort.Low, rule.SrcPort.High))
+	}
+	if rule.DstPort != (XskPortRange{}) {
+		fields = append(fields, fmt.Sprintf("dport %d-%d", rule.DstPort.Low, rule.DstPort.High))
+	}
+	if len(fields) == 0 {
+		return "any"
+	}
+	return strings.Join(fields, " ")
+}
+
+// xskFilterNormalize 检查规则并清除地址前缀中的主机位。
+func xskFilterNormalize(rule XskFilterRule) (XskFilterRule, error) {
+	if rule.SrcPort.Low > rule.SrcPort.High || rule.DstPort.Low > rule.DstPort.High {
+		return rule, fmt.Errorf("过滤规则 %v 的端口范围无效: %w", rule, unix.EINVAL)
+	}
+	rule.Src = rule.Src.Masked()
+	rule.Dst = rule.Dst.Masked()
+	return rule, nil
+}
+
+// xskLpmKey 是 LPM trie 的键，IPv4 前缀转换为 IPv4 映射的 IPv6 前缀，无效（零值）的前缀表示 ::/0。
+type xskLpmKey struct {
+	Prefixlen uint32
+	Addr      [16]byte
+}
+
+func xskFilterLpmKey(prefix netip.Prefix) xskLpmKey {
+	if !prefix.IsValid() {
+		return xskLpmKey{}
+	}
+	bits := prefix.Bits()
+	if prefix.Addr().Is4() {
+		bits += 96
+	}
+	return xskLpmKey{Prefixlen: uint32(bits), Addr: prefix.Addr().As16()}
+}
+
+// contains 返回 key 的前缀是否包含 other 的前缀。
+func (key xskLpmKey) contains(other xskLpmKey) bool {
+	if key.Prefixlen > other.Prefixlen {
+		return false
+	}
+	prefix, _ := netip.AddrFrom16(other.Addr).Prefix(int(key.Prefixlen))
+	return prefix.Addr().As16() == key.Addr
+}
+
+func (key xskLpmKey) marshal() []byte {
+	buf := make([]byte, 20)
+	binary.NativeEndian.PutUint32(buf, key.Prefixlen)
+	copy(buf[4:], key.Addr[:])
+	return buf
+}
+
+/*
+	struct xsk_filter_rule {
+		__u8 valid;
+		__u8 ip_proto;
+		__be16 ether_type;
+		__u16 sport_low, sport_high;
+		__u16 dport_low, dport_high;
+		__u8 src_prefixlen;
+		__u8 dst_prefixlen;
+		__u8 flags;
+		__u8 pad;
+		__u8 src[16];
+		__u8 dst[16];
+		__u8 pad2[8];
+	};
+
+保存在 xsk_filter 的第 1 项起，大小与 struct xsk_filter_config 相同，仅由用户态读写，以便其他套接字和进程读取和修改规则。
+*/
+const (
+	xskFilterRuleSize = 56
+
+	xskFilterRuleSrc   = 1 << 0
+	xskFilterRuleDst   = 1 << 1
+	xskFilterRuleSrc4  = 1 << 2
+	xskFilterRuleDst4  = 1 << 3
+	xskFilterRuleValid = 1
+)
+
+func xskFilterMarshalRule(rule *XskFilterRule) []byte {
+	buf := make([]byte, xskFilterRuleSize)
+	if rule == nil {
+		return buf
+	}
+	buf[0] = xskFilterRuleValid
+	buf[1] = rule.IPProto
+	binary.BigEndian.PutUint16(buf[2:], rule.EtherType)
+	binary.NativeEndian.PutUint16(buf[4:], rule.SrcPort.Low)
+	binary.NativeEndian.PutUint16(buf[6:], rule.SrcPort.High)
+	binary.NativeEndian.PutUint16(buf[8:], rule.DstPort.Low)
+	binary.NativeEndian.PutUint16(buf[10:], rule.DstPort.High)
+	var flags uint8
+	if rule.Src.IsValid() {
+		flags |= xskFilterRuleSrc
+		if rule.Src.Addr().Is4() {
+			flags |= xskFilterRuleSrc4
+		}
+		buf[12] = uint8(rule.Src.Bits())
+		addr := rule.Src.Addr().As16()
+		copy(buf[16:32], addr[:])
+	}
+	if rule.Dst.IsValid() {
+		flags |= xskFilterRuleDst
+		if rule.Dst.Addr().Is4() {
+			flags |= xskFilterRuleDst4
+		}
+		buf[13] = uint8(rule.Dst.Bits())
+		addr := rule.Dst.Addr().As16()
+		copy(buf[32:48], addr[:])
+	}
+	buf[14] = flags
+	return buf
+}
+
+func xskFilterUnmarshalRule(buf []byte) *XskFilterRule {
+	if len(buf) < xskFilterRuleSize || buf[0] != xskFilterRuleValid {
+		return nil
+	}
+	prefix := func(addr []byte, bits uint8, is4 bool) netip.Prefix {
+		ip := netip.AddrFrom16([16]byte(addr))
+		if is4 {
+			ip = ip.Unmap()
+		}
+		return netip.PrefixFrom(ip, int(bits))
+	}
+	rule := &XskFilterRule{
+		IPProto:   buf[1],
+		EtherType: binary.BigEndian.Uint16(buf[2:]),
+		SrcPort:   XskPortRange{binary.NativeEndian.Uint16(buf[4:]), binary.NativeEndian.Uint16(buf[6:])},
+		DstPort:   XskPortRange{binary.NativeEndian.Uint16(buf[8:]), binary.NativeEndian.Uint16(buf[10:])},
+	}
+	flags := buf[14]
+	if flags&xskFilterRuleSrc != 0 {
+		rule.Src = prefix(buf[16:32], buf[12], flags&xskFilterRuleSrc4 != 0)
+	}
+	if flags&xskFilterRuleDst != 0 {
+		rule.Dst = prefix(buf[32:48], buf[13], flags&xskFilterRuleDst4 != 0)
+	}
+	return rule
+}
+
+// xskFilterMaps 是过滤程序使用的 map。
+type xskFilterMaps struct {
+	config *ebpf.Map
+	eth    *ebpf.Map
+	proto  *ebpf.Map
+	src    *ebpf.Map
+	dst    *ebpf.Map
+	port   *ebpf.Map
+}
+
+// all 返回 map 的名称和指向 map 字段的指针。
+func (maps *xskFilterMaps) all() []struct {
+	name string
+	m    **ebpf.Map
+} {
+	return []struct {
+		name string
+		m    **ebpf.Map
+	}{
+		{xskFilterMapConfig, &maps.config},
+		{xskFilterMapEth, &maps.eth},
+		{xskFilterMapProto, &maps.proto},
+		{xskFilterMapSrc, &maps.src},
+		{xskFilterMapDst, &maps.dst},
+		{xskFilterMapPort, &maps.port},
+	}
+}
+
+// xskCreateFilterMaps 创建过滤程序使用的 map，初始时没有规则，所有数据包都交给内核协议栈。
+func xskCreateFilterMaps() (*xskFilterMaps, error) {
+	specs := map[string]*ebpf.MapSpec{
+		xskFilterMapConfig: {Type: ebpf.Array, KeySize: 4, ValueSize: xskFilterRuleSize, MaxEntries: 1 + XSK_FILTER_MAX_RULES},
+		xskFilterMapEth:    {Type: ebpf.Hash, KeySize: 2, ValueSize: 8, MaxEntries: XSK_FILTER_MAX_RULES},
+		xskFilterMapProto:  {Type: ebpf.Array, KeySize: 4, ValueSize: 8, MaxEntries: 256},
+		// 每条规则最多一个前缀，加上 ::/0
+		xskFilterMapSrc:  {Type: ebpf.LPMTrie, KeySize: 20, ValueSize: 8, MaxEntries: XSK_FILTER_MAX_RULES + 1, Flags: unix.BPF_F_NO_PREALLOC},
+		xskFilterMapDst:  {Type: ebpf.LPMTrie, KeySize: 20, ValueSize: 8, MaxEntries: XSK_FILTER_MAX_RULES + 1, Flags: unix.BPF_F_NO_PREALLOC},
+		xskFilterMapPort: {Type: ebpf.Array, KeySize: 4, ValueSize: 16, MaxEntries: 1 << 16},
+	}
+	maps := &xskFilterMaps{}
+	for _, entry := range maps.all() {
+		spec := specs[entry.name]
+		spec.Name = entry.name
+		m, err := ebpf.NewMap(spec)
+		if err != nil {
+			maps.Close()
+			return nil, fmt.Errorf("创建过滤程序的 map %s 失败: %w", entry.name, err)
+		}
+		*entry.m = m
+	}
+	return maps, nil
+}
+
+// xskLookupFilterMaps 查找 prog 使用的过滤程序的 map，prog 没有设置 XSK_LIBBPF_FLAGS__FILTER 时返回 ENOENT。
+func xskLookupFilterMaps(prog *ebpf.Program) (*xskFilterMaps, error) {
+	maps := &xskFilterMaps{}
+	for _, entry := range maps.all() {
+		m, err := xskLookupMap(prog, func(mapInfo *ebpf.MapInfo) bool {
+			return mapInfo.Name == entry.name
+		})
+		if err == nil && m == nil {
+			err = fmt.Errorf("XDP 程序中没有过滤规则的 map %s: %w", entry.name, unix.ENOENT)
+		}
+		if err != nil {
+			maps.Close()
+			return nil, err
+		}
+		*entry.m = m
+	}
+	return maps, nil
+}
+
+// Close 关闭 map 的文件描述符。
+func (maps *xskFilterMaps) Close() {
+	for _, entry := range maps.all() {
+		if *entry.m != nil {
+			(*entry.m).Close()
+			*entry.m = nil
+		}
+	}
+}
+
+// xskBE16 返回网络字节序的 v 按主机字节序读出的值，用于与从数据包中直接读出的字段比较。
+func xskBE16(v uint16) int32 {
+	return int32(binary.NativeEndian.Uint16(binary.BigEndian.AppendUint16(nil, v)))
+}
+
+// xskFilterState 是由规则计算出的各个 map 的内容，rules 的下标为规则在掩码中的位。
+type xskFilterState struct {
+	config xskFilterConfig
+	eth    map[uint16]uint64
+	proto  [256]uint64
+	src    map[xskLpmKey]uint64
+	dst    map[xskLpmKey]uint64
+	// ports[port] 为 {src, dst}
+	ports [][2]uint64
+}
+
+func xskFilterComputeState(rules *[XSK_FILTER_MAX_RULES]*XskFilterRule) *xskFilterState {
+	state := &xskFilterState{
+		eth:   make(map[uint16]uint64),
+		ports: make([][2]uint64, 1<<16),
+	}
+	srcKeys := make(map[int]xskLpmKey)
+	dstKeys := make(map[int]xskLpmKey)
+	for i, rule := range rules {
+		if rule == nil {
+			continue
+		}
+		bit := uint64(1) << i
+		state.config.Active |= bit
+		if rule.EtherType == 0 {
+			state.config.AnyEth |= bit
+		} else {
+			state.eth[uint16(xskBE16(rule.EtherType))] |= bit
+		}
+		if rule.IPProto == 0 {
+			state.config.AnyProto |= bit
+		} else {
+			state.proto[rule.IPProto] |= bit
+		}
+		if !rule.Src.IsValid() {
+			state.config.AnySrc |= bit
+		}
+		if !rule.Dst.IsValid() {
+			state.config.AnyDst |= bit
+		}
+		srcKeys[i] = xskFilterLpmKey(rule.Src)
+		dstKeys[i] = xskFilterLpmKey(rule.Dst)
+		if rule.SrcPort == (XskPortRange{}) {
+			state.config.AnySport |= bit
+		} else {
+			for port := int(rule.SrcPort.Low); port <= int(rule.SrcPort.High); port++ {
+				state.ports[port][0] |= bit
+			}
+		}
+		if rule.DstPort == (XskPortRange{}) {
+			state.config.AnyDport |= bit
+		} else {
+			for port := int(rule.DstPort.Low); port <= int(rule.DstPort.High); port++ {
+				state.ports[port][1] |= bit
+			}
+		}
+	}
+	state.src = xskFilterLpmState(srcKeys)
+	state.dst = xskFilterLpmState(dstKeys)
+	return state
+}
+
+// xskFilterLpmState 返回 LPM trie 的内容，keys 的键为规则的位。每个前缀的掩码包含前缀覆盖它的所有规则，
+// 因此最长前缀匹配得到的掩码包含了所有匹配的规则。
+func xskFilterLpmState(keys map[int]xskLpmKey) map[xskLpmKey]uint64 {
+	trie := make(map[xskLpmKey]uint64)
+	for _, key := range keys {
+		trie[key] = 0
+	}
+	for entry := range trie {
+		for i, key := range keys {
+			if key.contains(entry) {
+				trie[entry] |= 1 << i
+			}
+		}
+	}
+	return trie
+}
+
+// XskFilter 是 XSK_LIBBPF_FLAGS__FILTER 程序的规则表，修改立即对网卡上的程序生效。
+// 共享同一个程序的所有套接字使用相同的规则，修改在 xdpLockAcquire 的锁中进行，可以由多个进程同时修改。
+type XskFilter struct {
+	maps *xskFilterMaps
+}
+
+// XskSocketGetFilter 返回套接字载入的默认程序的规则表，套接字没有设置 XSK_LIBBPF_FLAGS__FILTER 时返回 ENOENT。
+// 程序刚创建时没有规则，所有数据包都交给内核协议栈。
+func XskSocketGetFilter(xsk *XskSocket) (*XskFilter, error) {
+	if xsk.Ctx.XdpProg == nil || xsk.Config.LibbpfFlags&XSK_LIBBPF_FLAGS__FILTER == 0 {
+		return nil, fmt.Errorf("%s 队列 %d 的套接字没有载入过滤程序: %w", xsk.Ctx.Ifname, xsk.Ctx.QueueId, unix.ENOENT)
+	}
+	maps, err := xskLookupFilterMaps(xsk.Ctx.XdpProg)
+	if err != nil {
+		return nil, err
+	}
+	return &XskFilter{maps: maps}, nil
+}
+
+// Close 关闭规则表，不会改变规则。
+func (filter *XskFilter) Close() {
+	filter.maps.Close()
+}
+
+// Rules 返回当前的规则。
+func (filter *XskFilter) Rules() ([]XskFilterRule, error) {
+	lockFile, err := xdpLockAcquire()
+	if err != nil {
+		return nil, err
+	}
+	defer xdpLockRelease(lockFile)
+	rules, err := filter.readRules()
+	if err != nil {
+		return nil, err
+	}
+	var result []XskFilterRule
+	for _, rule := range rules {
+		if rule != nil {
+			result = append(result, *rule)
+		}
+	}
+	return result, nil
+}
+
+// SetRules 以 rules 替换所有规则，rules 为空时所有数据包都交给内核协议栈。
+// 没有改变的规则在修改过程中保持生效，新的规则在所有 map 写入后同时生效。
+func (filter *XskFilter) SetRules(rules []XskFilterRule) error {
+	lockFile, err := xdpLockAcquire()
+	if err != nil {
+		return err
+	}
+	defer xdpLockRelease(lockFile)
+	return filter.setRules(rules)
+}
+
+// AddRule 添加一条规则。
+func (filter *XskFilter) AddRule(rule XskFilterRule) error {
+	lockFile, err := xdpLockAcquire()
+	if err != nil {
+		return err
+	}
+	defer xdpLockRelease(lockFile)
+	old, err := filter.readRules()
+	if err != nil {
+		return err
+	}
+	rules := []XskFilterRule{rule}
+	for _, r := range old {
+		if r != nil {
+			rules = append(rules, *r)
+		}
+	}
+	return filter.setRules(rules)
+}
+
+// DeleteRule 删除与 rule 相同的规则，没有这样的规则时返回 ENOENT。
+func (filter *XskFilter) DeleteRule(rule XskFilterRule) error {
+	rule, err := xskFilterNormalize(rule)
+	if err != nil {
+		return err
+	}
+	lockFile, err := xdpLockAcquire()
+	if err != nil {
+		return err
+	}
+	defer xdpLockRelease(lockFile)
+	old, err := filter.readRules()
+	if err != nil {
+		return err
+	}
+	var rules []XskFilterRule
+	found := false
+	for _, r := range old {
+		if r == nil {
+			continue
+		}
+		if !found && *r == rule {
+			found = true
+			continue
+		}
+		rules = append(rules, *r)
+	}
+	if !found {
+		return fmt.Errorf("没有过滤规则 %v: %w", rule, unix.ENOENT)
+	}
+	return filter.setRules(rules)
+}
+
+// readRules 读取保存的规则，下标为规则在掩码中的位。
+func (filter *XskFilter) readRules() (*[XSK_FILTER_MAX_RULES]*XskFilterRule, error) {
+	var rules [XSK_FILTER_MAX_RULES]*XskFilterRule
+	for i := range rules {
+		buf, err := filter.maps.config.LookupBytes(uint32(1 + i))
+		if err != nil {
+			return nil, err
+		}
+		rules[i] = xskFilterUnmarshalRule(buf)
+	}
+	return &rules, nil
+}
+
+// setRules 是 SetRules 的实现，调用者已经持有 xdpLockAcquire 的锁。
+func (filter *XskFilter) setRules(rules []XskFilterRule) error {
+	var newRules [XSK_FILTER_MAX_RULES]*XskFilterRule
+	var pending []XskFilterRule
+	var kept uint64
+
+	if len(rules) > XSK_FILTER_MAX_RULES {
+		return fmt.Errorf("过滤程序最多支持 %d 条规则: %w", XSK_FILTER_MAX_RULES, unix.E2BIG)
+	}
+	oldRules, err := filter.readRules()
+	if err != nil {
+		return err
+	}
+	// 没有改变的规则保留原来的位
+	for _, rule := range rules {
+		rule, err := xskFilterNormalize(rule)
+		if err != nil {
+			return err
+		}
+		i := 0
+		for ; i < XSK_FILTER_MAX_RULES; i++ {
+			if kept&(1<<i) == 0 && oldRules[i] != nil && *oldRules[i] == rule {
+				break
+			}
+		}
+		if i == XSK_FILTER_MAX_RULES {
+			pending = append(pending, rule)
+			continue
+		}
+		kept |= 1 << i
+		newRules[i] = oldRules[i]
+	}
+	for i := 0; len(pending) > 0; i++ {
+		if newRules[i] == nil {
+			newRules[i] = &pending[0]
+			pending = pending[1:]
+		}
+	}
+
+	oldState := xskFilterComputeState(oldRules)
+	newState := xskFilterComputeState(&newRules)
+	// 先停用被删除的规则，写入 map 后再启用新的规则
+	config := newState.config
+	config.Active = oldState.config.Active & kept
+	if err = filter.maps.config.Update(uint32(0), &config, ebpf.UpdateAny); err != nil {
+		return err
+	}
+	if err = filter.apply(oldState, newState); err != nil {
+		return err
+	}
+	for i := range newRules {
+		if newRules[i] != oldRules[i] {
+			if err = filter.maps.config.Update(uint32(1+i), xskFilterMarshalRule(newRules[i]), ebpf.UpdateAny); err != nil {
+				return err
+			}
+		}
+	}
+	return filter.maps.config.Update(uint32(0), &newState.config, ebpf.UpdateAny)
+}
+
+// apply 把 map 的内容从 oldState 更新为 newState，先写入新的项再删除多余的项。
+func (filter *XskFilter) apply(oldState, newState *xskFilterState) error {
+	for key, mask := range newState.eth {
+		if old, ok := oldState.eth[key]; !ok || old != mask {
+			if err := filter.maps.eth.Update(key, mask, ebpf.UpdateAny); err != nil {
+				return err
+			}
+		}
+	}
+	for proto := range newState.proto {
+		if oldState.proto[proto] != newState.proto[proto] {
+			if err := filter.maps.proto.Update(uint32(proto), newState.proto[proto], ebpf.UpdateAny); err != nil {
+				return err
+			}
+		}
+	}
+	for _, trie := range []struct {
+		m        *ebpf.Map
+		old, new map[xskLpmKey]uint64
+	}{{filter.maps.src, oldState.src, newState.src}, {filter.maps.dst, oldState.dst, newState.dst}} {
+		for key, mask := range trie.new {
+			if old, ok := trie.old[key]; !ok || old != mask {
+				if err := trie.m.Update(key.marshal(), mask, ebpf.UpdateAny); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	var keys []uint32
+	var values [][2]uint64
+	for port := range newState.ports {
+		if oldState.ports[port] != newState.ports[port] {
+			keys = append(keys, uint32(port))
+			values = append(values, newState.ports[port])
+		}
+	}
+	if len(keys) > 0 {
+		_, err := filter.maps.port.BatchUpdate(keys, values, nil)
+		if errors.Is(err, ebpf.ErrNotSupported) {
+			// 内核 < 5.6 不支持批量更新
+			for i := range keys {
+				if err = filter.maps.port.Update(keys[i], values[i], ebpf.UpdateAny); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for key := range oldState.eth {
+		if _, ok := newState.eth[key]; !ok {
+			if err := filter.maps.eth.Delete(key); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+				return err
+			}
+		}
+	}
+	for _, trie := range []struct {
+		m        *ebpf.Map
+		old, new map[xskLpmKey]uint64
+	}{{filter.maps.src, oldState.src, newState.src}, {filter.maps.dst, oldState.dst, newState.dst}} {
+		for key := range trie.old {
+			if _, ok := trie.new[key]; !ok {
+				if err := trie.m.Delete(key.marshal()); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package xsk
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+)
+
+// 以太网头部、IPv4 和 IPv6 头部的长度和字段偏移
+const (
+	ethHlen        = 14
+	ethProtoOff    = 12
+	ipv4Hlen       = 20
+	ipv4FragOff    = 6
+	ipv4ProtoOff   = 9
+	ipv4SaddrOff   = 12
+	ipv4DaddrOff   = 16
+	ipv6Hlen       = 40
+	ipv6NexthdrOff = 6
+	ipv6SaddrOff   = 8
+	ipv6DaddrOff   = 24
+)
+
+// filterTestPacket 构造以太网帧，proto 为 0 时不附加 L4 头部。
+func filterTestPacket(etherType uint16, src, dst netip.Addr, proto uint8, sport, dport uint16) []byte {
+	pkt := make([]byte, ethHlen, 128)
+	binary.BigEndian.PutUint16(pkt[ethProtoOff:], etherType)
+	switch etherType {
+	case unix.ETH_P_IP:
+		ip := make([]byte, ipv4Hlen)
+		ip[0] = 0x45
+		ip[ipv4ProtoOff] = proto
+		s, d := src.As4(), dst.As4()
+		copy(ip[ipv4SaddrOff:], s[:])
+		copy(ip[ipv4DaddrOff:], d[:])
+		pkt = append(pkt, ip...)
+	case unix.ETH_P_IPV6:
+		ip := make([]byte, ipv6Hlen)
+		ip[0] = 0x60
+		ip[ipv6NexthdrOff] = proto
+		s, d := src.As16(), dst.As16()
+		copy(ip[ipv6SaddrOff:], s[:])
+		copy(ip[ipv6DaddrOff:], d[:])
+		pkt = append(pkt, ip...)
+	}
+	if proto != 0 {
+		pkt = binary.BigEndian.AppendUint16(pkt, sport)
+		pkt = binary.BigEndian.AppendUint16(pkt, dport)
+		pkt = append(pkt, make([]byte, 16)...)
+	}
+	// 测试运行要求数据不短于以太网头部，补齐到 64 字节
+	for len(pkt) < 64 {
+		pkt = append(pkt, 0)
+	}
+	return pkt
+}
+
+func TestXskFilter(t *testing.T) {
+	maps, err := xskCreateFilterMaps()
+	if err != nil {
+		t.Fatalf("Failed to create filter maps: %v", err)
+	}
+	filter := &XskFilter{maps: maps}
+	defer filter.Close()
+
+	replacements := make(map[string]*ebpf.Map)
+	for _, entry := range maps.all() {
+		replacements[entry.name] = *entry.m
+	}
+	// 匹配时返回 XDP_TX
+	run := xskTestFeatureProg(t, "xsk_test_filter", replacements)
+
+	v4 := netip.MustParseAddr
+	arp := filterTestPacket(unix.ETH_P_ARP, netip.Addr{}, netip.Addr{}, 0, 0, 0)
+	udp := func(dst string, dport uint16) []byte {
+		return filterTestPacket(unix.ETH_P_IP, v4("192.168.1.1"), v4(dst), unix.IPPROTO_UDP, 1234, dport)
+	}
+	check := func(name string, pkt []byte, want uint32) {
+		t.Helper()
+		if ret := run(pkt); ret != want {
+			t.Errorf("%s: expected %d, got %d", name, want, ret)
+		}
+	}
+
+	// 没有规则时所有数据包交给内核
+	check("no rules", udp("10.1.1.1", 4500), XDP_PASS)
+
+	rules := []XskFilterRule{
+		{EtherType: unix.ETH_P_IP, IPProto: unix.IPPROTO_UDP, Dst: netip.MustParsePrefix("10.0.0.0/8"), DstPort: XskPortRange{4000, 5000}},
+		{Dst: netip.MustParsePrefix("10.1.0.0/16"), DstPort: XskPortRange{22, 22}},
+		{Src: netip.MustParsePrefix("2001:db8::1/32")},
+	}
+	if err := filter.SetRules(rules); err != nil {
+		t.Fatalf("SetRules failed: %v", err)
+	}
+	check("arp", arp, XDP_PASS)
+	check("udp 10.1.1.1:4500", udp("10.1.1.1", 4500), XDP_TX)
+	check("udp 10.2.0.1:4500", udp("10.2.0.1", 4500), XDP_TX)
+	check("udp 10.1.1.1:22", udp("10.1.1.1", 22), XDP_TX)
+	check("udp 10.2.0.1:22", udp("10.2.0.1", 22), XDP_PASS)
+	check("udp 11.0.0.1:4500", udp("11.0.0.1", 4500), XDP_PASS)
+	check("tcp 10.2.0.1:4500", filterTestPacket(unix.ETH_P_IP, v4("192.168.1.1"), v4("10.2.0.1"), unix.IPPROTO_TCP, 1, 4500), XDP_PASS)
+	check("ipv6 2001:db8::2", filterTestPacket(unix.ETH_P_IPV6, v4("2001:db8::2"), v4("2001:db8::3"), unix.IPPROTO_TCP, 1, 2), XDP_TX)
+	check("ipv6 2001:db9::2", filterTestPacket(unix.ETH_P_IPV6, v4("2001:db9::2"), v4("2001:db8::3"), unix.IPPROTO_TCP, 1, 2), XDP_PASS)
+
+	// IPv4 选项：端口在 ihl 指示的位置
+	pkt := udp("10.2.0.1", 0)
+	copy(pkt[ethHlen+ipv4Hlen+4:], pkt[ethHlen+ipv4Hlen:ethHlen+ipv4Hlen+4])
+	binary.BigEndian.PutUint16(pkt[ethHlen+ipv4Hlen+4+2:], 4500)
+	pkt[ethHlen] = 0x46
+	check("ipv4 options", pkt, XDP_TX)
+	// 后续分片没有端口
+	pkt = udp("10.2.0.1", 4500)
+	binary.BigEndian.PutUint16(pkt[ethHlen+ipv4FragOff:], 100)
+	check("ipv4 fragment", pkt, XDP_PASS)
+
+	got, err := filter.Rules()
+	if err != nil || len(got) != len(rules) {
+		t.Fatalf("Rules returned %v, %v", got, err)
+	}
+	if err := filter.AddRule(XskFilterRule{EtherType: unix.ETH_P_ARP}); err != nil {
+		t.Fatalf("AddRule failed: %v", err)
+	}
+	check("arp rule", arp, XDP_TX)
+	if err := filter.DeleteRule(rules[0]); err != nil {
+		t.Fatalf("DeleteRule failed: %v", err)
+	}
+	check("deleted rule", udp("10.2.0.1", 4500), XDP_PASS)
+	check("kept rule", udp("10.1.1.1", 22), XDP_TX)
+	if err := filter.DeleteRule(rules[0]); err == nil {
+		t.Errorf("Expected deleting a missing rule to fail")
+	}
+	if err := filter.AddRule(XskFilterRule{SrcPort: XskPortRange{10, 1}}); err == nil {
+		t.Errorf("Expected invalid port range to fail")
+	}
+	if err := filter.SetRules(nil); err != nil {
+		t.Fatalf("SetRules failed: %v", err)
+	}
+	check("cleared", arp, XDP_PASS)
+	if got, err := filter.Rules(); err != nil || len(got) != 0 {
+		t.Errorf("Expected no rules, got %v, %v", got, err)
+	}
+}
+
+func TestXskFilterRuleMarshal(t *testing.T) {
+	rules := []XskFilterRule{
+		{},
+		{EtherType: unix.ETH_P_IP, IPProto: unix.IPPROTO_TCP, Src: netip.MustParsePrefix("10.0.0.0/8"), SrcPort: XskPortRange{1, 2}},
+		{Dst: netip.MustParsePrefix("2001:db8::/32"), DstPort: XskPortRange{80, 443}},
+		{Src: netip.MustParsePrefix("::ffff:10.0.0.0/104")},
+	}
+	for _, rule := range rules {
+		got := xskFilterUnmarshalRule(xskFilterMarshalRule(&rule))
+		if got == nil || *got != rule {
+			t.Errorf("Expected %v, got %v", rule, got)
+		}
+	}
+	if xskFilterUnmarshalRule(xskFilterMarshalRule(nil)) != nil {
+		t.Errorf("Expected empty rule slot")
+	}
+}
@@ -0,0 +1,95 @@
+package xsk
+
+import (
+	"sync/atomic"
+)
+
+// xskFramePoolCell 是 xskFramePool 中的一个槽位，seq 表示槽位当前可以被哪一轮入队或出队使用。
+type xskFramePoolCell struct {
+	seq   atomic.Uint64
+	frame uint64
+}
+
+// xskFramePool 是一个预分配的无锁有界多生产者多消费者环形队列，保存空闲帧的地址。
+// SimpleXsk 的接收协程和发送协程共享同一个 xskFramePool，帧按需在两侧之间流动。
+// Put 和 Get 不会分配内存，容量向上取整到 2 的幂。
+type xskFramePool struct {
+	cells []xskFramePoolCell
+	mask  uint64
+	_     [64]byte
+	head  atomic.Uint64
+	_     [56]byte
+	tail  atomic.Uint64
+	_     [56]byte
+}
+
+func newXskFramePool(size int) *xskFramePool {
+	capacity := 1
+	for capacity < size {
+		capacity <<= 1
+	}
+	pool := &xskFramePool{
+		cells: make([]xskFramePoolCell, capacity),
+		mask:  uint64(capacity - 1),
+	}
+	for i := range pool.cells {
+		pool.cells[i].seq.Store(uint64(i))
+	}
+	return pool
+}
+
+// Put 放回一个空闲帧，队列已满时返回 false。
+// 帧的总数不超过容量时 Put 总是成功，槽位正在被出队时会等待出队完成。
+func (pool *xskFramePool) Put(frame uint64) bool {
+	pos := pool.tail.Load()
+	for {
+		cell := &pool.cells[pos&pool.mask]
+		seq := cell.seq.Load()
+		diff := int64(seq - pos)
+		if diff == 0 {
+			if pool.tail.CompareAndSwap(pos, pos+1) {
+				cell.frame = frame
+				cell.seq.Store(pos + 1)
+				return true
+			}
+			pos = pool.tail.Load()
+		} else if diff < 0 && int64(pos-pool.head.Load()) > int64(pool.mask) {
+			return false
+		} else {
+			// 槽位正在被另一个协程出队，或者 tail 已经被其他协程推进，重新读取
+			pos = pool.tail.Load()
+		}
+	}
+}
+
+// Get 取出一个空闲帧，队列为空时返回 false。
+func (pool *xskFramePool) Get() (uint64, bool) {
+	pos := pool.head.Load()
+	for {
+		cell := &pool.cells[pos&pool.mask]
+		seq := cell.seq.Load()
+		diff := int64(seq - (pos + 1))
+		if diff == 0 {
+			if pool.head.CompareAndSwap(pos, pos+1) {
+				frame := cell.frame
+				cell.seq.Store(pos + pool.mask + 1)
+				return frame, true
+			}
+			pos = pool.head.Load()
+		} else if diff < 0 {
+			return 0, false
+		} else {
+			pos = pool.head.Load()
+		}
+	}
+}
+
+// Len 返回队列中空闲帧的近似数量，并发修改时仅供参考。
+func (pool *xskFramePool) Len() int {
+	head := pool.head.Load()
+	tail := pool.tail.Load()
+	if tail < head {
+		return 0
+	}
+	return int(tail - head)
+}
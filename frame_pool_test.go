@@ -0,0 +1,75 @@
+package xsk
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestXskFramePool(t *testing.T) {
+	const numFrames = 1000
+	pool := newXskFramePool(numFrames)
+	if len(pool.cells) != 1024 {
+		t.Fatalf("Expected capacity 1024, got %d", len(pool.cells))
+	}
+	for i := uint64(0); i < numFrames; i++ {
+		if !pool.Put(i * 4096) {
+			t.Fatalf("Put failed at %d", i)
+		}
+	}
+	if pool.Len() != numFrames {
+		t.Fatalf("Expected %d free frames, got %d", numFrames, pool.Len())
+	}
+
+	// 两个协程并发地取出和放回帧，结束后每个帧应该恰好出现一次
+	var wg sync.WaitGroup
+	for g := 0; g < 2; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			held := make([]uint64, 0, 64)
+			for round := 0; round < 20000; round++ {
+				for len(held) < 64 {
+					frame, ok := pool.Get()
+					if !ok {
+						break
+					}
+					held = append(held, frame)
+				}
+				for _, frame := range held {
+					pool.Put(frame)
+				}
+				held = held[:0]
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[uint64]bool)
+	for {
+		frame, ok := pool.Get()
+		if !ok {
+			break
+		}
+		if seen[frame] || frame%4096 != 0 || frame >= numFrames*4096 {
+			t.Fatalf("Unexpected frame %d", frame)
+		}
+		seen[frame] = true
+	}
+	if len(seen) != numFrames {
+		t.Errorf("Expected %d frames after concurrent use, got %d", numFrames, len(seen))
+	}
+	if pool.Len() != 0 {
+		t.Errorf("Expected empty pool, got %d", pool.Len())
+	}
+}
+
+func TestXskFramePoolAllocs(t *testing.T) {
+	pool := newXskFramePool(16)
+	allocs := testing.AllocsPerRun(100, func() {
+		pool.Put(1)
+		pool.Get()
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations, got %f", allocs)
+	}
+}
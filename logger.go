@@ -0,0 +1,41 @@
+package xsk
+
+import (
+	"context"
+	"log/slog"
+)
+
+// 本库只把日志写入配置中的 Logger（XskUmemConfig、XskSocketConfig、ComplexUmemConfig、ComplexSocketConfig、SimpleXskConfig），
+// Logger 为 nil 时丢弃日志，不会写入全局的 log 或 slog.Default。记录的事件：
+//   - Info：XDP 程序挂载到网卡、从网卡卸载；
+//   - Debug：默认程序的引用计数变化、没有固定的 link 可以清理；
+//   - Warn：清理固定的 link、删除 xsks_map 中的项、解除环的映射、释放 umem 区域等释放资源的步骤失败，这些失败不会以错误返回。
+//
+// 套接字的日志带有 ifname 和 queue 属性。
+
+// xskDiscardHandler 丢弃所有日志
+type xskDiscardHandler struct{}
+
+func (xskDiscardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (xskDiscardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h xskDiscardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h xskDiscardHandler) WithGroup(string) slog.Handler           { return h }
+
+var xskDiscardLogger = slog.New(xskDiscardHandler{})
+
+// xskLogger 返回 logger，为 nil 时返回丢弃所有日志的 Logger。
+func xskLogger(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return xskDiscardLogger
+	}
+	return logger
+}
+
+// xskSocketLogger 返回套接字的 Logger，带有网卡和队列属性。
+func xskSocketLogger(xsk *XskSocket) *slog.Logger {
+	logger := xskLogger(xsk.Config.Logger)
+	if logger == xskDiscardLogger {
+		return logger
+	}
+	return logger.With("ifname", xsk.Ctx.Ifname, "queue", xsk.Ctx.QueueId)
+}
@@ -0,0 +1,57 @@
+package xsk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+// decodeLogs 解析 JSON 格式的日志
+func decodeLogs(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var records []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var record map[string]any
+		if err := dec.Decode(&record); err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestXskLogger(t *testing.T) {
+	if xskLogger(nil).Enabled(context.Background(), slog.LevelError) {
+		t.Error("Expected nil logger to discard logs")
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	if xskRemovePinnedLink(logger, 0) {
+		t.Error("Expected no pinned link for prog 0")
+	}
+
+	// 未绑定的套接字无法读取映射偏移，删除时记录警告而不是静默忽略
+	umem := &XskUmem{Fd: -1, Refcount: 1}
+	xsk := &XskSocket{
+		Ctx:    &XskCtx{Umem: umem, Ifname: "eth0", QueueId: 3, Refcount: 2},
+		Config: XskSocketConfig{Logger: logger},
+		Fd:     -1,
+	}
+	XskSocketDelete(xsk)
+
+	records := decodeLogs(t, &buf)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %v", records)
+	}
+	// 没有固定的 link 是正常情况，只记录调试日志
+	if records[0]["msg"] != "no pinned xdp link" || records[0]["level"] != "DEBUG" {
+		t.Errorf("Unexpected record %v", records[0])
+	}
+	if records[1]["msg"] != "get mmap offsets failed, rx and tx rings not unmapped" ||
+		records[1]["ifname"] != "eth0" || records[1]["queue"] != float64(3) {
+		t.Errorf("Unexpected record %v", records[1])
+	}
+}
@@ -70,3 +70,32 @@ func (p *SimplePacket) RunHandler(handler func(*PacketRawData, *int, *int)) {
 	handler(&p.rawData, &p.head, &p.tail)
 	p.data = p.rawData[p.head:p.tail]
 }
+
+// JumboPacket 表示可以容纳超过 MaxPacketDataSize 的数据包，例如多缓冲区（XDP_USE_SG）模式下收到的巨型帧。
+// 内部缓冲区按需增长，并在多次 SetData 之间复用。
+type JumboPacket struct {
+	data []byte
+}
+
+// Data 返回数据包中有效的数据部分。数据不应被修改。
+func (p *JumboPacket) Data() []byte {
+	return p.data
+}
+
+// Len 返回数据包的当前长度。
+func (p *JumboPacket) Len() int {
+	return len(p.data)
+}
+
+// SetData 将提供的数据复制到数据包并更新长度，缓冲区不足时自动扩容，不会返回错误。
+func (p *JumboPacket) SetData(data []byte) error {
+	p.data = append(p.data[:0], data...)
+	return nil
+}
+
+// TxMetadataPacket 为数据包附加 AF_XDP TX 元数据请求（校验和卸载、发送时间、发送时间戳），
+// 只在 SimpleXskConfig.TxMetadata 开启时生效，否则与内嵌的 Packet 一样发送。
+type TxMetadataPacket struct {
+	Packet
+	Request XskTxMetadata
+}
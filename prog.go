@@ -2,20 +2,109 @@ package xsk
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
 	"strings"
+	"sync"
+	"syscall"
 	"unsafe"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/link"
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
 )
 
 const LinkPath = "/sys/fs/bpf/xsk_def_xdp_prog_"
 
+// xskRemovePinnedLink 删除固定在 LinkPath 下的程序 progID 的 link，关闭后程序从网卡上卸载，失败时记录日志并返回 false。
+func xskRemovePinnedLink(logger *slog.Logger, progID uint32) bool {
+	path := fmt.Sprint(LinkPath, progID)
+	l, err := link.LoadPinnedLink(path, nil)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// 程序不是由本库挂载的，或者 link 已经被清理，没有需要删除的 link
+			logger.Debug("no pinned xdp link", "path", path)
+		} else {
+			logger.Warn("load pinned xdp link failed", "path", path, "err", err)
+		}
+		return false
+	}
+	defer l.Close()
+	if err = l.Unpin(); err != nil {
+		logger.Warn("unpin xdp link failed", "path", path, "err", err)
+		return false
+	}
+	return true
+}
+
 //go:generate go run github.com/cilium/ebpf/cmd/bpf2go -cc $BPF_CLANG -cflags $BPF_CFLAGS xsk_def_xdp_prog ./xdp/xsk_def_xdp_prog.c
 //go:generate go run github.com/cilium/ebpf/cmd/bpf2go -cc $BPF_CLANG -cflags $BPF_CFLAGS xsk_def_xdp_prog_5_3 ./xdp/xsk_def_xdp_prog_5.3.c
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -cc $BPF_CLANG -cflags $BPF_CFLAGS xsk_feature_xdp_prog ./xdp/xsk_feature_xdp_prog.c
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -cc $BPF_CLANG -cflags $BPF_CFLAGS xdp_dispatcher ./xdp/xdp_dispatcher.c
+
+var (
+	redirectFlagsMu       sync.Mutex
+	redirectFlagsChecked  bool
+	redirectFlagsDetected bool
+)
+
+// xskCheckRedirectFlags 检测内核的 bpf_redirect_map 是否支持在 flags 中传入默认动作（内核 >= 5.4）。
+// 与 libxdp 的 xsk_check_redirect_flags 相同：使用 BPF_PROG_TEST_RUN 运行一次 5.3 以上版本的默认程序，
+// 由于 xsks_map 为空，支持该语义的内核会返回 flags 中的 XDP_PASS，旧内核则返回 XDP_ABORTED。
+// 只缓存确定的检测结果，载入或运行失败（如提升权限前的 EPERM）时本次返回 false，下次调用重新检测。
+//
+// 返回值:
+//   - bool: 如果内核支持 bpf_redirect_map 的 flags 语义，则返回 true。
+func xskCheckRedirectFlags() bool {
+	redirectFlagsMu.Lock()
+	defer redirectFlagsMu.Unlock()
+	if !redirectFlagsChecked {
+		detected, err := xskProbeRedirectFlags()
+		if err != nil {
+			return false
+		}
+		redirectFlagsChecked = true
+		redirectFlagsDetected = detected
+	}
+	return redirectFlagsDetected
+}
+
+// xskProbeRedirectFlags 运行一次检测，无法载入或运行默认程序时返回错误。
+func xskProbeRedirectFlags() (bool, error) {
+	spec, err := loadXsk_def_xdp_prog()
+	if err != nil {
+		return false, err
+	}
+	// 只需要一个空的 xsks_map，不必按队列数分配
+	if mapSpec, ok := spec.Maps["xsks_map"]; ok {
+		mapSpec.MaxEntries = 1
+	}
+	obj := xsk_def_xdp_progObjects{}
+	err = spec.LoadAndAssign(&obj, nil)
+	if err != nil {
+		return false, err
+	}
+	defer obj.Close()
+	// 以太网头部长度为 14，测试运行要求数据不短于它
+	ret, err := obj.XskDefProg.Run(&ebpf.RunOptions{Data: make([]byte, 64)})
+	if err != nil {
+		return false, err
+	}
+	return ret == XDP_PASS, nil
+}
+
+// xskLoadDefXdpProg 根据内核 bpf_redirect_map 的语义返回默认 XDP 程序的 CollectionSpec。
+// 两个版本的程序与 map 名称相同，都可以载入到 xsk_def_xdp_progObjects 中。
+func xskLoadDefXdpProg() (*ebpf.CollectionSpec, error) {
+	if xskCheckRedirectFlags() {
+		return loadXsk_def_xdp_prog()
+	}
+	return loadXsk_def_xdp_prog_5_3()
+}
 
 func xskMapIsRefcntMap(mapInfo *ebpf.MapInfo) bool {
 	// 检查 map 名称是否以 ".data" 开头，并且 valueSize 大于等于 int 类型的大小
@@ -89,15 +178,22 @@ func xskLookupBPFMap(prog *ebpf.Program) (*ebpf.Map, error) {
 // - map 的 key 始终为零。
 // - 如果引用计数为零，程序正在等待分离，不能使用。
 func xskUpdateProgRefcnt(refcntMap *ebpf.Map, delta int) (int, error) {
+	lockFile, err := xdpLockAcquire()
+	if err != nil {
+		return -1, err
+	}
+	ret, err := xskUpdateProgRefcntLocked(refcntMap, delta)
+	xdpLockRelease(lockFile)
+	return ret, err
+}
+
+// xskUpdateProgRefcntLocked 与 xskUpdateProgRefcnt 相同，调用者已经持有 xdpLockAcquire 的锁。
+func xskUpdateProgRefcntLocked(refcntMap *ebpf.Map, delta int) (int, error) {
 	var err error
 	var ret int = -1
 	var key uint32 = 0
 	var valueData []byte
 	var value int
-	lockFile, err := xdpLockAcquire()
-	if err != nil {
-		goto out
-	}
 	/* Note, if other global variables are added before the refcnt,
 	 * this changes map's value type, not number of elements,
 	 * so additional offset must be applied to value_data,
@@ -105,26 +201,23 @@ func xskUpdateProgRefcnt(refcntMap *ebpf.Map, delta int) (int, error) {
 	 */
 	valueData, err = refcntMap.LookupBytes(&key)
 	if err != nil {
-		goto unlock
+		goto out
 	}
 
-	value = int(binary.LittleEndian.Uint32(valueData))
+	value = int(binary.NativeEndian.Uint32(valueData))
 	/* If refcount is 0, program is awaiting detach and can't be used */
 	if value != 0 {
 		value += delta
-		binary.LittleEndian.PutUint32(valueData, uint32(value))
+		binary.NativeEndian.PutUint32(valueData, uint32(value))
 		err := refcntMap.Update(&key, valueData, ebpf.UpdateAny)
 		if err != nil {
-			goto unlock
+			goto out
 		}
 	}
 
 	ret = value
-unlock:
-	xdpLockRelease(lockFile)
 out:
 	return ret, err
-
 }
 
 func xskIncrProgRefcnt(refcntMap *ebpf.Map) (int, error) {
@@ -136,7 +229,8 @@ func xskDecrProgRefcnt(refcntMap *ebpf.Map) (int, error) {
 }
 
 // xskSetupXdpProg 设置给定 XskSocket 的 XDP 程序，并在提供时更新 xsksMap。
-// 它执行以下步骤：
+// ctx 中已有程序时（同一个（网卡、队列）上共享 umem 的套接字），只检查程序的 features 和模式并写入 xsks map。
+// 否则执行以下步骤：
 // 1. 检查网络接口是否已附加 XDP 程序。
 // 2. 如果已附加 XDP 程序，则尝试加载该程序并增加其引用计数。
 // 3. 如果没有附加 XDP 程序或引用计数为零，则卸载该XDP程序，并加载新的 XDP 程序。
@@ -153,6 +247,7 @@ func xskDecrProgRefcnt(refcntMap *ebpf.Map) (int, error) {
 // - error: 如果设置过程中的任何步骤失败，则返回错误。
 func xskSetupXdpProg(xsk *XskSocket, xsksMap **ebpf.Map) error {
 	ctx := xsk.Ctx
+	logger := xskSocketLogger(xsk)
 	attached := false
 	var err error
 	var bpfInfo *ebpf.ProgramInfo
@@ -160,6 +255,33 @@ func xskSetupXdpProg(xsk *XskSocket, xsksMap **ebpf.Map) error {
 	var supportProgID bool
 	var l link.Link
 
+	// 同一个（网卡、队列）上共享 umem 的套接字共用 ctx 中的程序，只写入 xsks_map，程序在 ctx 的最后一个套接字删除时释放
+	if ctx.XdpProg != nil {
+		if ctx.RefcntMap != nil {
+			if err = xskCheckProgFeatures(xsk, ctx.RefcntMap); err != nil {
+				return err
+			}
+		}
+		if bpfInfo, err = ctx.XdpProg.Info(); err != nil {
+			return err
+		}
+		bpfID, _ = bpfInfo.ID()
+		if err = xskCheckProgMode(xsk, uint32(bpfID)); err != nil {
+			return err
+		}
+		if xsk.Rx != nil {
+			if err = xskRegisterSocket(xsk); err != nil {
+				return err
+			}
+		}
+		if xsksMap != nil {
+			*xsksMap, _ = ctx.XsksMap.Clone()
+		}
+		return nil
+	}
+	if xsk.Config.LibbpfFlags&XSK_LIBBPF_FLAGS__XDP_DISPATCHER != 0 {
+		return xskSetupDispatcherXdpProg(xsk, xsksMap)
+	}
 	ifLink, err := netlink.LinkByIndex(ctx.Ifindex)
 	if err != nil {
 		return err
@@ -179,10 +301,21 @@ func xskSetupXdpProg(xsk *XskSocket, xsksMap **ebpf.Map) error {
 		if ctx.RefcntMap == nil {
 			goto map_lookup
 		}
+		// 共享的程序必须附加了相同的处理
+		err = xskCheckProgFeatures(xsk, ctx.RefcntMap)
+		if err != nil {
+			goto err_prog_load
+		}
+		// 指定了挂载模式时，不能复用以其他模式挂载的程序
+		err = xskCheckProgMode(xsk, ifLink.Attrs().Xdp.ProgId)
+		if err != nil {
+			goto err_prog_load
+		}
 		refcnt, err = xskIncrProgRefcnt(ctx.RefcntMap)
 		if err != nil {
 			goto err_prog_load
 		}
+		logger.Debug("xdp prog refcount changed", "prog_id", ifLink.Attrs().Xdp.ProgId, "refcnt", refcnt)
 
 		if refcnt == 0 {
 			// Current program is being detached, falling back on creating a new program
@@ -191,23 +324,14 @@ func xskSetupXdpProg(xsk *XskSocket, xsksMap **ebpf.Map) error {
 			ctx.XdpProg.Close()
 			ctx.XdpProg = nil
 			// 解除之前的 hook
-			l, err = link.LoadPinnedLink(fmt.Sprint(LinkPath, ifLink.Attrs().Xdp.ProgId), nil)
-			if err != nil {
-				log.Println(err)
-			}
-			l.Unpin()
-			l.Close()
+			xskRemovePinnedLink(logger, ifLink.Attrs().Xdp.ProgId)
 		}
 	}
 
 	if ctx.XdpProg == nil {
-		// 注意：这里默认载入 5.3 以上的
-		spec, err := loadXsk_def_xdp_prog()
-		if err != nil {
-			return err
-		}
 		// 获取最大RX队列
-		channel, err := GetEthChannels(ctx.Ifname)
+		var channel *EthtoolChannels
+		channel, err = GetEthChannels(ctx.Ifname)
 		if err != nil {
 			return err
 		}
@@ -215,40 +339,31 @@ func xskSetupXdpProg(xsk *XskSocket, xsksMap **ebpf.Map) error {
 		if maxQueue == 0 {
 			maxQueue = channel.MaxCombined
 		}
-		if myMapSpec, ok := spec.Maps["xsks_map"]; ok {
-			myMapSpec.MaxEntries = maxQueue
-		}
-		obj := xsk_def_xdp_progObjects{}
-		err = spec.LoadAndAssign(&obj, nil)
-		if err != nil {
-			return err
-		}
-		defer obj.Close()
-		ctx.XdpProg, err = obj.XskDefProg.Clone()
+		ctx.XdpProg, l, err = xskAttachXdpProg(ctx.Ifindex, xsk.Config.XdpFlags,
+			func(flags link.XDPAttachFlags) (*ebpf.Program, error) {
+				return xskLoadXdpProg(xsk, maxQueue, flags)
+			})
 		if err != nil {
 			goto err_prog_load
 		}
 		bpfInfo, err = ctx.XdpProg.Info()
 		if err != nil {
+			l.Close()
 			goto err_prog_load
 		}
 		if bpfID, supportProgID = bpfInfo.ID(); !supportProgID {
+			l.Close()
+			err = unix.EOPNOTSUPP
 			goto err_prog_load
 		}
-
-		l, err := link.AttachXDP(link.XDPOptions{
-			Program:   ctx.XdpProg,
-			Interface: ctx.Ifindex,
-			Flags:     xsk.Config.XdpFlags,
-		})
+		err = l.Pin(fmt.Sprint(LinkPath, bpfID))
 		if err != nil {
-			goto err_prog_load
-		}
-		if l.Pin(fmt.Sprint(LinkPath, bpfID)) != nil {
+			l.Close()
 			goto err_prog_load
 		}
 		l.Close()
 		attached = true
+		logger.Info("xdp prog attached", "prog_id", bpfID)
 
 	}
 
@@ -264,7 +379,7 @@ map_lookup:
 		goto err_lookup
 	}
 	if xsk.Rx != nil {
-		err = ctx.XsksMap.Update(ctx.QueueId, int32(xsk.Fd), ebpf.UpdateAny)
+		err = xskRegisterSocket(xsk)
 		if err != nil {
 			goto err_lookup
 		}
@@ -276,13 +391,8 @@ map_lookup:
 	return nil
 
 err_lookup:
-	if attached {
-		l, err = link.LoadPinnedLink(fmt.Sprint(LinkPath, ifLink.Attrs().Xdp.ProgId), nil)
-		if err != nil {
-			log.Println(err)
-		}
-		l.Unpin()
-		l.Close()
+	if attached && xskRemovePinnedLink(logger, uint32(bpfID)) {
+		logger.Info("xdp prog detached", "prog_id", bpfID)
 	}
 
 err_prog_load:
@@ -295,6 +405,111 @@ err_prog_load:
 	return err
 }
 
+// xskCheckProgFeatures 检查已挂载的默认程序附加的处理（记录在 refcntMap 中）是否与套接字请求的相同，不同时返回 EBUSY。
+func xskCheckProgFeatures(xsk *XskSocket, refcntMap *ebpf.Map) error {
+	progFeatures, err := xskRefcntMapFeatures(refcntMap)
+	if err != nil {
+		return err
+	}
+	if progFeatures != xskProgFeatures(xsk.Config.LibbpfFlags) {
+		return fmt.Errorf("%s 上已挂载的 XDP 程序的 features %#x 与请求的 %#x 不一致: %w",
+			xsk.Ctx.Ifname, progFeatures, xskProgFeatures(xsk.Config.LibbpfFlags), unix.EBUSY)
+	}
+	return nil
+}
+
+// xskCheckProgMode 检查网卡上程序 progID 的挂载模式是否为套接字指定的模式，不同时返回 EBUSY，XDP_MODE_AUTO 时不检查。
+func xskCheckProgMode(xsk *XskSocket, progID uint32) error {
+	wantMode := xsk.Config.XdpFlags & xskXdpModeMask
+	if wantMode == XDP_MODE_AUTO {
+		return nil
+	}
+	mode, err := xskGetXdpAttachMode(xsk.Ctx.Ifindex, progID)
+	if err != nil {
+		return err
+	}
+	if mode&wantMode == 0 {
+		return fmt.Errorf("%s 上已挂载的 XDP 程序的模式 %s 与请求的 %s 不一致: %w",
+			xsk.Ctx.Ifname, xskXdpModeString(mode), xskXdpModeString(wantMode), unix.EBUSY)
+	}
+	return nil
+}
+
+// xskAttachXdpProg 把 load 载入的程序以 xdpFlags 挂载到网卡上，返回程序和挂载的 link。
+// XDP_MODE_AUTO 先尝试驱动模式，失败时退回通用模式；指定了模式时不会退回。
+// 每次尝试都会重新调用 load，以便按模式载入不同的程序（例如只能以驱动模式挂载的 dev-bound 程序）。
+func xskAttachXdpProg(ifindex int, xdpFlags link.XDPAttachFlags,
+	load func(link.XDPAttachFlags) (*ebpf.Program, error)) (*ebpf.Program, link.Link, error) {
+	modes := []link.XDPAttachFlags{xdpFlags}
+	if xdpFlags&xskXdpModeMask == XDP_MODE_AUTO {
+		modes = []link.XDPAttachFlags{xdpFlags | link.XDPDriverMode, xdpFlags | link.XDPGenericMode}
+	}
+	var attachErr error
+	for _, flags := range modes {
+		prog, err := load(flags)
+		if err != nil {
+			return nil, nil, err
+		}
+		l, err := link.AttachXDP(link.XDPOptions{
+			Program:   prog,
+			Interface: ifindex,
+			Flags:     flags,
+		})
+		if err == nil {
+			return prog, l, nil
+		}
+		attachErr = errors.Join(attachErr, fmt.Errorf("以 %s 模式挂载 XDP 程序失败: %w", xskXdpModeString(flags), err))
+		prog.Close()
+	}
+	return nil, nil, attachErr
+}
+
+// xskLoadXdpProg 载入用于以 xdpFlags 挂载的默认 XDP 程序，maxQueue 为 xsks_map 的大小。
+// 设置了可选处理（见 xskProgFeatures）时载入 xdp/xsk_feature_xdp_prog.c 编译的程序，否则根据内核版本自动选择 5.3 以上或 5.3 及以下的默认程序。
+func xskLoadXdpProg(xsk *XskSocket, maxQueue uint32, xdpFlags link.XDPAttachFlags) (*ebpf.Program, error) {
+	if features := xskProgFeatures(xsk.Config.LibbpfFlags); features != 0 {
+		return xskLoadFeatureXdpProg(xsk, maxQueue, features, xdpFlags)
+	}
+	spec, err := xskLoadDefXdpProg()
+	if err != nil {
+		return nil, err
+	}
+	if myMapSpec, ok := spec.Maps["xsks_map"]; ok {
+		myMapSpec.MaxEntries = maxQueue
+	}
+	// 多缓冲区模式要求 XDP 程序声明支持分片，否则 MTU 超过单帧时驱动会拒绝挂载
+	if xsk.Config.BindFlags&unix.XDP_USE_SG != 0 {
+		if progSpec, ok := spec.Programs["xsk_def_prog"]; ok {
+			progSpec.Flags |= unix.BPF_F_XDP_HAS_FRAGS
+		}
+	}
+	obj := xsk_def_xdp_progObjects{}
+	err = spec.LoadAndAssign(&obj, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return obj.XskDefProg.Clone()
+}
+
+// xskXdpModeString 返回挂载模式的名称，用于错误信息。
+func xskXdpModeString(flags link.XDPAttachFlags) string {
+	var modes []string
+	if flags&link.XDPGenericMode != 0 {
+		modes = append(modes, "generic")
+	}
+	if flags&link.XDPDriverMode != 0 {
+		modes = append(modes, "driver")
+	}
+	if flags&link.XDPOffloadMode != 0 {
+		modes = append(modes, "offload")
+	}
+	if len(modes) == 0 {
+		return "auto"
+	}
+	return strings.Join(modes, "|")
+}
+
 // xskReleaseXdpProg 释放与给定 XskSocket 关联的 XDP (eXpress Data Path) 程序。
 // 它执行以下步骤：
 // 1. 检查引用计数 map 是否为 nil，如果是则退出。
@@ -310,32 +525,123 @@ func xskReleaseXdpProg(xsk *XskSocket) {
 	var ifLink netlink.Link
 	var err error
 	var value int
-	var l link.Link
 	ctx := xsk.Ctx
+	logger := xskSocketLogger(xsk)
 
 	if ctx.RefcntMap == nil {
 		goto out
 	}
+	if xsk.Config.LibbpfFlags&XSK_LIBBPF_FLAGS__XDP_DISPATCHER != 0 {
+		xskReleaseDispatcherXdpProg(xsk)
+		ctx.RefcntMap.Close()
+		ctx.RefcntMap = nil
+		goto out
+	}
 
 	value, err = xskDecrProgRefcnt(ctx.RefcntMap)
 	ctx.RefcntMap.Close()
 	ctx.RefcntMap = nil
-	if err != nil || value != 0 {
+	if err != nil {
+		logger.Warn("decrease xdp prog refcount failed", "err", err)
+		goto out
+	}
+	logger.Debug("xdp prog refcount changed", "refcnt", value)
+	if value != 0 {
 		goto out
 	}
 
 	ifLink, err = netlink.LinkByIndex(ctx.Ifindex)
 	if err != nil {
+		logger.Warn("get link failed, xdp prog not detached", "err", err)
 		goto out
 	}
 
-	l, err = link.LoadPinnedLink(fmt.Sprint(LinkPath, ifLink.Attrs().Xdp.ProgId), nil)
-	if err == nil {
-		l.Unpin()
-		l.Close()
+	if xskRemovePinnedLink(logger, ifLink.Attrs().Xdp.ProgId) {
+		logger.Info("xdp prog detached", "prog_id", ifLink.Attrs().Xdp.ProgId)
 	}
 
 out:
 	ctx.XdpProg.Close()
 	ctx.XdpProg = nil
 }
+
+// xskGetXdpAttachMode 通过 netlink（RTM_GETLINK 的 IFLA_XDP 属性）读取网卡上 XDP 程序实际的挂载模式，
+// 返回 link.XDPGenericMode、link.XDPDriverMode 或 link.XDPOffloadMode，没有挂载程序时返回 0。
+// 同时以多种模式挂载了程序（XDP_ATTACHED_MULTI）时返回 progID 所在的模式，找不到时返回所有模式的组合。
+//
+// 参数：
+// - ifindex: 网卡索引。
+// - progID: 期望的程序 ID，为 0 时不做比较。
+//
+// 返回值：
+// - link.XDPAttachFlags: 挂载模式。
+// - error: netlink 请求失败时返回错误。
+func xskGetXdpAttachMode(ifindex int, progID uint32) (link.XDPAttachFlags, error) {
+	// vishvananda/netlink 把 IFLA_XDP_ATTACHED 解析为 bool，这里自行解析以获得挂载模式
+	req := nl.NewNetlinkRequest(unix.RTM_GETLINK, unix.NLM_F_ACK)
+	msg := nl.NewIfInfomsg(unix.AF_UNSPEC)
+	msg.Index = int32(ifindex)
+	req.AddData(msg)
+	msgs, err := req.Execute(unix.NETLINK_ROUTE, unix.RTM_NEWLINK)
+	if err != nil {
+		return 0, err
+	}
+	if len(msgs) == 0 || len(msgs[0]) < unix.SizeofIfInfomsg {
+		return 0, unix.ENODEV
+	}
+	attrs, err := nl.ParseRouteAttr(msgs[0][unix.SizeofIfInfomsg:])
+	if err != nil {
+		return 0, err
+	}
+	for _, attr := range attrs {
+		if attr.Attr.Type&^unix.NLA_F_NESTED != unix.IFLA_XDP {
+			continue
+		}
+		xdpAttrs, err := nl.ParseRouteAttr(attr.Value)
+		if err != nil {
+			return 0, err
+		}
+		return xskParseXdpAttachMode(xdpAttrs, progID), nil
+	}
+	return 0, nil
+}
+
+// xskParseXdpAttachMode 从 IFLA_XDP 的嵌套属性中解析挂载模式（见 xskGetXdpAttachMode）。
+func xskParseXdpAttachMode(xdpAttrs []syscall.NetlinkRouteAttr, progID uint32) link.XDPAttachFlags {
+	var attached uint8
+	var modes link.XDPAttachFlags
+	for _, xdpAttr := range xdpAttrs {
+		if len(xdpAttr.Value) == 0 {
+			continue
+		}
+		var mode link.XDPAttachFlags
+		switch xdpAttr.Attr.Type {
+		case unix.IFLA_XDP_ATTACHED:
+			attached = xdpAttr.Value[0]
+			continue
+		case unix.IFLA_XDP_SKB_PROG_ID:
+			mode = link.XDPGenericMode
+		case unix.IFLA_XDP_DRV_PROG_ID:
+			mode = link.XDPDriverMode
+		case unix.IFLA_XDP_HW_PROG_ID:
+			mode = link.XDPOffloadMode
+		default:
+			continue
+		}
+		if len(xdpAttr.Value) >= 4 && progID != 0 && binary.NativeEndian.Uint32(xdpAttr.Value) == progID {
+			return mode
+		}
+		modes |= mode
+	}
+	switch attached {
+	case XDP_ATTACHED_DRV:
+		return link.XDPDriverMode
+	case XDP_ATTACHED_SKB:
+		return link.XDPGenericMode
+	case XDP_ATTACHED_HW:
+		return link.XDPOffloadMode
+	case XDP_ATTACHED_MULTI:
+		return modes
+	}
+	return 0
+}
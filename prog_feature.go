@@ -0,0 +1,404 @@
+package xsk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/link"
+	"golang.org/x/sys/unix"
+)
+
+// 设置了 LibbpfFlags 中的过滤、采样、RX 元数据或分发时，默认程序由 xdp/xsk_feature_xdp_prog.c 编译，
+// 各项处理在 xdp/xsk_features.h 中实现，功能与 xdp/xsk_def_xdp_prog.c 相同，并依次附加：
+//
+//	if (!refcnt)
+//		return XDP_PASS;
+//	if ((xsk_features & XSK_LIBBPF_FLAGS__FILTER) && !xsk_filter_match(ctx))
+//		return XDP_PASS;
+//	if ((xsk_features & XSK_LIBBPF_FLAGS__SAMPLE) && !xsk_sample_match(ctx))
+//		return XDP_PASS;
+//	if (xsk_features & XSK_LIBBPF_FLAGS__RX_METADATA)
+//		xsk_rx_metadata(ctx);
+//	/* XSK_LIBBPF_FLAGS__FANOUT 时由 xsk_fanout_select 选择队列中的套接字 */
+//	return bpf_redirect_map(&xsks_map, ctx->rx_queue_index, XDP_PASS);
+//
+// xsk_features 和 xsk_redirect_flags 是 .rodata 中的常量，载入时改写，校验器会删除未启用的处理。
+// 调用 RX 元数据 kfunc 的程序必须绑定设备，即在 BPF_PROG_LOAD 中设置 prog_ifindex，cilium/ebpf 不支持该字段，
+// 因此程序的 map 由 Go 创建并关联到指令，kfunc 调用由 xskPatchKfuncs 处理，再由 xskLoadRawXdpProg 直接载入。
+// .data map 的值为 {refcnt, features}，features 记录程序附加了哪些处理，共享程序的套接字必须请求相同的处理。
+
+// 会改变 XDP 程序的 LibbpfFlags
+const xskProgFeatureFlags = XSK_LIBBPF_FLAGS__RX_METADATA | XSK_LIBBPF_FLAGS__FILTER | XSK_LIBBPF_FLAGS__SAMPLE |
+	XSK_LIBBPF_FLAGS__FANOUT
+
+// xskProgFeatures 返回 libbpfFlags 中会改变 XDP 程序的部分。
+func xskProgFeatures(libbpfFlags uint32) uint32 {
+	return libbpfFlags & xskProgFeatureFlags
+}
+
+// xskRefcntMapFeatures 读取已挂载程序的 .data map 中记录的 features，C 编写的默认程序没有该字段，视为 0。
+func xskRefcntMapFeatures(refcntMap *ebpf.Map) (uint32, error) {
+	var key uint32 = 0
+	valueData, err := refcntMap.LookupBytes(&key)
+	if err != nil {
+		return 0, err
+	}
+	if len(valueData) < 8 {
+		return 0, nil
+	}
+	return binary.NativeEndian.Uint32(valueData[4:8]), nil
+}
+
+// xskKfuncID 返回内核中名为 name 的 kfunc 的 BTF ID，内核不支持该 kfunc 时返回 false。
+func xskKfuncID(name string) (int64, bool) {
+	spec, err := btf.LoadKernelSpec()
+	if err != nil {
+		return 0, false
+	}
+	typ, err := spec.AnyTypeByName(name)
+	if err != nil {
+		return 0, false
+	}
+	if _, ok := typ.(*btf.Func); !ok {
+		return 0, false
+	}
+	id, err := spec.TypeID(typ)
+	if err != nil {
+		return 0, false
+	}
+	return int64(id), true
+}
+
+// xskKfuncCall 生成调用 kfunc 的指令。
+func xskKfuncCall(id int64) asm.Instruction {
+	return asm.Instruction{
+		OpCode:   asm.OpCode(asm.JumpClass).SetJumpOp(asm.Call),
+		Src:      asm.PseudoKfuncCall,
+		Constant: id,
+	}
+}
+
+// xskPatchKfuncs 返回替换了 kfunc 调用的指令副本。
+// 内核只允许绑定设备的程序调用元数据 kfunc，即使调用位于被删除的处理中。devBound 为 true 时 kfunc 调用改为内核中的 BTF ID，
+// 否则或内核不支持该 kfunc 时改为 r0 = -EOPNOTSUPP，对应的标志位保持为 0。
+func xskPatchKfuncs(insns asm.Instructions, devBound bool) asm.Instructions {
+	insns = append(asm.Instructions(nil), insns...)
+	for i := range insns {
+		if !insns[i].IsKfuncCall() {
+			continue
+		}
+		if devBound {
+			if id, ok := xskKfuncID(insns[i].Reference()); ok {
+				insns[i] = xskKfuncCall(id)
+				continue
+			}
+		}
+		insns[i] = asm.Mov.Imm(asm.R0, -int32(unix.EOPNOTSUPP))
+	}
+	return insns
+}
+
+// xskBuildXdpProg 返回附加了 features 处理的默认程序，程序中的 map 关联到 maps 中的 map，kfunc 调用需要由 xskPatchKfuncs 处理。
+// 未启用的处理使用的 map 在载入时仍需有效，以不带名称的占位 map 代替，xskLookup*Maps 不会找到它们。
+func xskBuildXdpProg(maps *xskFeatureMaps, features uint32) (*ebpf.ProgramSpec, error) {
+	spec, err := loadXsk_feature_xdp_prog()
+	if err != nil {
+		return nil, err
+	}
+	var redirectFlags uint32
+	if xskCheckRedirectFlags() {
+		redirectFlags = 1
+	}
+	err = spec.RewriteConstants(map[string]interface{}{
+		"xsk_features":       features,
+		"xsk_redirect_flags": redirectFlags,
+	})
+	if err != nil {
+		return nil, err
+	}
+	progSpec, ok := spec.Programs["xsk_def_prog"]
+	if !ok {
+		return nil, unix.ENOENT
+	}
+	maps.rodata, err = ebpf.NewMap(spec.Maps[".rodata"])
+	if err != nil {
+		return nil, err
+	}
+
+	byName := maps.byName()
+	for i := range progSpec.Instructions {
+		ins := &progSpec.Instructions[i]
+		if !ins.IsLoadFromMap() {
+			continue
+		}
+		name := ins.Reference()
+		m, ok := byName[name]
+		if !ok {
+			mapSpec, ok := spec.Maps[name]
+			if !ok {
+				return nil, fmt.Errorf("默认程序中没有 map %s: %w", name, unix.ENOENT)
+			}
+			mapSpec = mapSpec.Copy()
+			mapSpec.Name = ""
+			mapSpec.MaxEntries = 1
+			if m, err = ebpf.NewMap(mapSpec); err != nil {
+				return nil, err
+			}
+			maps.placeholders = append(maps.placeholders, m)
+			byName[name] = m
+		}
+		if err = ins.AssociateMap(m); err != nil {
+			return nil, err
+		}
+	}
+	return progSpec, nil
+}
+
+// xskNativeEndian 返回主机字节序，asm.Instructions.Marshal 只接受 binary.LittleEndian 或 binary.BigEndian。
+func xskNativeEndian() binary.ByteOrder {
+	if binary.NativeEndian.Uint16([]byte{1, 0}) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+/*
+	union bpf_attr {
+		struct { // BPF_PROG_LOAD
+			__u32		prog_type;
+			__u32		insn_cnt;
+			__aligned_u64	insns;
+			__aligned_u64	license;
+			__u32		log_level;
+			__u32		log_size;
+			__aligned_u64	log_buf;
+			__u32		kern_version;
+			__u32		prog_flags;
+			char		prog_name[BPF_OBJ_NAME_LEN];
+			__u32		prog_ifindex;
+			__u32		expected_attach_type;
+			...
+		};
+		...
+	};
+*/
+type bpfProgLoadAttr struct {
+	ProgType           uint32
+	InsnCnt            uint32
+	Insns              uint64
+	License            uint64
+	LogLevel           uint32
+	LogSize            uint32
+	LogBuf             uint64
+	KernVersion        uint32
+	ProgFlags          uint32
+	ProgName           [unix.BPF_OBJ_NAME_LEN]byte
+	ProgIfindex        uint32
+	ExpectedAttachType uint32
+}
+
+// xskLoadRawXdpProg 通过 BPF_PROG_LOAD 载入 XDP 程序，insns 中的 map 必须已经关联。
+// cilium/ebpf 不支持设置 prog_ifindex，而绑定设备（BPF_F_XDP_DEV_BOUND_ONLY）的程序才能调用驱动实现的 RX 元数据 kfunc。
+// 载入失败时会附带校验器日志。
+func xskLoadRawXdpProg(name string, insns asm.Instructions, flags uint32, ifindex int) (*ebpf.Program, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := insns.Marshal(buf, xskNativeEndian()); err != nil {
+		return nil, err
+	}
+	code := buf.Bytes()
+	license := []byte("GPL\x00")
+	attr := bpfProgLoadAttr{
+		ProgType:    uint32(ebpf.XDP),
+		InsnCnt:     uint32(len(code) / asm.InstructionSize),
+		Insns:       uint64(uintptr(unsafe.Pointer(&code[0]))),
+		License:     uint64(uintptr(unsafe.Pointer(&license[0]))),
+		ProgFlags:   flags,
+		ProgIfindex: uint32(ifindex),
+	}
+	copy(attr.ProgName[:unix.BPF_OBJ_NAME_LEN-1], name)
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_PROG_LOAD, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+	// attr 中以 uint64 保存的指针不会让 GC 保留 code 和 license，需要保证它们在系统调用返回前有效
+	runtime.KeepAlive(code)
+	runtime.KeepAlive(license)
+	if errno == 0 {
+		return ebpf.NewProgramFromFD(int(fd))
+	}
+
+	// 再次载入以获取校验器日志
+	log := make([]byte, 64*1024)
+	attr.LogLevel = 1
+	attr.LogSize = uint32(len(log))
+	attr.LogBuf = uint64(uintptr(unsafe.Pointer(&log[0])))
+	fd, _, _ = unix.Syscall(unix.SYS_BPF, unix.BPF_PROG_LOAD, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+	runtime.KeepAlive(code)
+	runtime.KeepAlive(license)
+	runtime.KeepAlive(log)
+	if int(fd) > 0 {
+		unix.Close(int(fd))
+	}
+	return nil, fmt.Errorf("载入 XDP 程序 %s 失败: %w\n%s", name, errno, bytes.TrimRight(log, "\x00"))
+}
+
+// xskLoadFeatureXdpProg 创建程序使用的 map，载入附加了 features 处理的默认程序。
+// 程序持有 map 的引用，返回后 map 的文件描述符即可关闭，之后与 C 编写的默认程序一样通过 xskLookupMap 查找。
+func xskLoadFeatureXdpProg(xsk *XskSocket, maxQueue uint32, features uint32, xdpFlags link.XDPAttachFlags) (*ebpf.Program, error) {
+	var progSpec *ebpf.ProgramSpec
+	var prog *ebpf.Program
+	var progFlags uint32
+	var ifindex int
+	maps, err := xskCreateFeatureMaps(maxQueue, features)
+	if err != nil {
+		return nil, err
+	}
+	defer maps.Close()
+	progSpec, err = xskBuildXdpProg(maps, features)
+	if err != nil {
+		return nil, err
+	}
+
+	if xsk.Config.BindFlags&unix.XDP_USE_SG != 0 {
+		progFlags |= unix.BPF_F_XDP_HAS_FRAGS
+	}
+	// 只有驱动模式下挂载的程序可以绑定设备，通用模式下不调用 kfunc，元数据不可用
+	if features&XSK_LIBBPF_FLAGS__RX_METADATA != 0 && xdpFlags&link.XDPDriverMode != 0 {
+		progFlags |= unix.BPF_F_XDP_DEV_BOUND_ONLY
+		ifindex = xsk.Ctx.Ifindex
+	}
+	prog, err = xskLoadRawXdpProg("xsk_def_prog", xskPatchKfuncs(progSpec.Instructions, ifindex != 0), progFlags, ifindex)
+	if err != nil && ifindex != 0 && errors.Is(err, unix.EOPNOTSUPP) {
+		// 驱动不支持绑定设备的程序，退回到不绑定设备，元数据不可用
+		prog, err = xskLoadRawXdpProg("xsk_def_prog", xskPatchKfuncs(progSpec.Instructions, false),
+			progFlags&^unix.BPF_F_XDP_DEV_BOUND_ONLY, 0)
+	}
+	return prog, err
+}
+
+// xskFeatureMaps 是附加了 features 处理的默认程序使用的 map，没有设置对应 features 的 map 为 nil。
+// rodata 和 placeholders 由 xskBuildXdpProg 创建。
+type xskFeatureMaps struct {
+	refcnt       *ebpf.Map
+	xsks         *ebpf.Map
+	rodata       *ebpf.Map
+	filter       *xskFilterMaps
+	sample       *xskSampleMaps
+	fanout       *xskFanoutMaps
+	placeholders []*ebpf.Map
+}
+
+// xskCreateFeatureMaps 创建默认程序使用的 .data map 和 xsks_map，.data 的值为 {refcnt = 1, features}。
+// features 包含 XSK_LIBBPF_FLAGS__FILTER、XSK_LIBBPF_FLAGS__SAMPLE、XSK_LIBBPF_FLAGS__FANOUT 时同时创建过滤、采样、分发使用的 map，
+// 其中 XSK_LIBBPF_FLAGS__FANOUT 的 xsks_map 为每个队列保留 XSK_FANOUT_MAX_SOCKETS 项。
+func xskCreateFeatureMaps(maxQueue uint32, features uint32) (*xskFeatureMaps, error) {
+	maps := &xskFeatureMaps{}
+	var err error
+	xsksEntries := maxQueue
+	if features&XSK_LIBBPF_FLAGS__FANOUT != 0 {
+		xsksEntries = maxQueue * XSK_FANOUT_MAX_SOCKETS
+	}
+	maps.refcnt, err = ebpf.NewMap(&ebpf.MapSpec{
+		Name:       ".data",
+		Type:       ebpf.Array,
+		KeySize:    4,
+		ValueSize:  8,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, 8)
+	// map 的值与程序读取的一样使用主机字节序
+	binary.NativeEndian.PutUint32(value[0:4], 1)
+	binary.NativeEndian.PutUint32(value[4:8], features)
+	if err = maps.refcnt.Update(uint32(0), value, ebpf.UpdateAny); err != nil {
+		goto out
+	}
+
+	maps.xsks, err = ebpf.NewMap(&ebpf.MapSpec{
+		Name:       "xsks_map",
+		Type:       ebpf.XSKMap,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: xsksEntries,
+	})
+	if err != nil {
+		goto out
+	}
+	if features&XSK_LIBBPF_FLAGS__FILTER != 0 {
+		maps.filter, err = xskCreateFilterMaps()
+		if err != nil {
+			goto out
+		}
+	}
+	if features&XSK_LIBBPF_FLAGS__SAMPLE != 0 {
+		maps.sample, err = xskCreateSampleMaps(maxQueue)
+		if err != nil {
+			goto out
+		}
+	}
+	if features&XSK_LIBBPF_FLAGS__FANOUT != 0 {
+		maps.fanout, err = xskCreateFanoutMaps(maxQueue)
+		if err != nil {
+			goto out
+		}
+	}
+	return maps, nil
+
+out:
+	maps.Close()
+	return nil, err
+}
+
+// byName 返回以程序中的名称为键的 map，没有设置对应 features 的 map 不在其中。
+func (maps *xskFeatureMaps) byName() map[string]*ebpf.Map {
+	byName := map[string]*ebpf.Map{
+		".data":    maps.refcnt,
+		".rodata":  maps.rodata,
+		"xsks_map": maps.xsks,
+	}
+	if maps.filter != nil {
+		for _, entry := range maps.filter.all() {
+			byName[entry.name] = *entry.m
+		}
+	}
+	if maps.sample != nil {
+		byName[xskSampleMapConfig] = maps.sample.config
+		byName[xskSampleMapState] = maps.sample.state
+	}
+	if maps.fanout != nil {
+		byName[xskFanoutMapConfig] = maps.fanout.config
+		byName[xskFanoutMapSteer] = maps.fanout.steer
+	}
+	return byName
+}
+
+// Close 关闭 map 的文件描述符，程序持有的引用不受影响。
+func (maps *xskFeatureMaps) Close() {
+	if maps.refcnt != nil {
+		maps.refcnt.Close()
+	}
+	if maps.xsks != nil {
+		maps.xsks.Close()
+	}
+	if maps.rodata != nil {
+		maps.rodata.Close()
+	}
+	if maps.filter != nil {
+		maps.filter.Close()
+	}
+	if maps.sample != nil {
+		maps.sample.Close()
+	}
+	if maps.fanout != nil {
+		maps.fanout.Close()
+	}
+	for _, m := range maps.placeholders {
+		m.Close()
+	}
+}
@@ -0,0 +1,124 @@
+package xsk
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+)
+
+// xskTestFeatureProg 载入 testdata/xsk_features_test.c 中的程序 name 并返回运行它的函数，
+// 程序使用的 map 替换为 maps 中的同名 map。
+func xskTestFeatureProg(t *testing.T, name string, maps map[string]*ebpf.Map) func(pkt []byte) uint32 {
+	t.Helper()
+	file := "testdata/xsk_features_test_bpfel.o"
+	if xskNativeEndian() == binary.BigEndian {
+		file = "testdata/xsk_features_test_bpfeb.o"
+	}
+	spec, err := ebpf.LoadCollectionSpec(file)
+	if err != nil {
+		t.Fatalf("Failed to load spec: %v", err)
+	}
+	for progName := range spec.Programs {
+		if progName != name {
+			delete(spec.Programs, progName)
+		}
+	}
+	// 以队列号为键的 map 的大小由测试决定
+	for mapName, m := range maps {
+		spec.Maps[mapName].MaxEntries = m.MaxEntries()
+	}
+	coll, err := ebpf.NewCollectionWithOptions(spec, ebpf.CollectionOptions{MapReplacements: maps})
+	if err != nil {
+		t.Fatalf("Failed to load program: %v", err)
+	}
+	t.Cleanup(coll.Close)
+	prog := coll.Programs[name]
+	return func(pkt []byte) uint32 {
+		t.Helper()
+		ret, err := prog.Run(&ebpf.RunOptions{Data: pkt})
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		return ret
+	}
+}
+
+// xskTestCloseMaps 关闭查找到的 map，只返回查找的错误。
+func xskTestCloseMaps[M interface{ Close() }](maps M, err error) error {
+	if err == nil {
+		maps.Close()
+	}
+	return err
+}
+
+func TestXskBuildXdpProg(t *testing.T) {
+	lookups := []struct {
+		feature uint32
+		lookup  func(*ebpf.Program) error
+	}{
+		{XSK_LIBBPF_FLAGS__FILTER, func(prog *ebpf.Program) error { return xskTestCloseMaps(xskLookupFilterMaps(prog)) }},
+		{XSK_LIBBPF_FLAGS__SAMPLE, func(prog *ebpf.Program) error { return xskTestCloseMaps(xskLookupSampleMaps(prog)) }},
+		{XSK_LIBBPF_FLAGS__FANOUT, func(prog *ebpf.Program) error { return xskTestCloseMaps(xskLookupFanoutMaps(prog)) }},
+	}
+	tests := []struct {
+		name        string
+		features    uint32
+		maxQueue    uint32
+		xsksEntries uint32
+	}{
+		{"rx_metadata", XSK_LIBBPF_FLAGS__RX_METADATA, 1, 1},
+		{"filter", XSK_LIBBPF_FLAGS__FILTER | XSK_LIBBPF_FLAGS__RX_METADATA, 1, 1},
+		{"sample", XSK_LIBBPF_FLAGS__FILTER | XSK_LIBBPF_FLAGS__SAMPLE | XSK_LIBBPF_FLAGS__RX_METADATA, 1, 1},
+		{"fanout", XSK_LIBBPF_FLAGS__FANOUT, 2, 2 * XSK_FANOUT_MAX_SOCKETS},
+		{"all", xskProgFeatureFlags, 2, 2 * XSK_FANOUT_MAX_SOCKETS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xsk := &XskSocket{Ctx: &XskCtx{}}
+			prog, err := xskLoadFeatureXdpProg(xsk, tt.maxQueue, tt.features, XDP_MODE_AUTO)
+			if err != nil {
+				t.Fatalf("Failed to load program: %v", err)
+			}
+			defer prog.Close()
+			// 未启用的处理使用的占位 map 不会被找到
+			for _, l := range lookups {
+				err := l.lookup(prog)
+				if tt.features&l.feature != 0 && err != nil {
+					t.Errorf("Failed to lookup maps of feature %#x: %v", l.feature, err)
+				}
+				if tt.features&l.feature == 0 && !errors.Is(err, unix.ENOENT) {
+					t.Errorf("Expected ENOENT for maps of feature %#x, got %v", l.feature, err)
+				}
+			}
+
+			// xsks_map 为空，数据包交给内核协议栈
+			ret, err := prog.Run(&ebpf.RunOptions{Data: make([]byte, 64)})
+			if err != nil {
+				t.Fatalf("Failed to run program: %v", err)
+			}
+			if ret != XDP_PASS {
+				t.Errorf("Expected XDP_PASS, got %d", ret)
+			}
+
+			refcntMap, err := xskLookupRefcntMap(prog)
+			if err != nil || refcntMap == nil {
+				t.Fatalf("Failed to lookup refcnt map: %v", err)
+			}
+			defer refcntMap.Close()
+			if features, err := xskRefcntMapFeatures(refcntMap); err != nil || features != tt.features {
+				t.Errorf("Expected features %#x, got %#x, %v", tt.features, features, err)
+			}
+			xsks, err := xskLookupBPFMap(prog)
+			if err != nil || xsks == nil {
+				t.Fatalf("Failed to lookup xsks_map: %v", err)
+			}
+			defer xsks.Close()
+			if info, err := xsks.Info(); err != nil || info.MaxEntries != tt.xsksEntries {
+				t.Errorf("Unexpected xsks_map %+v, %v", info, err)
+			}
+		})
+	}
+}
@@ -1,14 +1,17 @@
 package xsk
 
 import (
+	"encoding/binary"
 	"fmt"
 	"net"
+	"syscall"
 	"testing"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/btf"
 	"github.com/cilium/ebpf/link"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
 func TestAdd(t *testing.T) {
@@ -77,3 +80,73 @@ func TestAdd(t *testing.T) {
 	}
 
 }
+
+func TestXskParseXdpAttachMode(t *testing.T) {
+	u8 := func(typ uint16, v uint8) syscall.NetlinkRouteAttr {
+		return syscall.NetlinkRouteAttr{Attr: syscall.RtAttr{Type: typ}, Value: []byte{v}}
+	}
+	u32 := func(typ uint16, v uint32) syscall.NetlinkRouteAttr {
+		value := make([]byte, 4)
+		binary.NativeEndian.PutUint32(value, v)
+		return syscall.NetlinkRouteAttr{Attr: syscall.RtAttr{Type: typ}, Value: value}
+	}
+	tests := []struct {
+		attrs  []syscall.NetlinkRouteAttr
+		progID uint32
+		mode   link.XDPAttachFlags
+	}{
+		{[]syscall.NetlinkRouteAttr{u8(unix.IFLA_XDP_ATTACHED, XDP_ATTACHED_NONE)}, 0, 0},
+		{[]syscall.NetlinkRouteAttr{u8(unix.IFLA_XDP_ATTACHED, XDP_ATTACHED_SKB), u32(unix.IFLA_XDP_PROG_ID, 7)}, 7, link.XDPGenericMode},
+		{[]syscall.NetlinkRouteAttr{u8(unix.IFLA_XDP_ATTACHED, XDP_ATTACHED_DRV), u32(unix.IFLA_XDP_PROG_ID, 7)}, 0, link.XDPDriverMode},
+		{[]syscall.NetlinkRouteAttr{u8(unix.IFLA_XDP_ATTACHED, XDP_ATTACHED_MULTI),
+			u32(unix.IFLA_XDP_SKB_PROG_ID, 7), u32(unix.IFLA_XDP_DRV_PROG_ID, 8)}, 8, link.XDPDriverMode},
+		{[]syscall.NetlinkRouteAttr{u8(unix.IFLA_XDP_ATTACHED, XDP_ATTACHED_MULTI),
+			u32(unix.IFLA_XDP_SKB_PROG_ID, 7), u32(unix.IFLA_XDP_HW_PROG_ID, 8)}, 0, link.XDPGenericMode | link.XDPOffloadMode},
+	}
+	for i, test := range tests {
+		if mode := xskParseXdpAttachMode(test.attrs, test.progID); mode != test.mode {
+			t.Errorf("Test %d: expected mode %v, got %v", i, test.mode, mode)
+		}
+	}
+
+	// lo 上没有挂载 XDP 程序
+	mode, err := xskGetXdpAttachMode(1, 0)
+	if err != nil || mode != 0 {
+		t.Errorf("Expected no XDP program on lo, got %v %v", mode, err)
+	}
+}
+
+func TestXskXdpModeString(t *testing.T) {
+	tests := []struct {
+		flags    link.XDPAttachFlags
+		expected string
+	}{
+		{XDP_MODE_AUTO, "auto"},
+		{link.XDPGenericMode, "generic"},
+		{link.XDPDriverMode, "driver"},
+		{link.XDPOffloadMode, "offload"},
+		{link.XDPGenericMode | link.XDPDriverMode, "generic|driver"},
+	}
+	for _, tt := range tests {
+		if got := xskXdpModeString(tt.flags); got != tt.expected {
+			t.Errorf("xskXdpModeString(%#x) = %q, expected %q", tt.flags, got, tt.expected)
+		}
+	}
+}
+
+func TestXskCheckRedirectFlags(t *testing.T) {
+	redirectFlagsMu.Lock()
+	redirectFlagsChecked = false
+	redirectFlagsMu.Unlock()
+
+	// 当前内核（>= 5.4）支持 flags 语义，成功检测后缓存结果
+	if !xskCheckRedirectFlags() {
+		t.Fatal("Expected kernel to support bpf_redirect_map flags")
+	}
+	redirectFlagsMu.Lock()
+	checked := redirectFlagsChecked
+	redirectFlagsMu.Unlock()
+	if !checked {
+		t.Error("Expected probe result to be cached")
+	}
+}
@@ -73,6 +73,10 @@ func XskRingProdReserve(prod *XskRingProd, nb uint32, idx *uint32) uint32 {
 	return nb
 }
 
+func XskRingProdCancel(prod *XskRingProd, nb uint32) {
+	prod.CachedProd -= nb
+}
+
 func XskRingProdSubmit(prod *XskRingProd, nb uint32) {
 	atomic.AddUint32(prod.Producer, nb)
 }
@@ -111,3 +115,17 @@ func XskUmemExtractOffset(addr uint64) uint64 {
 func XskUmemAddOffsetToAddr(addr uint64) uint64 {
 	return XskUmemExtractAddr(addr) + XskUmemExtractOffset(addr)
 }
+
+// XskRingState 为环的生产者和消费者位置，两者之差为环中的描述符数量
+type XskRingState struct {
+	Producer uint32
+	Consumer uint32
+}
+
+func XskRingProdState(r *XskRingProd) XskRingState {
+	return XskRingState{Producer: atomic.LoadUint32(r.Producer), Consumer: atomic.LoadUint32(r.Consumer)}
+}
+
+func XskRingConsState(r *XskRingCons) XskRingState {
+	return XskRingState{Producer: atomic.LoadUint32(r.Producer), Consumer: atomic.LoadUint32(r.Consumer)}
+}
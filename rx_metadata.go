@@ -0,0 +1,64 @@
+package xsk
+
+import (
+	"encoding/binary"
+)
+
+// XskRxMetadata 是 XSK_LIBBPF_FLAGS__RX_METADATA 程序通过 XDP 元数据 kfunc 获取的 RX 硬件提示，
+// 位于每个数据包之前的 XSK_RX_METADATA_LEN 字节中。
+// Flags 中的 XSK_RX_METADATA__* 标志表示对应字段是否可用，驱动不支持（例如 veth 或通用模式）时标志为 0。
+type XskRxMetadata struct {
+	// Timestamp 为网卡记录的接收时间戳（纳秒）
+	Timestamp uint64
+	// Hash 为网卡计算的 RSS 哈希，HashType 为 enum xdp_rss_hash_type
+	Hash     uint32
+	HashType uint32
+	// VlanProto 为 VLAN 协议（主机字节序），VlanTci 为 VLAN TCI
+	VlanProto uint16
+	VlanTci   uint16
+	Flags     uint32
+}
+
+/*
+	struct xsk_rx_meta {
+		__u64 timestamp;
+		__u32 hash;
+		__u32 hash_type;
+		__be16 vlan_proto;
+		__u16 vlan_tci;
+		__u32 flags;
+		__u32 magic;
+		__u32 pad;
+	};
+*/
+// struct xsk_rx_meta（见 xdp/xsk_features.h）中字段的偏移
+const (
+	rxMetaTimestamp = 0
+	rxMetaHash      = 8
+	rxMetaHashType  = 12
+	rxMetaVlanProto = 16
+	rxMetaVlanTci   = 18
+	rxMetaFlags     = 20
+	rxMetaMagic     = 24
+)
+
+// XskGetRxMetadata 解码 umem 区域中数据偏移 data 之前的 RX 元数据。
+// data 为数据在 umem 区域中的偏移（见 XskUmemDataAddr）。XDP 程序没有写入元数据时返回 false。
+// 注意帧被复用时元数据区域不会被清除，只应对挂载了 XSK_LIBBPF_FLAGS__RX_METADATA 程序的队列调用。
+func XskGetRxMetadata(umemArea []byte, data uint64) (XskRxMetadata, bool) {
+	var meta XskRxMetadata
+	if data < XSK_RX_METADATA_LEN || data > uint64(len(umemArea)) {
+		return meta, false
+	}
+	raw := umemArea[data-XSK_RX_METADATA_LEN : data]
+	if binary.NativeEndian.Uint32(raw[rxMetaMagic:]) != XSK_RX_METADATA_MAGIC {
+		return meta, false
+	}
+	meta.Timestamp = binary.NativeEndian.Uint64(raw[rxMetaTimestamp:])
+	meta.Hash = binary.NativeEndian.Uint32(raw[rxMetaHash:])
+	meta.HashType = binary.NativeEndian.Uint32(raw[rxMetaHashType:])
+	meta.VlanProto = binary.BigEndian.Uint16(raw[rxMetaVlanProto:])
+	meta.VlanTci = binary.NativeEndian.Uint16(raw[rxMetaVlanTci:])
+	meta.Flags = binary.NativeEndian.Uint32(raw[rxMetaFlags:])
+	return meta, true
+}
@@ -0,0 +1,43 @@
+package xsk
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestXskGetRxMetadata(t *testing.T) {
+	umemArea := make([]byte, 4096)
+	data := uint64(256)
+	raw := umemArea[data-XSK_RX_METADATA_LEN : data]
+
+	if _, ok := XskGetRxMetadata(umemArea, data); ok {
+		t.Errorf("Expected no metadata without magic")
+	}
+	if _, ok := XskGetRxMetadata(umemArea, 16); ok {
+		t.Errorf("Expected no metadata before the start of umem")
+	}
+
+	binary.NativeEndian.PutUint64(raw[rxMetaTimestamp:], 123456789)
+	binary.NativeEndian.PutUint32(raw[rxMetaHash:], 0xdeadbeef)
+	binary.NativeEndian.PutUint32(raw[rxMetaHashType:], 2)
+	binary.BigEndian.PutUint16(raw[rxMetaVlanProto:], 0x8100)
+	binary.NativeEndian.PutUint16(raw[rxMetaVlanTci:], 100)
+	binary.NativeEndian.PutUint32(raw[rxMetaFlags:], XSK_RX_METADATA__TIMESTAMP|XSK_RX_METADATA__VLAN_TAG)
+	binary.NativeEndian.PutUint32(raw[rxMetaMagic:], XSK_RX_METADATA_MAGIC)
+
+	meta, ok := XskGetRxMetadata(umemArea, data)
+	if !ok {
+		t.Fatalf("Expected metadata to be available")
+	}
+	expected := XskRxMetadata{
+		Timestamp: 123456789,
+		Hash:      0xdeadbeef,
+		HashType:  2,
+		VlanProto: 0x8100,
+		VlanTci:   100,
+		Flags:     XSK_RX_METADATA__TIMESTAMP | XSK_RX_METADATA__VLAN_TAG,
+	}
+	if meta != expected {
+		t.Errorf("Expected %+v, got %+v", expected, meta)
+	}
+}
@@ -0,0 +1,164 @@
+package xsk
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+)
+
+// 设置 XSK_LIBBPF_FLAGS__SAMPLE 时，默认程序按队列的采样配置只重定向部分数据包，其余数据包返回 XDP_PASS 交给内核协议栈，
+// 采样由 xdp/xsk_features.h 中的 xsk_sample_match 实现。
+//
+// 配置只由用户态写入，状态只由程序写入，因此修改采样率不会与程序更新计数冲突。
+// 同一个队列的数据包由同一个 CPU 处理，counter 和 window_* 不需要原子操作。
+
+// 采样使用的 map 名称
+const (
+	xskSampleMapConfig = "xsk_sample"
+	xskSampleMapState  = "xsk_sample_st"
+)
+
+// XskSampleConfig 是队列的采样配置，Mode 为 XSK_SAMPLE_MODE__*。
+// XSK_SAMPLE_MODE__ONE_IN_N 的 Rate 为 0 或 1 时重定向所有数据包，XSK_SAMPLE_MODE__PER_SECOND 的 Rate 为 0 时不重定向。
+type XskSampleConfig struct {
+	Mode uint32
+	Rate uint32
+}
+
+// XskSampleStats 是队列的采样统计，Sampled 为重定向到套接字的数据包数，Skipped 为交给内核协议栈的数据包数。
+// 设置了 XSK_LIBBPF_FLAGS__FILTER 时只统计匹配规则的数据包。
+type XskSampleStats struct {
+	Sampled uint64
+	Skipped uint64
+}
+
+/*
+	struct xsk_sample_state {
+		__u64 counter;
+		__u64 window_start;
+		__u64 window_count;
+		__u64 sampled;
+		__u64 skipped;
+	};
+*/
+type xskSampleState struct {
+	Counter     uint64
+	WindowStart uint64
+	WindowCount uint64
+	Sampled     uint64
+	Skipped     uint64
+}
+
+// xskSampleMaps 是采样使用的 map，以队列号为键。
+type xskSampleMaps struct {
+	config *ebpf.Map
+	state  *ebpf.Map
+}
+
+// xskCreateSampleMaps 创建采样使用的 map，初始时所有队列为 XSK_SAMPLE_MODE__ALL。
+func xskCreateSampleMaps(maxQueue uint32) (*xskSampleMaps, error) {
+	config, err := ebpf.NewMap(&ebpf.MapSpec{
+		Name:       xskSampleMapConfig,
+		Type:       ebpf.Array,
+		KeySize:    4,
+		ValueSize:  8,
+		MaxEntries: maxQueue,
+	})
+	if err != nil {
+		return nil, err
+	}
+	state, err := ebpf.NewMap(&ebpf.MapSpec{
+		Name:       xskSampleMapState,
+		Type:       ebpf.Array,
+		KeySize:    4,
+		ValueSize:  40,
+		MaxEntries: maxQueue,
+	})
+	if err != nil {
+		config.Close()
+		return nil, err
+	}
+	return &xskSampleMaps{config: config, state: state}, nil
+}
+
+// xskLookupSampleMaps 查找 prog 使用的采样 map，prog 没有设置 XSK_LIBBPF_FLAGS__SAMPLE 时返回 ENOENT。
+func xskLookupSampleMaps(prog *ebpf.Program) (*xskSampleMaps, error) {
+	maps := &xskSampleMaps{}
+	for _, entry := range []struct {
+		name string
+		m    **ebpf.Map
+	}{{xskSampleMapConfig, &maps.config}, {xskSampleMapState, &maps.state}} {
+		m, err := xskLookupMap(prog, func(mapInfo *ebpf.MapInfo) bool {
+			return mapInfo.Name == entry.name
+		})
+		if err == nil && m == nil {
+			err = fmt.Errorf("XDP 程序中没有采样的 map %s: %w", entry.name, unix.ENOENT)
+		}
+		if err != nil {
+			maps.Close()
+			return nil, err
+		}
+		*entry.m = m
+	}
+	return maps, nil
+}
+
+// Close 关闭 map 的文件描述符。
+func (maps *xskSampleMaps) Close() {
+	if maps.config != nil {
+		maps.config.Close()
+		maps.config = nil
+	}
+	if maps.state != nil {
+		maps.state.Close()
+		maps.state = nil
+	}
+}
+
+// XskSocketSetSampleConfig 修改套接字所在队列的采样配置，立即对网卡上的程序生效，套接字没有设置 XSK_LIBBPF_FLAGS__SAMPLE 时返回 ENOENT。
+// 共享同一个程序的其他进程也可以修改同一个队列的配置。
+func XskSocketSetSampleConfig(xsk *XskSocket, config XskSampleConfig) error {
+	if config.Mode > XSK_SAMPLE_MODE__PER_SECOND {
+		return fmt.Errorf("无效的采样模式 %d: %w", config.Mode, unix.EINVAL)
+	}
+	maps, err := xskSocketSampleMaps(xsk)
+	if err != nil {
+		return err
+	}
+	defer maps.Close()
+	return maps.config.Update(xsk.Ctx.QueueId, &config, ebpf.UpdateAny)
+}
+
+// XskSocketGetSampleConfig 返回套接字所在队列的采样配置。
+func XskSocketGetSampleConfig(xsk *XskSocket) (XskSampleConfig, error) {
+	var config XskSampleConfig
+	maps, err := xskSocketSampleMaps(xsk)
+	if err != nil {
+		return config, err
+	}
+	defer maps.Close()
+	err = maps.config.Lookup(xsk.Ctx.QueueId, &config)
+	return config, err
+}
+
+// XskSocketGetSampleStats 返回套接字所在队列的采样统计，计数从程序载入时开始累计。
+func XskSocketGetSampleStats(xsk *XskSocket) (XskSampleStats, error) {
+	var state xskSampleState
+	maps, err := xskSocketSampleMaps(xsk)
+	if err != nil {
+		return XskSampleStats{}, err
+	}
+	defer maps.Close()
+	if err = maps.state.Lookup(xsk.Ctx.QueueId, &state); err != nil {
+		return XskSampleStats{}, err
+	}
+	return XskSampleStats{Sampled: state.Sampled, Skipped: state.Skipped}, nil
+}
+
+func xskSocketSampleMaps(xsk *XskSocket) (*xskSampleMaps, error) {
+	if xsk.Ctx.XdpProg == nil || xsk.Config.LibbpfFlags&XSK_LIBBPF_FLAGS__SAMPLE == 0 {
+		return nil, fmt.Errorf("%s 队列 %d 的套接字没有载入采样程序: %w", xsk.Ctx.Ifname, xsk.Ctx.QueueId, unix.ENOENT)
+	}
+	return xskLookupSampleMaps(xsk.Ctx.XdpProg)
+}
@@ -0,0 +1,62 @@
+package xsk
+
+import (
+	"testing"
+
+	"github.com/cilium/ebpf"
+)
+
+func TestXskSample(t *testing.T) {
+	maps, err := xskCreateSampleMaps(1)
+	if err != nil {
+		t.Fatalf("Failed to create sample maps: %v", err)
+	}
+	defer maps.Close()
+
+	// 采样时返回 XDP_TX
+	runPkt := xskTestFeatureProg(t, "xsk_test_sample", map[string]*ebpf.Map{
+		xskSampleMapConfig: maps.config,
+		xskSampleMapState:  maps.state,
+	})
+
+	run := func(n int) (sampled int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			if runPkt(make([]byte, 64)) == XDP_TX {
+				sampled++
+			}
+		}
+		return sampled
+	}
+	tests := []struct {
+		config XskSampleConfig
+		n      int
+		want   int
+	}{
+		{XskSampleConfig{Mode: XSK_SAMPLE_MODE__ALL}, 5, 5},
+		{XskSampleConfig{Mode: XSK_SAMPLE_MODE__ONE_IN_N, Rate: 4}, 16, 4},
+		{XskSampleConfig{Mode: XSK_SAMPLE_MODE__ONE_IN_N, Rate: 1}, 5, 5},
+		// 测试在一秒内完成，只有前 Rate 个数据包被采样
+		{XskSampleConfig{Mode: XSK_SAMPLE_MODE__PER_SECOND, Rate: 3}, 10, 3},
+		{XskSampleConfig{Mode: XSK_SAMPLE_MODE__PER_SECOND, Rate: 0}, 5, 0},
+	}
+	var total xskSampleState
+	for _, test := range tests {
+		// 每次重置状态，模拟新载入的程序
+		if err := maps.state.Update(uint32(0), &xskSampleState{}, ebpf.UpdateAny); err != nil {
+			t.Fatal(err)
+		}
+		if err := maps.config.Update(uint32(0), &test.config, ebpf.UpdateAny); err != nil {
+			t.Fatal(err)
+		}
+		if got := run(test.n); got != test.want {
+			t.Errorf("%+v: expected %d of %d sampled, got %d", test.config, test.want, test.n, got)
+		}
+		if err := maps.state.Lookup(uint32(0), &total); err != nil {
+			t.Fatal(err)
+		}
+		if total.Sampled != uint64(test.want) || total.Skipped != uint64(test.n-test.want) {
+			t.Errorf("%+v: unexpected stats %+v", test.config, total)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package xsk
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// SharedUmem 是一个可以被多个队列、多个网卡上的套接字共享的 umem（XDP_SHARED_UMEM）。
+// 通过 NewSocket 创建的 ComplexXsk 从同一个 umem 中取帧，描述符可以直接在它们之间传递，
+// 例如从一个网卡的 RecvBatch 取出后交给另一个网卡的 SendBatch，实现零拷贝转发。
+// 每个（网卡、队列）组合都有自己的 fill ring 和 completion ring，由 NewSocket 自动创建，
+// 同一组合上的多个套接字共享同一对 fill ring 和 completion ring。
+// 帧由调用者统一管理：一个帧同一时间只能位于一个环中。
+type SharedUmem struct {
+	mu        sync.Mutex
+	umem      *XskUmem
+	umemArea  []byte
+	config    ComplexUmemConfig
+	allocator UmemAllocator
+	fill      *XskRingProd
+	comp      *XskRingCons
+	sockets   []*ComplexXsk
+}
+
+// NewSharedUmem 创建一个 SharedUmem，config 为 nil 时使用 DefaultComplexUmemConfig。
+// FillSize 和 CompSize 用于之后每个（网卡、队列）组合创建的 fill ring 和 completion ring。
+// 返回 umem 中所有帧的描述符，与 NewComplexXsk 相同。
+func NewSharedUmem(config *ComplexUmemConfig) (*SharedUmem, []XDPDesc, error) {
+	shared := new(SharedUmem)
+	var err error
+	if config == nil {
+		config = DefaultComplexUmemConfig()
+	}
+	shared.config = *config
+
+	shared.allocator = shared.config.Allocator
+	if shared.allocator == nil {
+		shared.allocator = AnonUmemAllocator{}
+	}
+	shared.umemArea, err = shared.allocator.Alloc(int(shared.config.FrameNum) * int(shared.config.FrameSize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 注册 umem 时创建的 fill ring 和 completion ring 会交给第一个套接字所在的（网卡、队列）组合
+	shared.fill = new(XskRingProd)
+	shared.comp = new(XskRingCons)
+	shared.umem, err = XskUmemCreate(unsafe.Pointer(&shared.umemArea[0]),
+		uint64(shared.config.FrameNum)*uint64(shared.config.FrameSize),
+		shared.fill, shared.comp, complexUmemConfig(&shared.config))
+	if err != nil {
+		shared.allocator.Free(shared.umemArea)
+		return nil, nil, err
+	}
+	return shared, complexXskDescs(shared.umem, &shared.config), nil
+}
+
+// NewSocket 在 ifaceName 的 queueID 队列上创建一个使用该 umem 的 ComplexXsk，config 为 nil 时使用 DefaultComplexSocketConfig。
+// 第一个套接字的 BindFlags 决定整个 umem 的绑定方式（例如 XDP_USE_NEED_WAKEUP、XDP_ZEROCOPY），之后的套接字以 XDP_SHARED_UMEM 绑定，
+// 其 BindFlags 被忽略。跨网卡或跨队列共享 umem 需要内核版本 >= 5.10。
+// 返回的 ComplexXsk 的 Close 只关闭套接字，umem 在 SharedUmem.Close 时释放。
+// 与 libxdp 相同，第一个套接字使用注册 umem 的 fd，单独关闭后该队列在 SharedUmem.Close 之前仍然处于绑定状态。
+func (shared *SharedUmem) NewSocket(ifaceName string, queueID uint32, config *ComplexSocketConfig) (*ComplexXsk, error) {
+	var err error
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+	if shared.umem == nil {
+		return nil, xskError("socket", ifaceName, queueID, unix.EBADF)
+	}
+	if config == nil {
+		config = DefaultComplexSocketConfig()
+	}
+
+	complexXsk := new(ComplexXsk)
+	complexXsk.shared = shared
+	complexXsk.umem = shared.umem
+	complexXsk.umemArea = shared.umemArea
+	complexXsk.config.UmemConfig = &shared.config
+	complexXsk.config.SocketConfig = new(ComplexSocketConfig)
+	*complexXsk.config.SocketConfig = *config
+
+	// 没有对应的（网卡、队列）组合时，新的 fill ring 和 completion ring 会创建在这里
+	complexXsk.xsk, err = XskSocketCreateShared(ifaceName, queueID, shared.umem,
+		&complexXsk.rx, &complexXsk.tx, new(XskRingProd), new(XskRingCons),
+		complexSocketConfig(complexXsk.config.SocketConfig))
+	if err != nil {
+		return nil, err
+	}
+	complexXsk.fill = complexXsk.xsk.Ctx.Fill
+	complexXsk.comp = complexXsk.xsk.Ctx.Comp
+	complexXsk.zeroCopy = xskIsZeroCopy(complexXsk.xsk.Fd)
+	complexXsk.compBase = atomic.LoadUint32(complexXsk.comp.Producer)
+	shared.sockets = append(shared.sockets, complexXsk)
+	return complexXsk, nil
+}
+
+// UmemArea 返回整个 umem 区域。
+func (shared *SharedUmem) UmemArea() []byte {
+	return shared.umemArea
+}
+
+// closeSocket 关闭由 NewSocket 创建的套接字。
+func (shared *SharedUmem) closeSocket(complexXsk *ComplexXsk) {
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+	shared.closeSocketLocked(complexXsk)
+}
+
+func (shared *SharedUmem) closeSocketLocked(complexXsk *ComplexXsk) {
+	if complexXsk.xsk == nil {
+		return
+	}
+	XskSocketDelete(complexXsk.xsk)
+	complexXsk.xsk = nil
+	for i, s := range shared.sockets {
+		if s == complexXsk {
+			shared.sockets = append(shared.sockets[:i], shared.sockets[i+1:]...)
+			break
+		}
+	}
+}
+
+// Close 关闭所有通过 NewSocket 创建的套接字并释放 umem。
+func (shared *SharedUmem) Close() {
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+	for len(shared.sockets) > 0 {
+		shared.closeSocketLocked(shared.sockets[len(shared.sockets)-1])
+	}
+
+	if shared.umem != nil {
+		XskUmemDelete(shared.umem)
+		shared.umem = nil
+	}
+
+	if shared.umemArea != nil {
+		if err := shared.allocator.Free(shared.umemArea); err != nil {
+			xskLogger(shared.config.Logger).Warn("free umem area failed", "err", err)
+		}
+		shared.umemArea = nil
+	}
+}
@@ -0,0 +1,58 @@
+package xsk
+
+import (
+	"testing"
+)
+
+func TestSharedUmem(t *testing.T) {
+	shared, descs, err := NewSharedUmem(&ComplexUmemConfig{
+		FillSize:  1024,
+		CompSize:  1024,
+		FrameNum:  2048,
+		FrameSize: 2048,
+	})
+	if err != nil {
+		t.Fatalf("NewSharedUmem failed: %v", err)
+	}
+	defer shared.Close()
+	if len(descs) != 2048 || descs[1].Addr != 2048 {
+		t.Fatalf("Unexpected descs")
+	}
+
+	// lo 不支持查询队列数量，这里不载入 XDP 程序；同一网卡、同一队列上的套接字共享 fill ring 和 completion ring
+	socketConfig := DefaultComplexSocketConfig()
+	socketConfig.LibbpfFlags = XSK_LIBBPF_FLAGS__INHIBIT_PROG_LOAD
+	var first *ComplexXsk
+	err = retryOnBusy(func() (err error) {
+		first, err = shared.NewSocket("lo", 0, socketConfig)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("NewSocket failed: %v", err)
+	}
+	second, err := shared.NewSocket("lo", 0, socketConfig)
+	if err != nil {
+		t.Fatalf("NewSocket failed: %v", err)
+	}
+	if first.fill != second.fill || first.comp != second.comp {
+		t.Errorf("Expected sockets on the same queue to share fill and completion rings")
+	}
+	if first.xsk.Fd == second.xsk.Fd {
+		t.Errorf("Expected sockets to have their own fd")
+	}
+	if n := first.FillBatch(descs[:1024]); n != 1024 {
+		t.Errorf("Expected FillBatch to place 1024 descs, got %d", n)
+	}
+
+	second.Close()
+	if len(shared.sockets) != 1 || shared.umem.Refcount != 1 {
+		t.Errorf("Expected one socket left, got %d (refcount %d)", len(shared.sockets), shared.umem.Refcount)
+	}
+	shared.Close()
+	if shared.umem != nil || first.xsk != nil {
+		t.Errorf("Expected Close to release all sockets and the umem")
+	}
+	if _, err := shared.NewSocket("lo", 0, socketConfig); err == nil {
+		t.Errorf("Expected NewSocket to fail after Close")
+	}
+}
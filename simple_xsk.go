@@ -1,35 +1,43 @@
 package xsk
 
 import (
-	"container/list"
+	"context"
 	"errors"
-	"os"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"unsafe"
 
+	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/link"
 	"golang.org/x/sys/unix"
 )
 
 type SimpleXsk struct {
-	umem                 *XskUmem
-	xsk                  *XskSocket
-	fill                 XskRingProd
-	comp                 XskRingCons
-	rx                   XskRingCons
-	tx                   XskRingProd
-	rxFreeDescList       *list.List
-	txFreeDescList       *list.List
-	umemArea             []byte
-	config               SimpleXskConfig
-	recvPktChan          chan Packet
-	sendPktChan          chan Packet
-	stopRecvReadFd       int
-	stopRecvWriteFd      int
-	stopSendReadFd       int
-	stopSendWriteFd      int
-	recvStopFinishedChan chan struct{}
-	sendStopNoticeChan   chan struct{}
-	recvHandler          func([]byte)
+	umem               *XskUmem
+	xsk                *XskSocket
+	fill               XskRingProd
+	comp               XskRingCons
+	rx                 XskRingCons
+	tx                 XskRingProd
+	frames             *xskFramePool
+	txFrames           []uint64
+	rxOutstanding      int
+	rxQuota            atomic.Int64
+	umemArea           []byte
+	config             SimpleXskConfig
+	mu                 sync.Mutex     // 保护 recvLoop、sendLoop 和状态的转换
+	sockMu             sync.RWMutex   // 访问器在使用 xsk 期间持有读锁，release 持有写锁删除套接字
+	state              atomic.Uint32  // 生命周期状态（见 SIMPLE_XSK_STATE__*）
+	recvLoop           *simpleXskLoop // 正在运行的接收循环
+	sendLoop           *simpleXskLoop // 正在运行的发送循环
+	closed             chan struct{}  // 进入 SIMPLE_XSK_STATE__CLOSED 后关闭
+	releaseOnExit      bool           // 关闭时有回调函数正在运行，由最后退出的收发循环释放套接字和 umem
+	zeroCopy           bool
+	txTimestampPending map[uint64]Packet
+	rxData             uint64
+	allocator          UmemAllocator
 }
 
 // 多次 StartRecv 的错误
@@ -39,63 +47,377 @@ var ErrAnotherRecvChanRunning = errors.New("another recv chan goroutine is runni
 // 多次 StartSend 的错误，参数不会生效
 var ErrAnotherSendChanRunning = errors.New("another send chan goroutine is running, params will not work")
 
+// Shutdown 或 Close 之后启动收发循环的错误
+var ErrSimpleXskClosed = errors.New("simple xsk is closed")
+
+// RunSend 的通道被关闭时发送循环退出的原因
+var ErrSendChanClosed = errors.New("send channel closed")
+
+// errSendChanDrained 为 Shutdown 发送完通道中排队的数据包后发送循环退出的原因
+var errSendChanDrained = errors.New("send channel drained")
+
+// SimpleXskLoopError 为收发循环（RunRecv、RunSend）退出时返回的错误，记录退出的原因和退出时环的状态。
+type SimpleXskLoopError struct {
+	Op         string // "recv" 或 "send"
+	Err        error  // 退出的原因：ctx 取消时为 context.Cause(ctx)，通道关闭时为 ErrSendChanClosed，否则为 poll 的错误
+	Fill       XskRingState
+	Comp       XskRingState
+	Rx         XskRingState
+	Tx         XskRingState
+	FreeFrames int // 退出时接收和发送两侧共享的空闲帧数量
+}
+
+func (e *SimpleXskLoopError) Error() string {
+	return fmt.Sprintf("%s loop stopped: %v (fill %d/%d, comp %d/%d, rx %d/%d, tx %d/%d, free frames %d)", e.Op, e.Err,
+		e.Fill.Producer, e.Fill.Consumer, e.Comp.Producer, e.Comp.Consumer,
+		e.Rx.Producer, e.Rx.Consumer, e.Tx.Producer, e.Tx.Consumer, e.FreeFrames)
+}
+
+func (e *SimpleXskLoopError) Unwrap() error {
+	return e.Err
+}
+
+// loopError 返回收发循环因 err 退出的错误。
+func (simpleXsk *SimpleXsk) loopError(op string, err error) error {
+	return &SimpleXskLoopError{
+		Op:         op,
+		Err:        err,
+		Fill:       XskRingProdState(&simpleXsk.fill),
+		Comp:       XskRingConsState(&simpleXsk.comp),
+		Rx:         XskRingConsState(&simpleXsk.rx),
+		Tx:         XskRingProdState(&simpleXsk.tx),
+		FreeFrames: simpleXsk.frames.Len(),
+	}
+}
+
+// socket 以读锁锁定并返回 SimpleXsk 的套接字，调用者使用完后调用 sockMu.RUnlock，期间 release 不会删除套接字。
+// 已关闭时不持有锁，返回 ErrSimpleXskClosed。
+func (simpleXsk *SimpleXsk) socket() (*XskSocket, error) {
+	simpleXsk.sockMu.RLock()
+	if simpleXsk.xsk == nil {
+		simpleXsk.sockMu.RUnlock()
+		return nil, ErrSimpleXskClosed
+	}
+	return simpleXsk.xsk, nil
+}
+
+// Fd 返回套接字的文件描述符，已关闭时返回 -1。
 func (simpleXsk *SimpleXsk) Fd() int {
-	return simpleXsk.xsk.Fd
+	xsk, err := simpleXsk.socket()
+	if err != nil {
+		return -1
+	}
+	defer simpleXsk.sockMu.RUnlock()
+	return xsk.Fd
+}
+
+// ZeroCopy 返回套接字是否以零拷贝模式运行，复制模式下的吞吐量通常明显更低。
+func (simpleXsk *SimpleXsk) ZeroCopy() bool {
+	return simpleXsk.zeroCopy
+}
+
+// XdpAttachMode 返回网卡上 XDP 程序实际的挂载模式（见 XskSocket.XdpAttachMode）。
+func (simpleXsk *SimpleXsk) XdpAttachMode() (link.XDPAttachFlags, error) {
+	xsk, err := simpleXsk.socket()
+	if err != nil {
+		return 0, err
+	}
+	defer simpleXsk.sockMu.RUnlock()
+	return xsk.XdpAttachMode()
+}
+
+// UpdateXskmap 以 key 为键把套接字写入调用者的 xsksMap（见 XskSocketUpdateXskmapKey），Close 时删除。
+func (simpleXsk *SimpleXsk) UpdateXskmap(xsksMap *ebpf.Map, key uint32) error {
+	xsk, err := simpleXsk.socket()
+	if err != nil {
+		return err
+	}
+	defer simpleXsk.sockMu.RUnlock()
+	return XskSocketUpdateXskmapKey(xsk, xsksMap, key)
+}
+
+// Filter 返回默认程序的过滤规则表（见 XskSocketGetFilter），需要在 LibbpfFlags 中设置 XSK_LIBBPF_FLAGS__FILTER。
+func (simpleXsk *SimpleXsk) Filter() (*XskFilter, error) {
+	xsk, err := simpleXsk.socket()
+	if err != nil {
+		return nil, err
+	}
+	defer simpleXsk.sockMu.RUnlock()
+	return XskSocketGetFilter(xsk)
+}
+
+// SetSampleConfig 修改套接字所在队列的采样配置（见 XskSocketSetSampleConfig），需要在 LibbpfFlags 中设置 XSK_LIBBPF_FLAGS__SAMPLE。
+func (simpleXsk *SimpleXsk) SetSampleConfig(config XskSampleConfig) error {
+	xsk, err := simpleXsk.socket()
+	if err != nil {
+		return err
+	}
+	defer simpleXsk.sockMu.RUnlock()
+	return XskSocketSetSampleConfig(xsk, config)
+}
+
+// SampleConfig 返回套接字所在队列的采样配置。
+func (simpleXsk *SimpleXsk) SampleConfig() (XskSampleConfig, error) {
+	xsk, err := simpleXsk.socket()
+	if err != nil {
+		return XskSampleConfig{}, err
+	}
+	defer simpleXsk.sockMu.RUnlock()
+	return XskSocketGetSampleConfig(xsk)
+}
+
+// SampleStats 返回套接字所在队列的采样统计。
+func (simpleXsk *SimpleXsk) SampleStats() (XskSampleStats, error) {
+	xsk, err := simpleXsk.socket()
+	if err != nil {
+		return XskSampleStats{}, err
+	}
+	defer simpleXsk.sockMu.RUnlock()
+	return XskSocketGetSampleStats(xsk)
+}
+
+// Fanout 返回套接字所在队列的分发表（见 XskSocketGetFanout），需要在 LibbpfFlags 中设置 XSK_LIBBPF_FLAGS__FANOUT。
+func (simpleXsk *SimpleXsk) Fanout() (*XskFanout, error) {
+	xsk, err := simpleXsk.socket()
+	if err != nil {
+		return nil, err
+	}
+	defer simpleXsk.sockMu.RUnlock()
+	return XskSocketGetFanout(xsk)
+}
+
+// FanoutSlot 返回套接字在队列中占用的分发槽位。
+func (simpleXsk *SimpleXsk) FanoutSlot() (uint32, error) {
+	xsk, err := simpleXsk.socket()
+	if err != nil {
+		return 0, err
+	}
+	defer simpleXsk.sockMu.RUnlock()
+	return XskSocketFanoutSlot(xsk)
+}
+
+// KickTx 通知内核发送 tx ring 中已提交的描述符（见 XskSocketKickTx），发送协程会在提交后自动调用。已关闭时返回 ErrSimpleXskClosed。
+func (simpleXsk *SimpleXsk) KickTx() error {
+	xsk, err := simpleXsk.socket()
+	if err != nil {
+		return err
+	}
+	defer simpleXsk.sockMu.RUnlock()
+	return XskSocketKickTx(xsk)
+}
+
+// WakeupRx 在 fill ring 需要唤醒时唤醒内核接收（见 XskSocketWakeupRx），接收协程会在填充 fill ring 后自动调用。
+func (simpleXsk *SimpleXsk) WakeupRx() error {
+	xsk, err := simpleXsk.socket()
+	if err != nil {
+		return err
+	}
+	defer simpleXsk.sockMu.RUnlock()
+	return XskSocketWakeupRx(xsk)
+}
+
+// WakeupStats 返回套接字唤醒内核的次数，已关闭时返回 0。
+func (simpleXsk *SimpleXsk) WakeupStats() XskWakeupStats {
+	xsk, err := simpleXsk.socket()
+	if err != nil {
+		return XskWakeupStats{}
+	}
+	defer simpleXsk.sockMu.RUnlock()
+	return XskSocketGetWakeupStats(xsk)
+}
+
+// Statistics 返回套接字的统计信息（见 XskSocket.Statistics）。
+// 已关闭时返回 ErrSimpleXskClosed。接收速率低于发送速率时，Rx_fill_ring_empty_descs 增长说明 fill ring 补充不及时，Rx_ring_full 增长说明 rx ring 处理不及时。
+func (simpleXsk *SimpleXsk) Statistics() (unix.XDPStatistics, error) {
+	xsk, err := simpleXsk.socket()
+	if err != nil {
+		return unix.XDPStatistics{}, err
+	}
+	defer simpleXsk.sockMu.RUnlock()
+	return xsk.Statistics()
+}
+
+// RxMetadata 返回当前正在处理的数据包的 RX 元数据，只能在 StartRecv 的处理函数中调用，
+// 需要在 LibbpfFlags 中设置 XSK_LIBBPF_FLAGS__RX_METADATA。元数据不可用时返回 false。
+func (simpleXsk *SimpleXsk) RxMetadata() (XskRxMetadata, bool) {
+	if simpleXsk.config.LibbpfFlags&XSK_LIBBPF_FLAGS__RX_METADATA == 0 {
+		return XskRxMetadata{}, false
+	}
+	return XskGetRxMetadata(simpleXsk.umemArea, simpleXsk.rxData)
+}
+
+// rxQuotaLimits 返回接收侧可以占用的帧数量的下限、上限和每次调整的步长。
+// 两侧都至少保留 NumFrames/8 个帧，保证在另一侧繁忙时仍然可以继续收发。
+func (simpleXsk *SimpleXsk) rxQuotaLimits() (minQuota int64, maxQuota int64, step int64) {
+	minQuota = int64(simpleXsk.config.NumFrames / 8)
+	if minQuota == 0 {
+		minQuota = 1
+	}
+	step = int64(simpleXsk.config.NumFrames / 16)
+	if step == 0 {
+		step = 1
+	}
+	return minQuota, int64(simpleXsk.config.NumFrames) - minQuota, step
+}
+
+// adjustRxQuota 调整接收侧可以占用的帧数量（填充环和接收环中的帧），结果限制在 rxQuotaLimits 之间。
+// 接收繁忙时由接收协程增加，发送侧缺少空闲帧时由发送协程减少。
+func (simpleXsk *SimpleXsk) adjustRxQuota(delta int64) {
+	minQuota, maxQuota, _ := simpleXsk.rxQuotaLimits()
+	for {
+		quota := simpleXsk.rxQuota.Load()
+		next := quota + delta
+		if next < minQuota {
+			next = minQuota
+		}
+		if next > maxQuota {
+			next = maxQuota
+		}
+		if next == quota || simpleXsk.rxQuota.CompareAndSwap(quota, next) {
+			return
+		}
+	}
 }
 
+// populateFillRing 从共享的空闲帧中取出帧填充到填充环，接收侧占用的帧数量不超过 rxQuota。
 func (simpleXsk *SimpleXsk) populateFillRing() {
+	want := int(simpleXsk.rxQuota.Load()) - simpleXsk.rxOutstanding
+	if free := simpleXsk.frames.Len(); want > free {
+		want = free
+	}
+	if want <= 0 {
+		return
+	}
 	pos := uint32(0)
-	nb := XskRingProdReserve(&simpleXsk.fill, uint32(simpleXsk.rxFreeDescList.Len()), &pos)
-	for i := uint32(0); i < nb; i++ {
-		*XskRingProdFillAddr(&simpleXsk.fill, pos+i) = simpleXsk.rxFreeDescList.Remove(simpleXsk.rxFreeDescList.Front()).(uint64)
+	nb := XskRingProdReserve(&simpleXsk.fill, uint32(want), &pos)
+	n := uint32(0)
+	for ; n < nb; n++ {
+		frame, ok := simpleXsk.frames.Get()
+		if !ok {
+			// 空闲帧同时被发送协程取走
+			break
+		}
+		*XskRingProdFillAddr(&simpleXsk.fill, pos+n) = frame
 	}
-	XskRingProdSubmit(&simpleXsk.fill, nb)
+	XskRingProdCancel(&simpleXsk.fill, nb-n)
+	XskRingProdSubmit(&simpleXsk.fill, n)
+	simpleXsk.rxOutstanding += int(n)
 }
 
+// StartRecv 在新的协程中运行接收循环（见 RunRecv），直到调用 StopRecv、Shutdown 或 Close。
 func (simpleXsk *SimpleXsk) StartRecv(chanBuffSize int32, pollTimeout int, recvHandler func([]byte)) error {
-	if simpleXsk.recvHandler != nil {
-		return ErrAnotherRecvRunning
-	}
-	simpleXsk.recvHandler = recvHandler
-	simpleXsk.recvStopFinishedChan = make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := simpleXsk.startRecv(ctx, &simpleXskLoop{cancel: cancel, finished: make(chan struct{})}, pollTimeout, recvHandler)
+	return err
+}
 
-	// 创建管道用于停止信号
-	r, w, err := os.Pipe()
+// startRecv 登记 loop 并在新的协程中运行接收循环，loop.pkts 不为 nil 时（StartRecvChan）循环退出后关闭该通道。
+// 已有接收循环时返回正在运行的循环和 ErrAnotherRecvRunning。
+func (simpleXsk *SimpleXsk) startRecv(ctx context.Context, loop *simpleXskLoop, pollTimeout int, recvHandler func([]byte)) (*simpleXskLoop, error) {
+	wake, err := newXskCancelFd(ctx)
 	if err != nil {
-		panic(err)
+		loop.cancel()
+		return nil, err
+	}
+	if running, err := simpleXsk.startLoop(&simpleXsk.recvLoop, loop, ErrAnotherRecvRunning); err != nil {
+		wake.close()
+		loop.cancel()
+		return running, err
 	}
-	simpleXsk.stopRecvReadFd = int(r.Fd())
-	simpleXsk.stopRecvWriteFd = int(w.Fd())
 
 	go func() {
-		defer r.Close()
-		defer w.Close()
-		defer close(simpleXsk.recvStopFinishedChan)
-		for {
-			pos := uint32(0)
-			nPkts := XskRingConsPeek(&simpleXsk.rx, uint32(simpleXsk.config.NumFrames/2), &pos)
-			for i := uint32(0); i < nPkts; i++ {
-				desc := XskRingConsRxDesc(&simpleXsk.rx, pos+i)
-				recvHandler(simpleXsk.umemArea[desc.Addr : desc.Addr+uint64(desc.Len)])
-				simpleXsk.rxFreeDescList.PushBack(desc.Addr)
+		simpleXsk.runRecv(ctx, loop, wake, pollTimeout, recvHandler)
+		wake.close()
+		if loop.pkts != nil {
+			close(loop.pkts)
+		}
+		simpleXsk.endLoop(&simpleXsk.recvLoop, loop)
+	}()
+	return loop, nil
+}
+
+// RunRecv 在当前协程中运行接收循环：从 rx ring 取出数据包交给 recvHandler，然后补充 fill ring 并以 poll 等待新的数据包，
+// pollTimeout 为每次 poll 的超时时间（毫秒）。ctx 被取消或出现错误时返回 *SimpleXskLoopError，其中包含退出原因和环的状态，
+// 可以通过 errors.Is(err, context.Canceled) 判断是否因 ctx 取消而退出。StopRecv、Shutdown 和 Close 也会让 RunRecv 返回。
+// 同一时间只能运行一个接收循环，已有接收循环（包括 StartRecv）时返回 ErrAnotherRecvRunning，已关闭时返回 ErrSimpleXskClosed。
+func (simpleXsk *SimpleXsk) RunRecv(ctx context.Context, pollTimeout int, recvHandler func([]byte)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wake, err := newXskCancelFd(ctx)
+	if err != nil {
+		return err
+	}
+	defer wake.close()
+	loop := &simpleXskLoop{cancel: cancel, finished: make(chan struct{})}
+	if _, err := simpleXsk.startLoop(&simpleXsk.recvLoop, loop, ErrAnotherRecvRunning); err != nil {
+		return err
+	}
+	defer simpleXsk.endLoop(&simpleXsk.recvLoop, loop)
+	return simpleXsk.runRecv(ctx, loop, wake, pollTimeout, recvHandler)
+}
+
+// runRecv 为 loop 的接收循环，ctx 取消时 wake 唤醒阻塞的 poll。
+func (simpleXsk *SimpleXsk) runRecv(ctx context.Context, loop *simpleXskLoop, wake *xskCancelFd, pollTimeout int, recvHandler func([]byte)) error {
+	// 多缓冲区模式下，一个数据包的多个片段会被拼接到 jumbo 中，跨批次时保留已拼接的部分
+	var jumbo []byte
+	for {
+		pos := uint32(0)
+		nPkts := XskRingConsPeek(&simpleXsk.rx, uint32(simpleXsk.config.NumFrames/2), &pos)
+		if nPkts > 0 && int(nPkts)*2 >= simpleXsk.rxOutstanding {
+			// 一批就取走了一半以上的填充帧，接收繁忙，从发送侧借用更多的帧
+			_, _, step := simpleXsk.rxQuotaLimits()
+			simpleXsk.adjustRxQuota(step)
+		}
+		for i := uint32(0); i < nPkts; i++ {
+			desc := XskRingConsRxDesc(&simpleXsk.rx, pos+i)
+			data := XskUmemDataAddr(simpleXsk.umem, desc.Addr)
+			frag := simpleXsk.umemArea[data : data+uint64(desc.Len)]
+			if len(jumbo) == 0 {
+				// RX 元数据位于数据包第一个片段之前
+				simpleXsk.rxData = data
+			}
+			if desc.Options&unix.XDP_PKT_CONTD == 0 && len(jumbo) == 0 {
+				// 单个描述符即为完整的数据包，直接交给处理函数，无需拷贝
+				loop.inCallback.Store(true)
+				recvHandler(frag)
+				loop.inCallback.Store(false)
+			} else {
+				jumbo = append(jumbo, frag...)
+				if desc.Options&unix.XDP_PKT_CONTD == 0 {
+					loop.inCallback.Store(true)
+					recvHandler(jumbo)
+					loop.inCallback.Store(false)
+					jumbo = jumbo[:0]
+				}
 			}
-			XskRingConsRelease(&simpleXsk.rx, nPkts)
-			simpleXsk.populateFillRing()
-			pollFds := []unix.PollFd{{
-				Fd:     int32(simpleXsk.xsk.Fd),
-				Events: unix.POLLIN,
-			}, {
-				Fd:     int32(simpleXsk.stopRecvReadFd),
-				Events: unix.POLLIN,
-			}}
-			unix.Poll(pollFds, pollTimeout)
-			if pollFds[1].Revents&unix.POLLIN != 0 {
-				// 收到停止信号
-				return
+			simpleXsk.frames.Put(XskUmemFrameAddr(simpleXsk.umem, desc.Addr))
+		}
+		XskRingConsRelease(&simpleXsk.rx, nPkts)
+		simpleXsk.rxOutstanding -= int(nPkts)
+		simpleXsk.populateFillRing()
+		// 复制模式下 poll 不会唤醒驱动消费 fill ring，需要显式唤醒；忙轮询模式下由 recvfrom 驱动 NAPI，不再 poll
+		XskSocketWakeupRx(simpleXsk.xsk)
+		if XskSocketBusyPoll(simpleXsk.xsk) {
+			if ctx.Err() != nil {
+				return simpleXsk.loopError("recv", context.Cause(ctx))
 			}
+			continue
 		}
-	}()
-	return nil
+		pollFds := []unix.PollFd{{
+			Fd:     int32(simpleXsk.xsk.Fd),
+			Events: unix.POLLIN,
+		}, {
+			Fd:     int32(wake.fd),
+			Events: unix.POLLIN,
+		}}
+		if _, err := unix.Poll(pollFds, pollTimeout); err != nil && err != unix.EINTR {
+			return simpleXsk.loopError("recv", err)
+		}
+		if pollFds[1].Revents&unix.POLLIN != 0 {
+			// ctx 被取消
+			return simpleXsk.loopError("recv", context.Cause(ctx))
+		}
+	}
 }
 
 // StartRecvChan 初始化并启动一个接收数据包的通道，具有指定的缓冲区大小和轮询超时。
@@ -112,56 +434,91 @@ func (simpleXsk *SimpleXsk) StartRecv(chanBuffSize int32, pollTimeout int, recvH
 //
 // 如果一个接收通道已经在运行，它将返回现有的通道，并返回一个错误，指示另一个接收通道已经在运行。
 // 如果过滤函数为 nil，则使用一个接受所有数据包的默认过滤器。
+// 超过 MaxPacketDataSize 的数据包（多缓冲区模式下的巨型帧）以 JumboPacket 的形式发送到通道中。
+// 接收循环停止后通道被关闭，停止时正在等待写入通道的数据包被丢弃。
 func (simpleXsk *SimpleXsk) StartRecvChan(chanBuffSize int32, pollTimeout int, filter func([]byte) bool) (<-chan Packet, error) {
-	if simpleXsk.recvPktChan != nil {
-		return simpleXsk.recvPktChan, ErrAnotherRecvChanRunning
-	}
 	if filter == nil {
 		filter = func([]byte) bool { return true }
 	}
-	simpleXsk.recvPktChan = make(chan Packet, chanBuffSize)
+	ctx, cancel := context.WithCancel(context.Background())
+	pkts := make(chan Packet, chanBuffSize)
 	recvHandler := func(desc []byte) {
 		if !filter(desc) {
 			return
 		}
-		pkt := new(SimplePacket)
+		var pkt Packet
+		if len(desc) > MaxPacketDataSize {
+			pkt = new(JumboPacket)
+		} else {
+			pkt = new(SimplePacket)
+		}
 		pkt.SetData(desc)
-		simpleXsk.recvPktChan <- pkt
+		select {
+		case pkts <- pkt:
+		case <-ctx.Done():
+		}
 	}
-	err := simpleXsk.StartRecv(chanBuffSize, pollTimeout, recvHandler)
-	if err != nil {
-		close(simpleXsk.recvPktChan)
+	loop := &simpleXskLoop{cancel: cancel, finished: make(chan struct{}), pkts: pkts}
+	if running, err := simpleXsk.startRecv(ctx, loop, pollTimeout, recvHandler); err != nil {
+		if running != nil && running.pkts != nil {
+			return running.pkts, ErrAnotherRecvChanRunning
+		}
 		return nil, err
 	}
-	return simpleXsk.recvPktChan, nil
+	return pkts, nil
 }
 
-// StopRecv 停止接收数据包，用来关闭 StartRecvChan 或 StartRecv 。
+// StopRecv 停止接收数据包，用来关闭 StartRecvChan、StartRecv 或 RunRecv，返回时接收循环已经退出。
+// 接收循环正在运行处理函数时（包括在处理函数中调用）只取消循环，处理函数返回后循环退出。
 func (simpleXsk *SimpleXsk) StopRecv() {
-	if simpleXsk.recvHandler != nil {
-		unix.Write(simpleXsk.stopRecvWriteFd, []byte{1})
-		<-simpleXsk.recvStopFinishedChan
-		simpleXsk.recvStopFinishedChan = nil
-		simpleXsk.recvHandler = nil
-		if simpleXsk.recvPktChan != nil {
-			close(simpleXsk.recvPktChan)
-			simpleXsk.recvPktChan = nil
-		}
-	}
+	simpleXsk.stopLoop(&simpleXsk.recvLoop, true)
 }
 
-func (simpleXsk *SimpleXsk) recycleCompRing() {
+// recycleCompRing 回收 completion ring 中的帧，请求了时间戳的数据包调用 TxTimestampHandler。
+// loop 为运行回调函数的发送循环，不在发送循环中调用时为 nil。
+func (simpleXsk *SimpleXsk) recycleCompRing(loop *simpleXskLoop) {
 	pos := uint32(0)
-	nPkts := XskRingConsPeek(&simpleXsk.comp, uint32(simpleXsk.config.NumFrames/2), &pos)
+	nPkts := XskRingConsPeek(&simpleXsk.comp, uint32(simpleXsk.config.NumFrames), &pos)
 	for i := uint32(0); i < nPkts; i++ {
-		simpleXsk.txFreeDescList.PushBack(*XskRingConsCompAddr(&simpleXsk.comp, pos+i))
+		addr := *XskRingConsCompAddr(&simpleXsk.comp, pos+i)
+		frame := XskUmemFrameAddr(simpleXsk.umem, addr)
+		if pkt, ok := simpleXsk.txTimestampPending[frame]; ok {
+			delete(simpleXsk.txTimestampPending, frame)
+			ts, _ := XskUmemTxMetadata(simpleXsk.umem, addr).TxTimestamp()
+			if loop != nil {
+				loop.inCallback.Store(true)
+			}
+			simpleXsk.config.TxTimestampHandler(pkt, ts)
+			if loop != nil {
+				loop.inCallback.Store(false)
+			}
+		}
+		simpleXsk.frames.Put(frame)
 	}
 	XskRingConsRelease(&simpleXsk.comp, nPkts)
 }
 
+// takeTxFrames 从共享的空闲帧中取出帧，直到发送协程持有的帧达到 n 个或没有空闲帧。
+func (simpleXsk *SimpleXsk) takeTxFrames(n uint32) {
+	for uint32(len(simpleXsk.txFrames)) < n {
+		frame, ok := simpleXsk.frames.Get()
+		if !ok {
+			return
+		}
+		simpleXsk.txFrames = append(simpleXsk.txFrames, frame)
+	}
+}
+
+// returnTxFrames 将发送协程持有但没有使用的帧放回共享的空闲帧中，供接收侧使用。
+func (simpleXsk *SimpleXsk) returnTxFrames() {
+	for _, frame := range simpleXsk.txFrames {
+		simpleXsk.frames.Put(frame)
+	}
+	simpleXsk.txFrames = simpleXsk.txFrames[:0]
+}
+
 // StartSendChan 初始化并启动一个发送数据包的通道。
-// 它创建一个用于数据包的缓冲通道和一个停止通知通道。
-// 它还设置了一个用于处理停止信号的管道，并启动一个 goroutine 来处理发送通道中的数据包。
+// 它创建一个用于数据包的缓冲通道，并启动一个 goroutine 运行发送循环（见 RunSend）来处理发送通道中的数据包。
 //
 // 参数:
 // - chanBuffSize: 数据包缓冲通道的大小。
@@ -173,124 +530,401 @@ func (simpleXsk *SimpleXsk) recycleCompRing() {
 // - error: 如果另一个发送通道已经在运行，则返回错误。
 //
 // 如果一个发送通道已经在运行，它将返回现有的通道，并返回一个错误，指示另一个发送通道已经在运行。
-// 如果发送通道被外部关闭，goroutine 将清理资源并退出。
+// 发送通道只能由调用者关闭，关闭后 goroutine 发送完通道中的数据包并退出。StopSendChan、Shutdown 和 Close 不会关闭通道，
+// 停止之后写入通道的数据包不会被发送。
 func (simpleXsk *SimpleXsk) StartSendChan(chanBuffSize int32, pollTimeout int, postProcess func(Packet)) (chan<- Packet, error) {
-	if simpleXsk.sendPktChan != nil {
-		return simpleXsk.sendPktChan, ErrAnotherSendChanRunning
+	ctx, cancel := context.WithCancel(context.Background())
+	wake, err := newXskCancelFd(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
 	}
-	simpleXsk.sendPktChan = make(chan Packet, chanBuffSize)
-	simpleXsk.sendStopNoticeChan = make(chan struct{})
+	pkts := make(chan Packet, chanBuffSize)
+	loop := &simpleXskLoop{cancel: cancel, finished: make(chan struct{}), pkts: pkts, drain: make(chan struct{})}
+	if running, err := simpleXsk.startLoop(&simpleXsk.sendLoop, loop, ErrAnotherSendChanRunning); err != nil {
+		wake.close()
+		cancel()
+		if running != nil && running.pkts != nil {
+			return running.pkts, err
+		}
+		return nil, err
+	}
+
+	go func() {
+		simpleXsk.runSend(ctx, loop, wake, pollTimeout, pkts, postProcess)
+		wake.close()
+		simpleXsk.endLoop(&simpleXsk.sendLoop, loop)
+	}()
+	return pkts, nil
+}
 
-	// 创建管道用于停止信号
-	r, w, err := os.Pipe()
+// RunSend 在当前协程中运行发送循环：从 pkts 中取出数据包写入 tx ring 并通知内核发送，tx ring 或空闲帧不足时以 poll 等待，
+// pollTimeout 为每次 poll 的超时时间（毫秒），每个数据包写入后调用 postProcess（可以为 nil）。
+// ctx 被取消、pkts 被关闭（ErrSendChanClosed）或出现错误时返回 *SimpleXskLoopError，其中包含退出原因和环的状态。
+// StopSendChan、Shutdown 和 Close 也会让 RunSend 返回。退出时尚未写入 tx ring 的数据包被丢弃，已提交的数据包仍会由内核发送。
+// 同一时间只能运行一个发送循环，已有发送循环（包括 StartSendChan）时返回 ErrAnotherSendChanRunning，已关闭时返回 ErrSimpleXskClosed。
+func (simpleXsk *SimpleXsk) RunSend(ctx context.Context, pollTimeout int, pkts <-chan Packet, postProcess func(Packet)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wake, err := newXskCancelFd(ctx)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	defer wake.close()
+	loop := &simpleXskLoop{cancel: cancel, finished: make(chan struct{})}
+	if _, err := simpleXsk.startLoop(&simpleXsk.sendLoop, loop, ErrAnotherSendChanRunning); err != nil {
+		return err
 	}
-	simpleXsk.stopSendReadFd = int(r.Fd())
-	simpleXsk.stopSendWriteFd = int(w.Fd())
+	defer simpleXsk.endLoop(&simpleXsk.sendLoop, loop)
+	return simpleXsk.runSend(ctx, loop, wake, pollTimeout, pkts, postProcess)
+}
 
-	go func() {
-		defer r.Close()
-		defer w.Close()
-		defer close(simpleXsk.sendPktChan)
-		for {
+// runSend 为 loop 的发送循环，ctx 取消时 wake 唤醒阻塞的 poll。
+// loop.drain 被关闭后只发送 pkts 中已经排队的数据包，通道为空时退出。
+func (simpleXsk *SimpleXsk) runSend(ctx context.Context, loop *simpleXskLoop, wake *xskCancelFd, pollTimeout int, pkts <-chan Packet, postProcess func(Packet)) error {
+	// 上一批中因 tx ring 剩余空间不足而没有写入的数据包
+	var pending Packet
+	draining := false
+	for {
+		var pkt Packet
+		if pending != nil {
+			pkt = pending
+			pending = nil
+		} else if draining {
 			select {
-			case <-simpleXsk.sendStopNoticeChan:
-				return
-			case pkt, ok := <-simpleXsk.sendPktChan:
+			case p, ok := <-pkts:
 				if !ok {
-					// 被外界关闭
-					simpleXsk.sendPktChan = nil
-					close(simpleXsk.sendStopNoticeChan)
-					simpleXsk.sendStopNoticeChan = nil
-					return
+					return simpleXsk.loopError("send", ErrSendChanClosed)
 				}
-				for {
-					simpleXsk.recycleCompRing()
-					if simpleXsk.txFreeDescList.Len() > 0 {
-						break
-					}
+				pkt = p
+			default:
+				return simpleXsk.loopError("send", errSendChanDrained)
+			}
+		} else {
+			select {
+			case <-ctx.Done():
+				return simpleXsk.loopError("send", context.Cause(ctx))
+			case <-loop.drain:
+				draining = true
+				continue
+			case p, ok := <-pkts:
+				if !ok {
+					return simpleXsk.loopError("send", ErrSendChanClosed)
 				}
-				pktNum := len(simpleXsk.sendPktChan) + 1 // 加上当前接收到的包
-				// 此时，至少有一个
-				if pktNum > simpleXsk.txFreeDescList.Len() {
-					pktNum = simpleXsk.txFreeDescList.Len()
+				pkt = p
+			}
+		}
+		need := simpleXsk.txFrags(pkt)
+		if need == 0 {
+			// 无法发送的数据包（空数据包、超过帧大小且未开启多缓冲区，或超过全部 tx 帧），直接丢弃
+			if postProcess != nil {
+				loop.inCallback.Store(true)
+				postProcess(pkt)
+				loop.inCallback.Store(false)
+			}
+			continue
+		}
+		starved := false
+		for {
+			simpleXsk.recycleCompRing(loop)
+			simpleXsk.takeTxFrames(need)
+			if uint32(len(simpleXsk.txFrames)) >= need {
+				break
+			}
+			if !starved {
+				// 空闲帧被接收侧占用，减少接收侧的配额，接收侧处理完数据包后不再补充这部分帧
+				starved = true
+				_, _, step := simpleXsk.rxQuotaLimits()
+				simpleXsk.adjustRxQuota(-step)
+			}
+			// tx ring 中的描述符发送后帧才会回到 completion ring
+			XskSocketKickTx(simpleXsk.xsk)
+			if err := simpleXsk.sendStarvedWait(ctx, wake, pollTimeout); err != nil {
+				return err
+			}
+		}
+		for {
+			pos := uint32(0)
+			// 尽可能多地预留描述符，批量写入通道中已经排队的数据包
+			nb := XskProdNbFree(&simpleXsk.tx, need)
+			simpleXsk.takeTxFrames(nb)
+			if nb > uint32(len(simpleXsk.txFrames)) {
+				nb = uint32(len(simpleXsk.txFrames))
+			}
+			if nb < need {
+				nb = 0
+			} else {
+				nb = XskRingProdReserve(&simpleXsk.tx, nb, &pos)
+			}
+			if nb == 0 {
+				// 预留失败，通知内核发送并回收空间，然后继续等待
+				XskSocketKickTx(simpleXsk.xsk)
+				simpleXsk.recycleCompRing(loop)
+				if err := simpleXsk.sendWait(ctx, wake, pollTimeout); err != nil {
+					return err
 				}
-				for {
-					pos := uint32(0)
-					nb := XskRingProdReserve(&simpleXsk.tx, uint32(pktNum), &pos)
-					if nb == 0 {
-						// 预留失败，回收空间并继续等待
-						simpleXsk.recycleCompRing()
-						pollFds := []unix.PollFd{{
-							Fd:     int32(simpleXsk.xsk.Fd),
-							Events: unix.POLLOUT,
-						}, {
-							Fd:     int32(simpleXsk.stopSendReadFd),
-							Events: unix.POLLIN,
-						}}
-						unix.Poll(pollFds, pollTimeout)
-						if pollFds[1].Revents&unix.POLLIN != 0 {
-							// 收到停止信号
-							<-simpleXsk.sendStopNoticeChan
-							return
-						}
-						continue
-					}
-					// 预留成功
-					for i := uint32(0); i < nb; i++ {
-						var currentPkt Packet
-						if i == 0 {
-							currentPkt = pkt
-						} else {
-							currentPkt = <-simpleXsk.sendPktChan
-						}
-						addr := simpleXsk.txFreeDescList.Remove(simpleXsk.txFreeDescList.Front()).(uint64)
-						XskRingProdTxDesc(&simpleXsk.tx, pos+i).Addr = addr
-						XskRingProdTxDesc(&simpleXsk.tx, pos+i).Len = uint32(currentPkt.Len())
-						copy(simpleXsk.umemArea[addr:addr+uint64(currentPkt.Len())], currentPkt.Data())
-						if postProcess != nil {
-							postProcess(currentPkt)
-						}
-					}
-					XskRingProdSubmit(&simpleXsk.tx, nb)
-					pollFds := []unix.PollFd{{
-						Fd:     int32(simpleXsk.xsk.Fd),
-						Events: unix.POLLOUT,
-					}, {
-						Fd:     int32(simpleXsk.stopSendReadFd),
-						Events: unix.POLLIN,
-					}}
-					unix.Poll(pollFds, pollTimeout)
-					if pollFds[1].Revents&unix.POLLIN != 0 {
-						// 收到停止信号
-						<-simpleXsk.sendStopNoticeChan
-						return
-					}
+				continue
+			}
+			// 预留成功
+			used := uint32(0)
+			queued := len(pkts)
+			currentPkt := pkt
+			for {
+				used += simpleXsk.writeTxPacket(pos+used, currentPkt)
+				if postProcess != nil {
+					loop.inCallback.Store(true)
+					postProcess(currentPkt)
+					loop.inCallback.Store(false)
+				}
+				if queued == 0 {
+					break
+				}
+				currentPkt = <-pkts
+				queued--
+				if frags := simpleXsk.txFrags(currentPkt); frags == 0 || frags > nb-used {
+					// 留到下一批处理
+					pending = currentPkt
 					break
 				}
 			}
+			XskRingProdCancel(&simpleXsk.tx, nb-used)
+			XskRingProdSubmit(&simpleXsk.tx, used)
+			simpleXsk.returnTxFrames()
+			XskSocketKickTx(simpleXsk.xsk)
+			if err := simpleXsk.sendWait(ctx, wake, pollTimeout); err != nil {
+				return err
+			}
+			break
 		}
-	}()
-	return simpleXsk.sendPktChan, nil
+	}
+}
+
+// sendWait 以 poll 等待 tx ring 中有空闲的位置，忙轮询模式下由 sendto 驱动 NAPI，不再 poll，只检查 ctx。
+// ctx 被取消或 poll 出错时返回循环退出的错误。
+func (simpleXsk *SimpleXsk) sendWait(ctx context.Context, wake *xskCancelFd, pollTimeout int) error {
+	if XskSocketBusyPoll(simpleXsk.xsk) {
+		if ctx.Err() != nil {
+			return simpleXsk.loopError("send", context.Cause(ctx))
+		}
+		return nil
+	}
+	pollFds := []unix.PollFd{{
+		Fd:     int32(simpleXsk.xsk.Fd),
+		Events: unix.POLLOUT,
+	}, {
+		Fd:     int32(wake.fd),
+		Events: unix.POLLIN,
+	}}
+	if _, err := unix.Poll(pollFds, pollTimeout); err != nil && err != unix.EINTR {
+		return simpleXsk.loopError("send", err)
+	}
+	if pollFds[1].Revents&unix.POLLIN != 0 {
+		// ctx 被取消
+		return simpleXsk.loopError("send", context.Cause(ctx))
+	}
+	return nil
+}
+
+// simpleXskStarvedPollTimeout 为空闲帧全部被接收侧占用时每次等待的时间（毫秒）
+const simpleXskStarvedPollTimeout = 1
+
+// sendStarvedWait 在发送侧缺少空闲帧时等待帧被归还，ctx 被取消或 poll 出错时返回循环退出的错误。
+// tx ring 中还有内核没有消费的描述符时与 sendWait 相同，以 poll 等待 tx ring 可写（描述符发送后帧回到 completion ring）；
+// 否则空闲帧被接收侧占用，没有可以等待的文件描述符，只等待 ctx 被取消，最多等待 simpleXskStarvedPollTimeout 后重新检查。
+func (simpleXsk *SimpleXsk) sendStarvedWait(ctx context.Context, wake *xskCancelFd, pollTimeout int) error {
+	if XskSocketBusyPoll(simpleXsk.xsk) || XskProdNbFree(&simpleXsk.tx, simpleXsk.tx.Size) < simpleXsk.tx.Size {
+		return simpleXsk.sendWait(ctx, wake, pollTimeout)
+	}
+	if pollTimeout < 0 || pollTimeout > simpleXskStarvedPollTimeout {
+		pollTimeout = simpleXskStarvedPollTimeout
+	}
+	pollFds := []unix.PollFd{{
+		Fd:     int32(wake.fd),
+		Events: unix.POLLIN,
+	}}
+	if _, err := unix.Poll(pollFds, pollTimeout); err != nil && err != unix.EINTR {
+		return simpleXsk.loopError("send", err)
+	}
+	if pollFds[0].Revents&unix.POLLIN != 0 {
+		// ctx 被取消
+		return simpleXsk.loopError("send", context.Cause(ctx))
+	}
+	return nil
+}
+
+// txFrags 返回发送 pkt 需要的帧数量。
+// 超过帧大小的数据包只有在多缓冲区模式下才能拆分发送，否则以及需要的帧超过发送侧保证可用的帧时返回 0。
+// 空数据包同样返回 0，不会写入长度为 0 的 tx 描述符。
+func (simpleXsk *SimpleXsk) txFrags(pkt Packet) uint32 {
+	if pkt.Len() == 0 {
+		return 0
+	}
+	frameSize := simpleXsk.txFrameCapacity()
+	if pkt.Len() <= frameSize {
+		return 1
+	}
+	if !simpleXsk.config.MultiBuffer {
+		return 0
+	}
+	frags := (pkt.Len() + frameSize - 1) / frameSize
+	if minQuota, _, _ := simpleXsk.rxQuotaLimits(); frags > int(minQuota) {
+		return 0
+	}
+	return uint32(frags)
+}
+
+// txFrameCapacity 返回每个 tx 帧可以容纳的数据长度，启用 TX 元数据时帧的开头预留给元数据。
+func (simpleXsk *SimpleXsk) txFrameCapacity() int {
+	return simpleXsk.config.FrameSize - int(simpleXsk.umem.Config.TxMetadataLen)
+}
+
+// writeTxPacket 将 pkt 写入从 idx 开始的 tx 描述符中，并返回使用的描述符数量。
+// 超过帧大小的数据包会被拆分到多个帧中，除最后一个片段外都设置 XDP_PKT_CONTD。
+// 启用 TX 元数据时，TxMetadataPacket 的请求写入第一个片段之前，复制模式下校验和由软件计算。
+// 调用者需要保证空闲帧和预留的描述符足够（见 txFrags）。
+func (simpleXsk *SimpleXsk) writeTxPacket(idx uint32, pkt Packet) uint32 {
+	data := pkt.Data()
+	frameSize := simpleXsk.txFrameCapacity()
+	metaLen := uint64(simpleXsk.umem.Config.TxMetadataLen)
+	var frags [][]byte
+	var first *unix.XDPDesc
+	n := uint32(0)
+	for {
+		frag := data
+		if len(frag) > frameSize {
+			frag = frag[:frameSize]
+		}
+		frame := simpleXsk.txFrames[len(simpleXsk.txFrames)-1]
+		simpleXsk.txFrames = simpleXsk.txFrames[:len(simpleXsk.txFrames)-1]
+		desc := XskRingProdTxDesc(&simpleXsk.tx, idx+n)
+		desc.Addr = XskUmemAddrWithOffset(simpleXsk.umem, frame, metaLen)
+		desc.Len = uint32(len(frag))
+		desc.Options = 0
+		start := XskUmemDataAddr(simpleXsk.umem, desc.Addr)
+		copy(simpleXsk.umemArea[start:start+uint64(len(frag))], frag)
+		if metaLen != 0 {
+			if first == nil {
+				first = desc
+			}
+			frags = append(frags, simpleXsk.umemArea[start:start+uint64(len(frag))])
+		}
+		data = data[len(frag):]
+		n++
+		if len(data) == 0 {
+			break
+		}
+		desc.Options = unix.XDP_PKT_CONTD
+	}
+	if metaLen != 0 {
+		simpleXsk.writeTxMetadata(first, pkt, frags)
+	}
+	return n
+}
+
+// writeTxMetadata 为数据包的第一个描述符 first 写入 TX 元数据请求，frags 为数据包在 umem 中的所有片段。
+func (simpleXsk *SimpleXsk) writeTxMetadata(first *unix.XDPDesc, pkt Packet, frags [][]byte) {
+	meta := XskUmemTxMetadata(simpleXsk.umem, first.Addr)
+	metaPkt, ok := pkt.(*TxMetadataPacket)
+	if !ok {
+		// 清除帧中残留的请求，避免回收时被误认为请求了时间戳
+		*meta = XskTxMetadata{}
+		return
+	}
+	*meta = metaPkt.Request
+	if !simpleXsk.zeroCopy {
+		xskTxMetadataCopyMode(meta, frags)
+	}
+	if meta.Flags&unix.XDP_TXMD_FLAGS_TIMESTAMP != 0 && simpleXsk.config.TxTimestampHandler != nil {
+		simpleXsk.txTimestampPending[XskUmemFrameAddr(simpleXsk.umem, first.Addr)] = pkt
+	}
+	if meta.Flags != 0 {
+		first.Options |= unix.XDP_TX_METADATA
+	}
 }
 
+// StopSendChan 停止 StartSendChan 或 RunSend 的发送循环，返回时发送循环已经退出。
+// StopSendChan 不会关闭 StartSendChan 返回的发送通道（Shutdown 和 Close 同样不会），通道只能由调用者关闭：
+// 循环停止后可能仍有其他协程在写入通道，由库关闭会让这些写入 panic。停止之后写入通道的数据包不会被发送，
+// 写入无缓冲或已满的通道会一直阻塞，调用者需要在停止前结束写入，或者在写入时同时等待自己的退出信号。
+// 发送循环正在运行 postProcess 或 TxTimestampHandler 时（包括在其中调用）只取消循环，回调函数返回后循环退出。
 func (simpleXsk *SimpleXsk) StopSendChan() {
-	if simpleXsk.sendStopNoticeChan != nil {
-		unix.Write(simpleXsk.stopSendWriteFd, []byte{1})
-		simpleXsk.sendStopNoticeChan <- struct{}{}
-		close(simpleXsk.sendStopNoticeChan)
-		simpleXsk.sendStopNoticeChan = nil
+	simpleXsk.stopLoop(&simpleXsk.sendLoop, true)
+}
+
+// Shutdown 优雅地关闭 SimpleXsk，依次：
+//  1. 进入 SIMPLE_XSK_STATE__STOPPING，不再启动新的收发循环；停止接收，让 StartSendChan 启动的发送协程发送完通道中已经排队的数据包后退出；
+//  2. 不断调用 KickTx 通知内核发送，并回收 completion ring，直到所有已提交的数据包发送完成；
+//  3. 删除套接字、解除映射并卸载 XDP 程序，进入 SIMPLE_XSK_STATE__CLOSED。
+//
+// ctx 结束时跳过剩余的等待直接关闭，返回的错误包含 ctx 结束的原因（以及未完成的描述符数量）。
+// RunSend 的循环没有自己的通道可以排空，会被直接停止。已经在关闭时等待关闭完成并返回 nil。
+// 有收发循环正在运行回调函数时（包括在回调函数中调用）与 Close 相同，只取消所有收发循环并立即返回 nil，不等待发送完成。
+func (simpleXsk *SimpleXsk) Shutdown(ctx context.Context) error {
+	first, inCallback := simpleXsk.beginClose()
+	if inCallback {
+		simpleXsk.cancelLoops()
+		return nil
+	}
+	if !first {
+		<-simpleXsk.closed
+		return nil
+	}
+	simpleXsk.stopLoop(&simpleXsk.recvLoop, false)
+	var err error
+	simpleXsk.mu.Lock()
+	loop := simpleXsk.sendLoop
+	simpleXsk.mu.Unlock()
+	if loop != nil && loop.drain != nil {
+		close(loop.drain)
+		select {
+		case <-loop.finished:
+		case <-ctx.Done():
+			err = fmt.Errorf("send channel not drained: %w", context.Cause(ctx))
+		}
 	}
+	simpleXsk.stopLoop(&simpleXsk.sendLoop, false)
+	if err == nil {
+		err = xskDrainTx(ctx, simpleXsk.xsk, simpleXsk.txPending)
+	}
+	simpleXsk.release()
+	return err
+}
+
+// txPending 回收 completion ring，返回仍在 tx ring 中或等待发送完成的帧数量。
+// 所有帧要么空闲，要么被接收侧占用（rxOutstanding），要么由发送侧持有（txFrames），其余的帧都在发送中。
+func (simpleXsk *SimpleXsk) txPending() uint32 {
+	simpleXsk.recycleCompRing(nil)
+	return uint32(simpleXsk.config.NumFrames - simpleXsk.frames.Len() - simpleXsk.rxOutstanding - len(simpleXsk.txFrames))
 }
 
+// Close 停止所有收发循环，删除套接字并释放 umem，可以从任意协程多次调用，返回时已进入 SIMPLE_XSK_STATE__CLOSED。
+// 有收发循环正在运行回调函数（recvHandler、postProcess、TxTimestampHandler）时，包括在回调函数中调用，
+// 等待可能让循环永远无法退出，Close 只取消所有收发循环并立即返回；回调函数返回、所有循环退出后由最后退出的循环释放，
+// 之后进入 SIMPLE_XSK_STATE__CLOSED。
 func (simpleXsk *SimpleXsk) Close() {
-	simpleXsk.StopRecv()
-	simpleXsk.StopSendChan()
+	first, inCallback := simpleXsk.beginClose()
+	if inCallback {
+		simpleXsk.cancelLoops()
+		return
+	}
+	if !first {
+		<-simpleXsk.closed
+		return
+	}
+	simpleXsk.stopLoop(&simpleXsk.recvLoop, false)
+	simpleXsk.stopLoop(&simpleXsk.sendLoop, false)
+	simpleXsk.release()
+}
+
+// release 删除套接字并释放 umem，之后进入 SIMPLE_XSK_STATE__CLOSED。调用前所有收发循环都已退出。
+// 删除套接字前等待正在使用套接字的访问器返回（见 socket）。
+func (simpleXsk *SimpleXsk) release() {
+	simpleXsk.sockMu.Lock()
 	if simpleXsk.xsk != nil {
 		XskSocketDelete(simpleXsk.xsk)
 		simpleXsk.xsk = nil
 	}
+	simpleXsk.sockMu.Unlock()
 
 	if simpleXsk.umem != nil {
 		XskUmemDelete(simpleXsk.umem)
@@ -298,15 +932,147 @@ func (simpleXsk *SimpleXsk) Close() {
 	}
 
 	if simpleXsk.umemArea != nil {
-		unix.Munmap(simpleXsk.umemArea)
+		if err := simpleXsk.allocator.Free(simpleXsk.umemArea); err != nil {
+			xskLogger(simpleXsk.config.Logger).Warn("free umem area failed", "err", err)
+		}
 		simpleXsk.umemArea = nil
 	}
+	simpleXsk.state.Store(SIMPLE_XSK_STATE__CLOSED)
+	close(simpleXsk.closed)
+}
+
+// simpleXskLoop 记录一个正在运行的收发循环
+type simpleXskLoop struct {
+	cancel   context.CancelFunc
+	finished chan struct{} // 循环退出并注销后关闭
+	pkts     chan Packet   // StartRecvChan 和 StartSendChan 的通道
+	drain    chan struct{} // StartSendChan 的循环在 Shutdown 关闭 drain 后发送完通道中排队的数据包再退出
+	// inCallback 在循环调用 recvHandler、postProcess 和 TxTimestampHandler 期间为 true，
+	// 此时 Close、Stop* 只取消循环而不等待，回调函数中的调用不会等待自己返回
+	inCallback atomic.Bool
 }
 
+// State 返回 SimpleXsk 的生命周期状态（见 SIMPLE_XSK_STATE__*）。
+func (simpleXsk *SimpleXsk) State() uint32 {
+	return simpleXsk.state.Load()
+}
+
+// startLoop 把 loop 登记到 slot（recvLoop 或 sendLoop）上并进入 SIMPLE_XSK_STATE__RUNNING。
+// slot 上已有循环时返回该循环和 running，正在关闭或已关闭时返回 ErrSimpleXskClosed。
+func (simpleXsk *SimpleXsk) startLoop(slot **simpleXskLoop, loop *simpleXskLoop, running error) (*simpleXskLoop, error) {
+	simpleXsk.mu.Lock()
+	defer simpleXsk.mu.Unlock()
+	if simpleXsk.state.Load() >= SIMPLE_XSK_STATE__STOPPING {
+		return nil, ErrSimpleXskClosed
+	}
+	if *slot != nil {
+		return *slot, running
+	}
+	*slot = loop
+	simpleXsk.state.Store(SIMPLE_XSK_STATE__RUNNING)
+	return loop, nil
+}
+
+// endLoop 在收发循环退出时注销 loop，两个方向都没有循环时回到 SIMPLE_XSK_STATE__CREATED。
+// 注销之后才关闭 loop.finished，等待 finished 的 Stop* 返回后可以立即重新启动。
+// Close 时有回调函数正在运行时，最后退出的循环负责释放。
+func (simpleXsk *SimpleXsk) endLoop(slot **simpleXskLoop, loop *simpleXskLoop) {
+	simpleXsk.mu.Lock()
+	if *slot == loop {
+		*slot = nil
+	}
+	release := false
+	if simpleXsk.recvLoop == nil && simpleXsk.sendLoop == nil {
+		switch simpleXsk.state.Load() {
+		case SIMPLE_XSK_STATE__RUNNING:
+			simpleXsk.state.Store(SIMPLE_XSK_STATE__CREATED)
+		case SIMPLE_XSK_STATE__STOPPING:
+			release = simpleXsk.releaseOnExit
+			simpleXsk.releaseOnExit = false
+		}
+	}
+	simpleXsk.mu.Unlock()
+	close(loop.finished)
+	if release {
+		simpleXsk.release()
+	}
+}
+
+// stopLoop 取消 slot 上的收发循环并等待其退出。
+// fromCallback 为 true 时调用者可能在该循环的回调函数中，循环正在运行回调函数时只取消，等待会让循环永远无法退出。
+func (simpleXsk *SimpleXsk) stopLoop(slot **simpleXskLoop, fromCallback bool) {
+	simpleXsk.mu.Lock()
+	loop := *slot
+	simpleXsk.mu.Unlock()
+	if loop != nil {
+		loop.cancel()
+		if !fromCallback || !loop.inCallback.Load() {
+			<-loop.finished
+		}
+	}
+}
+
+// cancelLoops 取消所有收发循环，不等待其退出。
+func (simpleXsk *SimpleXsk) cancelLoops() {
+	simpleXsk.mu.Lock()
+	defer simpleXsk.mu.Unlock()
+	for _, loop := range []*simpleXskLoop{simpleXsk.recvLoop, simpleXsk.sendLoop} {
+		if loop != nil {
+			loop.cancel()
+		}
+	}
+}
+
+// beginClose 进入 SIMPLE_XSK_STATE__STOPPING，之后不能再启动收发循环。first 为 false 表示已经在关闭或已关闭。
+// inCallback 表示有收发循环正在运行回调函数，此时调用者不能等待循环退出；由本次调用进入 STOPPING 时，
+// 改由最后退出的收发循环释放（见 endLoop）。
+func (simpleXsk *SimpleXsk) beginClose() (first bool, inCallback bool) {
+	simpleXsk.mu.Lock()
+	defer simpleXsk.mu.Unlock()
+	for _, loop := range []*simpleXskLoop{simpleXsk.recvLoop, simpleXsk.sendLoop} {
+		if loop != nil && loop.inCallback.Load() {
+			inCallback = true
+		}
+	}
+	if simpleXsk.state.Load() >= SIMPLE_XSK_STATE__STOPPING {
+		return false, inCallback
+	}
+	simpleXsk.state.Store(SIMPLE_XSK_STATE__STOPPING)
+	simpleXsk.releaseOnExit = inCallback
+	return true, inCallback
+}
+
+// SimpleXskConfig 描述 SimpleXsk 的配置。
+// UmemFlags 会直接用于注册 umem，设置 unix.XDP_UMEM_UNALIGNED_CHUNK_FLAG 时使用非对齐块模式，
+// 此时 FrameSize 可以不是 2 的幂，帧依次紧密排列。
+// MultiBuffer 为 true 时以 XDP_USE_SG 绑定套接字：接收时把以 XDP_PKT_CONTD 串联的描述符拼接为一个数据包，
+// 发送时把超过 FrameSize 的数据包拆分到多个帧中，用于处理巨型帧。
+// TxMetadata 为 true 时在每个 tx 帧的开头预留 XSK_TX_METADATA_LEN 字节的 TX 元数据，
+// 发送 TxMetadataPacket 时会提交其中的请求；请求了时间戳的数据包在发送完成后调用 TxTimestampHandler（在发送协程中）。
+// 复制模式下校验和由软件计算，时间戳请求会被忽略。
+// XdpFlags 决定 XDP 程序的挂载模式，默认为 XDP_MODE_AUTO：先尝试驱动模式，失败时退回通用模式，实际模式可以通过 XdpAttachMode 查询。
+// UmemAllocator 决定 umem 区域的分配方式（大页、memfd 或调用者提供的内存），为 nil 时使用匿名映射。
+// BindMode 决定以零拷贝还是复制模式绑定（见 XSK_BIND_MODE__*），默认由内核决定。
+// BusyPoll、BusyPollBudget 和 PreferBusyPoll 为忙轮询选项（见 XskSocketConfig），BusyPoll 不为 0 时
+// 收发协程以 recvfrom 和 sendto 驱动 NAPI 而不再调用 poll，pollTimeout 不再生效，协程会一直占用一个 CPU。
+// NumFrames 个帧由接收和发送两侧共享：接收繁忙时接收侧逐步占用更多的帧，发送侧缺少帧时接收侧归还，
+// 每一侧至少保留 NumFrames/8 个帧。NumFrames 必须是 2 的幂，同时也是四个环的大小。
+// Logger 同时用于 umem 和套接字（见 XskSocketConfig），为 nil 时不记录日志。
 type SimpleXskConfig struct {
-	NumFrames   int
-	FrameSize   int
-	LibbpfFlags uint32
+	NumFrames          int
+	FrameSize          int
+	LibbpfFlags        uint32
+	UmemFlags          uint32
+	MultiBuffer        bool
+	TxMetadata         bool
+	TxTimestampHandler func(pkt Packet, ts uint64)
+	UmemAllocator      UmemAllocator
+	BindMode           uint32
+	XdpFlags           link.XDPAttachFlags
+	BusyPoll           uint32
+	BusyPollBudget     uint16
+	PreferBusyPoll     bool
+	Logger             *slog.Logger
 }
 
 func simpleXskSetConfig(cfg *SimpleXskConfig, usrCfg *SimpleXskConfig) error {
@@ -314,22 +1080,54 @@ func simpleXskSetConfig(cfg *SimpleXskConfig, usrCfg *SimpleXskConfig) error {
 		cfg.NumFrames = 2048
 		cfg.FrameSize = 4096
 		cfg.LibbpfFlags = 0
+		cfg.UmemFlags = 0
+		cfg.MultiBuffer = false
+		cfg.TxMetadata = false
+		cfg.TxTimestampHandler = nil
+		cfg.UmemAllocator = nil
+		cfg.BindMode = XSK_BIND_MODE__DEFAULT
+		cfg.XdpFlags = XDP_MODE_AUTO
+		cfg.BusyPoll = 0
+		cfg.BusyPollBudget = 0
+		cfg.PreferBusyPoll = false
+		cfg.Logger = nil
 		return nil
 	}
 	cfg.NumFrames = usrCfg.NumFrames
 	cfg.FrameSize = usrCfg.FrameSize
 	cfg.LibbpfFlags = usrCfg.LibbpfFlags
+	cfg.UmemFlags = usrCfg.UmemFlags
+	cfg.MultiBuffer = usrCfg.MultiBuffer
+	cfg.TxMetadata = usrCfg.TxMetadata
+	cfg.TxTimestampHandler = usrCfg.TxTimestampHandler
+	cfg.UmemAllocator = usrCfg.UmemAllocator
+	cfg.BindMode = usrCfg.BindMode
+	cfg.XdpFlags = usrCfg.XdpFlags
+	cfg.BusyPoll = usrCfg.BusyPoll
+	cfg.BusyPollBudget = usrCfg.BusyPollBudget
+	cfg.PreferBusyPoll = usrCfg.PreferBusyPoll
+	cfg.Logger = usrCfg.Logger
 	return nil
 }
 
 func NewSimpleXsk(ifaceName string, queueID uint32, config *SimpleXskConfig) (*SimpleXsk, error) {
 	simpleXsk := new(SimpleXsk)
 	var err error
+	var bindFlags uint16 = unix.XDP_USE_NEED_WAKEUP
+	var txMetadataLen uint32
 	simpleXskSetConfig(&simpleXsk.config, config)
+	if simpleXsk.config.MultiBuffer {
+		bindFlags |= unix.XDP_USE_SG
+	}
+	if simpleXsk.config.TxMetadata {
+		txMetadataLen = XSK_TX_METADATA_LEN
+	}
 
-	simpleXsk.umemArea, err = unix.Mmap(-1, 0, simpleXsk.config.NumFrames*simpleXsk.config.FrameSize,
-		unix.PROT_READ|unix.PROT_WRITE,
-		unix.MAP_PRIVATE|unix.MAP_ANONYMOUS|unix.MAP_POPULATE)
+	simpleXsk.allocator = simpleXsk.config.UmemAllocator
+	if simpleXsk.allocator == nil {
+		simpleXsk.allocator = AnonUmemAllocator{}
+	}
+	simpleXsk.umemArea, err = simpleXsk.allocator.Alloc(simpleXsk.config.NumFrames * simpleXsk.config.FrameSize)
 	if err != nil {
 		return nil, err
 	}
@@ -338,11 +1136,13 @@ func NewSimpleXsk(ifaceName string, queueID uint32, config *SimpleXskConfig) (*S
 		uint64(simpleXsk.config.NumFrames*simpleXsk.config.FrameSize),
 		&simpleXsk.fill, &simpleXsk.comp,
 		&XskUmemConfig{
-			FillSize:      uint32(simpleXsk.config.NumFrames / 2),
-			CompSize:      uint32(simpleXsk.config.NumFrames / 2),
+			FillSize:      uint32(simpleXsk.config.NumFrames),
+			CompSize:      uint32(simpleXsk.config.NumFrames),
 			FrameSize:     uint32(simpleXsk.config.FrameSize),
 			FrameHeadroom: uint32(0),
-			Flags:         uint32(0),
+			Flags:         simpleXsk.config.UmemFlags,
+			TxMetadataLen: txMetadataLen,
+			Logger:        simpleXsk.config.Logger,
 		})
 	if err != nil {
 		goto outFreeUmemArea
@@ -351,36 +1151,33 @@ func NewSimpleXsk(ifaceName string, queueID uint32, config *SimpleXskConfig) (*S
 	simpleXsk.xsk, err = XskSocketCreate(ifaceName, uint32(queueID),
 		simpleXsk.umem, &simpleXsk.rx, &simpleXsk.tx,
 		&XskSocketConfig{
-			RxSize:      uint32(simpleXsk.config.NumFrames / 2),
-			TxSize:      uint32(simpleXsk.config.NumFrames / 2),
-			XdpFlags:    link.XDPGenericMode,
-			BindFlags:   unix.XDP_USE_NEED_WAKEUP,
-			LibbpfFlags: simpleXsk.config.LibbpfFlags,
+			RxSize:         uint32(simpleXsk.config.NumFrames),
+			TxSize:         uint32(simpleXsk.config.NumFrames),
+			XdpFlags:       simpleXsk.config.XdpFlags,
+			BindFlags:      bindFlags,
+			LibbpfFlags:    simpleXsk.config.LibbpfFlags,
+			BindMode:       simpleXsk.config.BindMode,
+			BusyPoll:       simpleXsk.config.BusyPoll,
+			BusyPollBudget: simpleXsk.config.BusyPollBudget,
+			PreferBusyPoll: simpleXsk.config.PreferBusyPoll,
+			Logger:         simpleXsk.config.Logger,
 		})
 	if err != nil {
 		goto outFreeUmem
 	}
 
 	// 初始化
-	simpleXsk.rxFreeDescList = list.New()
-	simpleXsk.txFreeDescList = list.New()
-
-	for i := uint32(0); i < uint32(simpleXsk.config.NumFrames/2); i++ {
-		simpleXsk.txFreeDescList.PushBack(uint64(i * uint32(simpleXsk.config.FrameSize)))
-	}
-
-	for i := uint32(0); i < uint32(simpleXsk.config.NumFrames/2); i++ {
-		simpleXsk.rxFreeDescList.PushBack(
-			uint64((i + uint32(simpleXsk.config.NumFrames/2)) * uint32(simpleXsk.config.FrameSize)))
+	simpleXsk.zeroCopy = xskIsZeroCopy(simpleXsk.xsk.Fd)
+	simpleXsk.txTimestampPending = make(map[uint64]Packet)
+	// 所有帧放入共享的空闲帧中，接收侧初始配额为一半，之后根据两侧的需求动态调整
+	simpleXsk.frames = newXskFramePool(simpleXsk.config.NumFrames)
+	for i := uint32(0); i < uint32(simpleXsk.config.NumFrames); i++ {
+		simpleXsk.frames.Put(uint64(i) * uint64(simpleXsk.config.FrameSize))
 	}
-	simpleXsk.recvPktChan = nil
-	simpleXsk.sendPktChan = nil
-	simpleXsk.recvStopFinishedChan = nil
-	simpleXsk.sendStopNoticeChan = nil
-	simpleXsk.stopRecvReadFd = -1
-	simpleXsk.stopRecvWriteFd = -1
-	simpleXsk.stopSendReadFd = -1
-	simpleXsk.stopSendWriteFd = -1
+	simpleXsk.txFrames = make([]uint64, 0, simpleXsk.config.NumFrames)
+	simpleXsk.rxOutstanding = 0
+	simpleXsk.rxQuota.Store(int64(simpleXsk.config.NumFrames / 2))
+	simpleXsk.closed = make(chan struct{})
 
 	return simpleXsk, nil
 
@@ -388,6 +1185,6 @@ outFreeUmem:
 	XskUmemDelete(simpleXsk.umem)
 
 outFreeUmemArea:
-	unix.Munmap(simpleXsk.umemArea)
+	simpleXsk.allocator.Free(simpleXsk.umemArea)
 	return nil, err
 }
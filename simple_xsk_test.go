@@ -1,9 +1,16 @@
 package xsk
 
 import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
 )
 
 func TestNewSimpleXsk(t *testing.T) {
@@ -311,3 +318,363 @@ func TestStartSendChanWithPostProcess(t *testing.T) {
 	simpleXsk.StopSendChan()
 	t.Log("TestStartSendChanWithPostProcess done")
 }
+
+func TestRunRecvCancel(t *testing.T) {
+	ifaceName := "ens2"
+	queueID := uint32(0)
+	simpleXsk, err := NewSimpleXsk(ifaceName, queueID, nil)
+	if err != nil {
+		t.Fatalf("NewSimpleXsk failed: %v", err)
+	}
+	defer simpleXsk.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	// poll 的超时时间远大于 ctx 的超时时间，ctx 取消时应立即退出
+	err = simpleXsk.RunRecv(ctx, 10000, func([]byte) {})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got: %v", err)
+	}
+	var loopErr *SimpleXskLoopError
+	if !errors.As(err, &loopErr) || loopErr.Op != "recv" {
+		t.Errorf("Expected *SimpleXskLoopError, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("RunRecv returned %v after the deadline", elapsed)
+	}
+
+	// 循环退出后可以再次启动
+	if err := simpleXsk.StartRecv(0, -1, func([]byte) {}); err != nil {
+		t.Fatalf("StartRecv failed: %v", err)
+	}
+	simpleXsk.StopRecv()
+}
+
+func TestXskCancelFd(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wake, err := newXskCancelFd(ctx)
+	if err != nil {
+		t.Fatalf("newXskCancelFd failed: %v", err)
+	}
+	defer wake.close()
+	pollFds := []unix.PollFd{{Fd: int32(wake.fd), Events: unix.POLLIN}}
+	if n, _ := unix.Poll(pollFds, 0); n != 0 {
+		t.Fatal("Expected eventfd not readable before cancel")
+	}
+	cancel()
+	if n, _ := unix.Poll(pollFds, 1000); n != 1 || pollFds[0].Revents&unix.POLLIN == 0 {
+		t.Fatal("Expected eventfd readable after cancel")
+	}
+}
+
+// newTestSimpleXsk 返回一个不绑定网卡的 SimpleXsk，fd 为 -1 时 poll 只等待 ctx 取消，
+// 环没有设置 XDP_RING_NEED_WAKEUP，收发循环不会发起系统调用。
+func newTestSimpleXsk() *SimpleXsk {
+	const numFrames = 8
+	simpleXsk := &SimpleXsk{config: SimpleXskConfig{NumFrames: numFrames, FrameSize: 2048}}
+	fill, _ := newTestRings(numFrames, 8)
+	_, comp := newTestRings(numFrames, 8)
+	_, rx := newTestRings(numFrames, unsafe.Sizeof(XDPDesc{}))
+	tx, _ := newTestRings(numFrames, unsafe.Sizeof(XDPDesc{}))
+	simpleXsk.fill, simpleXsk.comp, simpleXsk.rx, simpleXsk.tx = *fill, *comp, *rx, *tx
+	simpleXsk.umem = &XskUmem{Fd: -1, Refcount: 1, CtxList: list.New(), needWakeup: true}
+	simpleXsk.xsk = &XskSocket{Tx: &simpleXsk.tx, Fd: -1,
+		Ctx: &XskCtx{Fill: &simpleXsk.fill, Comp: &simpleXsk.comp, Umem: simpleXsk.umem, Refcount: 1}}
+	simpleXsk.frames = newXskFramePool(numFrames)
+	for i := uint64(0); i < numFrames; i++ {
+		simpleXsk.frames.Put(i * 2048)
+	}
+	simpleXsk.txFrames = make([]uint64, 0, numFrames)
+	simpleXsk.rxQuota.Store(numFrames / 2)
+	simpleXsk.closed = make(chan struct{})
+	return simpleXsk
+}
+
+func TestSimpleXskLifecycle(t *testing.T) {
+	simpleXsk := newTestSimpleXsk()
+	if state := simpleXsk.State(); state != SIMPLE_XSK_STATE__CREATED {
+		t.Fatalf("Expected SIMPLE_XSK_STATE__CREATED, got %d", state)
+	}
+
+	// 多个协程同时启动和停止收发循环
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				switch (i + j) % 3 {
+				case 0:
+					if _, err := simpleXsk.StartRecvChan(4, 10, nil); err != nil && err != ErrAnotherRecvChanRunning && err != ErrAnotherRecvRunning {
+						t.Errorf("StartRecvChan failed: %v", err)
+					}
+					simpleXsk.StopRecv()
+				case 1:
+					if _, err := simpleXsk.StartSendChan(4, 10, nil); err != nil && err != ErrAnotherSendChanRunning {
+						t.Errorf("StartSendChan failed: %v", err)
+					}
+					simpleXsk.StopSendChan()
+				case 2:
+					ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+					if err := simpleXsk.RunRecv(ctx, 10, func([]byte) {}); err != ErrAnotherRecvRunning && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+						t.Errorf("RunRecv failed: %v", err)
+					}
+					cancel()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if state := simpleXsk.State(); state != SIMPLE_XSK_STATE__CREATED {
+		t.Fatalf("Expected SIMPLE_XSK_STATE__CREATED after stop, got %d", state)
+	}
+
+	recvChan, err := simpleXsk.StartRecvChan(4, 10, nil)
+	if err != nil {
+		t.Fatalf("StartRecvChan failed: %v", err)
+	}
+	sendChan, err := simpleXsk.StartSendChan(4, 10, nil)
+	if err != nil {
+		t.Fatalf("StartSendChan failed: %v", err)
+	}
+	if ch, err := simpleXsk.StartSendChan(4, 10, nil); err != ErrAnotherSendChanRunning || ch != sendChan {
+		t.Fatalf("Expected the running send chan and ErrAnotherSendChanRunning, got %v", err)
+	}
+	if state := simpleXsk.State(); state != SIMPLE_XSK_STATE__RUNNING {
+		t.Fatalf("Expected SIMPLE_XSK_STATE__RUNNING, got %d", state)
+	}
+
+	// 关闭期间其他协程仍在访问套接字，release 等待访问结束后才删除套接字
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				simpleXsk.Fd()
+				simpleXsk.WakeupStats()
+				if _, err := simpleXsk.Statistics(); err == ErrSimpleXskClosed {
+					return
+				}
+			}
+		}()
+	}
+	// Shutdown 和 Close 可以同时从多个协程调用
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				simpleXsk.Close()
+			} else if err := simpleXsk.Shutdown(context.Background()); err != nil {
+				t.Errorf("Shutdown failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if state := simpleXsk.State(); state != SIMPLE_XSK_STATE__CLOSED {
+		t.Fatalf("Expected SIMPLE_XSK_STATE__CLOSED, got %d", state)
+	}
+	// 接收通道由接收协程关闭，发送通道由调用者关闭
+	if _, ok := <-recvChan; ok {
+		t.Error("Expected recv chan closed")
+	}
+	close(sendChan)
+	if err := simpleXsk.StartRecv(4, 10, func([]byte) {}); err != ErrSimpleXskClosed {
+		t.Errorf("Expected ErrSimpleXskClosed, got %v", err)
+	}
+	if err := simpleXsk.RunSend(context.Background(), 10, nil, nil); err != ErrSimpleXskClosed {
+		t.Errorf("Expected ErrSimpleXskClosed, got %v", err)
+	}
+}
+
+func TestSimpleXskTxFrags(t *testing.T) {
+	simpleXsk := newTestSimpleXsk()
+	// 发送侧保证可用的帧为 NumFrames / 8
+	simpleXsk.config.NumFrames = 64
+	tests := []struct {
+		size        int
+		multiBuffer bool
+		expected    uint32
+	}{
+		{0, false, 0},
+		{64, false, 1},
+		{2048, false, 1},
+		{3000, false, 0},
+		{3000, true, 2},
+		{0, true, 0},
+	}
+	for _, tt := range tests {
+		simpleXsk.config.MultiBuffer = tt.multiBuffer
+		pkt := &JumboPacket{}
+		pkt.SetData(make([]byte, tt.size))
+		if frags := simpleXsk.txFrags(pkt); frags != tt.expected {
+			t.Errorf("txFrags(%d, multiBuffer=%v) = %d, expected %d", tt.size, tt.multiBuffer, frags, tt.expected)
+		}
+	}
+}
+
+func TestSimpleXskSendStarvedWait(t *testing.T) {
+	simpleXsk := newTestSimpleXsk()
+	ctx, cancel := context.WithCancel(context.Background())
+	wake, err := newXskCancelFd(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wake.close()
+
+	// tx ring 为空时帧被接收侧占用，即使 pollTimeout 为 -1 也只等待 simpleXskStarvedPollTimeout
+	start := time.Now()
+	if err := simpleXsk.sendStarvedWait(ctx, wake, -1); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond || elapsed > time.Second {
+		t.Errorf("Unexpected wait %v for empty tx ring", elapsed)
+	}
+
+	// tx ring 中有描述符时等待 poll 超时
+	simpleXsk.tx.CachedProd++
+	*simpleXsk.tx.Producer = simpleXsk.tx.CachedProd
+	start = time.Now()
+	if err := simpleXsk.sendStarvedWait(ctx, wake, 20); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected to wait for poll timeout, waited %v", elapsed)
+	}
+
+	cancel()
+	if err := simpleXsk.sendStarvedWait(ctx, wake, -1); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	*simpleXsk.tx.Producer = 0
+	simpleXsk.tx.CachedProd = 0
+	if err := simpleXsk.sendStarvedWait(ctx, wake, -1); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestSimpleXskCloseInCallback(t *testing.T) {
+	newSimpleXsk := func(t *testing.T) *SimpleXsk {
+		simpleXsk := newTestSimpleXsk()
+		simpleXsk.allocator = AnonUmemAllocator{}
+		area, err := simpleXsk.allocator.Alloc(simpleXsk.config.NumFrames * simpleXsk.config.FrameSize)
+		if err != nil {
+			t.Fatalf("Alloc failed: %v", err)
+		}
+		simpleXsk.umemArea = area
+		return simpleXsk
+	}
+	waitClosed := func(t *testing.T, simpleXsk *SimpleXsk) {
+		select {
+		case <-simpleXsk.closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for close")
+		}
+		if state := simpleXsk.State(); state != SIMPLE_XSK_STATE__CLOSED {
+			t.Fatalf("Expected SIMPLE_XSK_STATE__CLOSED, got %d", state)
+		}
+		// 关闭之后访问套接字返回错误而不是空指针
+		if fd := simpleXsk.Fd(); fd != -1 {
+			t.Errorf("Expected fd -1, got %d", fd)
+		}
+		if err := simpleXsk.KickTx(); err != ErrSimpleXskClosed {
+			t.Errorf("Expected ErrSimpleXskClosed, got %v", err)
+		}
+		if _, err := simpleXsk.Statistics(); err != ErrSimpleXskClosed {
+			t.Errorf("Expected ErrSimpleXskClosed, got %v", err)
+		}
+		simpleXsk.Close()
+	}
+
+	tests := []struct {
+		name  string
+		close func(simpleXsk *SimpleXsk)
+	}{
+		{"close", func(simpleXsk *SimpleXsk) { simpleXsk.Close() }},
+		{"shutdown", func(simpleXsk *SimpleXsk) { simpleXsk.Shutdown(context.Background()) }},
+	}
+	for _, tt := range tests {
+		t.Run("recv_"+tt.name, func(t *testing.T) {
+			simpleXsk := newSimpleXsk(t)
+			// 在 rx ring 中放入一个数据包，帧从空闲帧中取出
+			frame, _ := simpleXsk.frames.Get()
+			simpleXsk.rxOutstanding++
+			desc := XskRingConsRxDesc(&simpleXsk.rx, 0)
+			desc.Addr, desc.Len = frame, 64
+			*simpleXsk.rx.Producer = 1
+			sendChan, err := simpleXsk.StartSendChan(4, 10, nil)
+			if err != nil {
+				t.Fatalf("StartSendChan failed: %v", err)
+			}
+			defer close(sendChan)
+			if err := simpleXsk.StartRecv(4, 10, func([]byte) {
+				tt.close(simpleXsk)
+				tt.close(simpleXsk)
+			}); err != nil {
+				t.Fatalf("StartRecv failed: %v", err)
+			}
+			waitClosed(t, simpleXsk)
+		})
+		t.Run("send_"+tt.name, func(t *testing.T) {
+			simpleXsk := newSimpleXsk(t)
+			pkts := make(chan Packet, 1)
+			pkt := &SimplePacket{}
+			pkt.SetData(make([]byte, 64))
+			pkts <- pkt
+			err := simpleXsk.RunSend(context.Background(), 10, pkts, func(Packet) { tt.close(simpleXsk) })
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected context.Canceled, got %v", err)
+			}
+			waitClosed(t, simpleXsk)
+		})
+	}
+}
+
+func TestSimpleXskCloseDuringCallback(t *testing.T) {
+	simpleXsk := newTestSimpleXsk()
+	simpleXsk.allocator = AnonUmemAllocator{}
+	area, err := simpleXsk.allocator.Alloc(simpleXsk.config.NumFrames * simpleXsk.config.FrameSize)
+	if err != nil {
+		t.Fatalf("Alloc failed: %v", err)
+	}
+	simpleXsk.umemArea = area
+	frame, _ := simpleXsk.frames.Get()
+	simpleXsk.rxOutstanding++
+	desc := XskRingConsRxDesc(&simpleXsk.rx, 0)
+	desc.Addr, desc.Len = frame, 64
+	*simpleXsk.rx.Producer = 1
+
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	if err := simpleXsk.StartRecv(4, 10, func([]byte) {
+		close(entered)
+		<-unblock
+	}); err != nil {
+		t.Fatalf("StartRecv failed: %v", err)
+	}
+	<-entered
+	// 处理函数正在运行，其他协程的 Close 只取消循环，不等待处理函数返回
+	done := make(chan struct{})
+	go func() {
+		simpleXsk.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited for the running handler")
+	}
+	if state := simpleXsk.State(); state != SIMPLE_XSK_STATE__STOPPING {
+		t.Fatalf("Expected SIMPLE_XSK_STATE__STOPPING, got %d", state)
+	}
+	close(unblock)
+	select {
+	case <-simpleXsk.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the loop to release")
+	}
+	if err := simpleXsk.KickTx(); err != ErrSimpleXskClosed {
+		t.Errorf("Expected ErrSimpleXskClosed, got %v", err)
+	}
+}
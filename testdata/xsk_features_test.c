@@ -0,0 +1,40 @@
+/* SPDX-License-Identifier: GPL-2.0 */
+
+/* 测试 xdp/xsk_features.h 中的处理，由 Makefile 编译为 xsk_features_test_bpfel.o 和 xsk_features_test_bpfeb.o。
+ * 匹配时返回 XDP_TX，以便与 XDP_PASS 区分。
+ */
+
+#include "../xdp/xsk_features.h"
+
+/* 测试运行时无法向 XSKMAP 写入套接字，用普通的 map 代替 xsks_map，键存在即表示槽位上有套接字 */
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(key_size, sizeof(__u32));
+	__uint(value_size, sizeof(__u32));
+	__uint(max_entries, XSK_FANOUT_MAX_SOCKETS);
+} xsks_map SEC(".maps");
+
+SEC("xdp")
+int xsk_test_filter(struct xdp_md *ctx)
+{
+	return xsk_filter_match(ctx) ? XDP_TX : XDP_PASS;
+}
+
+SEC("xdp")
+int xsk_test_sample(struct xdp_md *ctx)
+{
+	return xsk_sample_match(ctx) ? XDP_TX : XDP_PASS;
+}
+
+/* 选中套接字时返回 xsks_map 的键，否则返回 0xffff */
+SEC("xdp")
+int xsk_test_fanout(struct xdp_md *ctx)
+{
+	__u32 key;
+
+	if (!xsk_fanout_select(ctx, &xsks_map, &key))
+		return 0xffff;
+	return key;
+}
+
+char _license[] SEC("license") = "GPL";
@@ -1,7 +1,9 @@
 package xsk
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"unicode"
 	"unsafe"
 
@@ -63,14 +65,14 @@ func GetEthChannels(ifName string) (*EthtoolChannels, error) {
 	// 打开套接字
 	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
 	if err != nil {
-		return nil, fmt.Errorf("打开套接字出错: %v", err)
+		return nil, fmt.Errorf("打开套接字出错: %w", err)
 	}
 	defer unix.Close(fd)
 
 	// 执行 ioctl 调用
 	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), uintptr(unix.SIOCETHTOOL), uintptr(unsafe.Pointer(&ifr)))
 	if errno != 0 {
-		return nil, fmt.Errorf("执行 ioctl 出错: %v", errno)
+		return nil, fmt.Errorf("执行 ioctl 出错: %w", errno)
 	}
 
 	return &channels, nil
@@ -120,3 +122,37 @@ func HexDump(data []byte) string {
 
 	return result
 }
+
+// xskCancelFd 为一个 eventfd，ctx 被取消时变为可读，用于唤醒与套接字一起阻塞在 poll 中的收发循环。
+type xskCancelFd struct {
+	fd     int
+	mu     sync.Mutex
+	closed bool
+	stop   func() bool
+}
+
+// newXskCancelFd 创建 ctx 对应的 xskCancelFd，使用完毕后需要调用 close。
+func newXskCancelFd(ctx context.Context) (*xskCancelFd, error) {
+	fd, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("eventfd: %w", err)
+	}
+	c := &xskCancelFd{fd: fd}
+	c.stop = context.AfterFunc(ctx, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if !c.closed {
+			// 任意非 0 的 8 字节计数都会让 eventfd 变为可读
+			unix.Write(c.fd, []byte{1, 0, 0, 0, 0, 0, 0, 1})
+		}
+	})
+	return c, nil
+}
+
+func (c *xskCancelFd) close() {
+	c.stop()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	unix.Close(c.fd)
+}
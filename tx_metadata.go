@@ -0,0 +1,108 @@
+package xsk
+
+import (
+	"encoding/binary"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// RequestChecksum 请求校验和卸载：设备从 csumStart 开始计算校验和，写入 csumStart+csumOffset 处。
+// 与 CHECKSUM_PARTIAL 相同，校验和字段需要预先填入伪首部校验和。
+func (m *XskTxMetadata) RequestChecksum(csumStart, csumOffset uint16) {
+	m.Flags |= unix.XDP_TXMD_FLAGS_CHECKSUM
+	m.CsumStart = csumStart
+	m.CsumOffset = csumOffset
+}
+
+// RequestLaunchTime 请求在指定的时间（纳秒，时钟由网卡决定）发送数据包，需要内核 >= 6.14 且网卡支持。
+func (m *XskTxMetadata) RequestLaunchTime(launchTime uint64) {
+	m.Flags |= XDP_TXMD_FLAGS_LAUNCH_TIME
+	m.LaunchTime = launchTime
+}
+
+// RequestTimestamp 请求在发送完成时记录硬件时间戳，完成后通过 TxTimestamp 读取。
+func (m *XskTxMetadata) RequestTimestamp() {
+	m.Flags |= unix.XDP_TXMD_FLAGS_TIMESTAMP
+}
+
+// TxTimestamp 返回发送完成时内核写入的时间戳，只在数据包从 completion ring 回收后有效。
+// 没有请求时间戳时 ok 为 false；驱动不支持时时间戳为 0。
+func (m *XskTxMetadata) TxTimestamp() (ts uint64, ok bool) {
+	if m.Flags&unix.XDP_TXMD_FLAGS_TIMESTAMP == 0 {
+		return 0, false
+	}
+	return *(*uint64)(unsafe.Pointer(&m.CsumStart)), true
+}
+
+// xskTxMetadataCopyMode 在复制模式下处理 frags 组成的数据包的 TX 元数据请求：校验和由软件计算；
+// 复制模式下没有硬件时间戳，而带有时间戳请求的数据包会被 veth 等设备丢弃，因此忽略时间戳请求。
+// 处理过的请求会从 meta.Flags 中清除。
+func xskTxMetadataCopyMode(meta *XskTxMetadata, frags [][]byte) {
+	if meta.Flags&unix.XDP_TXMD_FLAGS_CHECKSUM != 0 {
+		xskTxChecksum(frags, meta.CsumStart, meta.CsumOffset)
+		meta.Flags &^= unix.XDP_TXMD_FLAGS_CHECKSUM
+	}
+	meta.Flags &^= unix.XDP_TXMD_FLAGS_TIMESTAMP
+}
+
+// xskTxChecksum 在软件中完成校验和卸载请求，frags 为一个数据包依次排列的所有片段。
+// 行为与内核 skb_checksum_help 一致：从 csumStart 开始对剩余数据求和（包括预先填入的伪首部校验和），
+// 取反后写入 csumStart+csumOffset 处。请求越界时不做任何修改并返回 false。
+func xskTxChecksum(frags [][]byte, csumStart, csumOffset uint16) bool {
+	total := 0
+	for _, frag := range frags {
+		total += len(frag)
+	}
+	start := int(csumStart)
+	field := start + int(csumOffset)
+	if field+2 > total {
+		return false
+	}
+
+	var sum uint64
+	pos := 0
+	odd := false
+	for _, frag := range frags {
+		if pos+len(frag) > start {
+			data := frag
+			if pos < start {
+				data = frag[start-pos:]
+			}
+			if odd && len(data) > 0 {
+				sum += uint64(data[0])
+				data = data[1:]
+				odd = false
+			}
+			for len(data) >= 2 {
+				sum += uint64(binary.BigEndian.Uint16(data))
+				data = data[2:]
+			}
+			if len(data) == 1 {
+				sum += uint64(data[0]) << 8
+				odd = true
+			}
+		}
+		pos += len(frag)
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	csum := ^uint16(sum)
+
+	// 校验和字段可能跨越两个片段
+	xskFragsPutByte(frags, field, byte(csum>>8))
+	xskFragsPutByte(frags, field+1, byte(csum))
+	return true
+}
+
+// xskFragsPutByte 把 b 写入 frags 拼接后第 off 个字节的位置。
+func xskFragsPutByte(frags [][]byte, off int, b byte) {
+	for _, frag := range frags {
+		if off < len(frag) {
+			frag[off] = b
+			return
+		}
+		off -= len(frag)
+	}
+}
@@ -0,0 +1,79 @@
+package xsk
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestXskTxChecksum(t *testing.T) {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x00, 0x0C, 0x29, 0x3E, 0x1A, 0x2B},
+		DstMAC:       net.HardwareAddr{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		IHL:      5,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.IP{10, 0, 0, 1},
+		DstIP:    net.IP{10, 0, 0, 2},
+	}
+	udp := &layers.UDP{SrcPort: 1234, DstPort: 5678}
+	udp.SetNetworkLayerForChecksum(ip)
+	payload := make([]byte, 101)
+	for i := range payload {
+		payload[i] = byte(i * 7)
+	}
+	buf := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true},
+		eth, ip, udp, gopacket.Payload(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := buf.Bytes()
+
+	// 与 CHECKSUM_PARTIAL 一样，校验和字段中预先填入伪首部校验和
+	const csumStart, csumOffset = 34, 6
+	seeded := append([]byte(nil), expected...)
+	sum := uint32(0x0a00 + 0x0001 + 0x0a00 + 0x0002 + 17 + len(seeded) - csumStart)
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	seeded[csumStart+csumOffset] = byte(sum >> 8)
+	seeded[csumStart+csumOffset+1] = byte(sum)
+
+	// 分别测试单个片段以及在奇数位置、校验和字段中间拆分的多个片段
+	for _, splits := range [][]int{nil, {35}, {41, 77}} {
+		data := append([]byte(nil), seeded...)
+		var frags [][]byte
+		prev := 0
+		for _, split := range splits {
+			frags = append(frags, data[prev:split])
+			prev = split
+		}
+		frags = append(frags, data[prev:])
+		if !xskTxChecksum(frags, csumStart, csumOffset) {
+			t.Fatalf("xskTxChecksum failed with splits %v", splits)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Errorf("Expected checksum %x with splits %v, got %x", expected[40:42], splits, data[40:42])
+		}
+	}
+
+	if xskTxChecksum([][]byte{seeded}, uint16(len(seeded)-1), 0) {
+		t.Errorf("Expected xskTxChecksum to reject out of range request")
+	}
+
+	var meta XskTxMetadata
+	meta.RequestChecksum(csumStart, csumOffset)
+	meta.RequestTimestamp()
+	xskTxMetadataCopyMode(&meta, [][]byte{append([]byte(nil), seeded...)})
+	if meta.Flags != 0 {
+		t.Errorf("Expected copy mode to clear all requests, got flags %d", meta.Flags)
+	}
+}
@@ -2,6 +2,7 @@ package xsk
 
 import (
 	"container/list"
+	"log/slog"
 	"unsafe"
 
 	"github.com/cilium/ebpf"
@@ -62,6 +63,47 @@ type XskRingCons struct {
 	Flags      *uint32
 }
 
+/*
+	struct xdp_ring_offset_v1 {
+		__u64 producer;
+		__u64 consumer;
+		__u64 desc;
+	};
+*/
+type xdpRingOffsetV1 struct {
+	Producer uint64
+	Consumer uint64
+	Desc     uint64
+}
+
+/*
+	struct xdp_mmap_offsets_v1 {
+		struct xdp_ring_offset_v1 rx;
+		struct xdp_ring_offset_v1 tx;
+		struct xdp_ring_offset_v1 fr;
+		struct xdp_ring_offset_v1 cr;
+	};
+*/
+type xdpMmapOffsetsV1 struct {
+	Rx xdpRingOffsetV1
+	Tx xdpRingOffsetV1
+	Fr xdpRingOffsetV1
+	Cr xdpRingOffsetV1
+}
+
+/*
+	struct xdp_statistics_v1 {
+		__u64 rx_dropped;
+		__u64 rx_invalid_descs;
+		__u64 tx_invalid_descs;
+	};
+*/
+type xdpStatisticsV1 struct {
+	RxDropped      uint64
+	RxInvalidDescs uint64
+	TxInvalidDescs uint64
+}
+
 /*
 	struct xsk_umem_config {
 		__u32 fill_size;
@@ -69,6 +111,7 @@ type XskRingCons struct {
 		__u32 frame_size;
 		__u32 frame_headroom;
 		__u32 flags;
+		__u32 tx_metadata_len;
 	};
 */
 type XskUmemConfig struct {
@@ -77,6 +120,37 @@ type XskUmemConfig struct {
 	FrameSize     uint32
 	FrameHeadroom uint32
 	Flags         uint32
+	TxMetadataLen uint32
+	// Logger 为本库新增的字段，记录释放 umem 时的失败（见 logger.go），为 nil 时不记录
+	Logger *slog.Logger
+}
+
+/*
+	struct xsk_tx_metadata {
+		__u64 flags;
+
+		union {
+			struct {
+				__u16 csum_start;
+				__u16 csum_offset;
+
+				__u64 launch_time;
+			} request;
+
+			struct {
+				__u64 tx_timestamp;
+			} completion;
+		};
+	};
+*/
+// XskTxMetadata 位于 TX 数据之前的 TxMetadataLen 字节处，request 与 completion 共用同一块内存，
+// 发送完成后 CsumStart、CsumOffset 所在的 8 字节会被内核改写为 tx_timestamp（见 TxTimestamp）。
+type XskTxMetadata struct {
+	Flags      uint64
+	CsumStart  uint16
+	CsumOffset uint16
+	_          uint32
+	LaunchTime uint64
 }
 
 /*
@@ -132,6 +206,8 @@ type XskUmem struct {
 	CtxList         *list.List
 	RxRingSetupDone bool
 	TxRingSetupDone bool
+	// needWakeup 为本库新增的字段，记录第一个绑定 umem 的套接字是否使用了 XDP_USE_NEED_WAKEUP，共享 umem 的套接字沿用该设置
+	needWakeup bool
 }
 
 /*
@@ -152,6 +228,14 @@ type XskSocketConfig struct {
 	LibbpfFlags uint32
 	XdpFlags    link.XDPAttachFlags
 	BindFlags   uint16
+	// BindMode 为本库新增的字段，决定绑定时如何处理 XDP_ZEROCOPY 和 XDP_COPY（见 XSK_BIND_MODE__*）
+	BindMode uint32
+	// 以下为本库新增的忙轮询选项（见 busy_poll.go），BusyPoll 不为 0 时套接字以忙轮询模式运行
+	BusyPoll       uint32 // SO_BUSY_POLL，每次忙轮询的时间（微秒）
+	BusyPollBudget uint16 // SO_BUSY_POLL_BUDGET，每次忙轮询最多处理的数据包数量
+	PreferBusyPoll bool   // SO_PREFER_BUSY_POLL，忙轮询时推迟网卡中断
+	// Logger 为本库新增的字段，记录 XDP 程序的挂载、卸载、引用计数变化和释放资源时的失败（见 logger.go），为 nil 时不记录
+	Logger *slog.Logger
 }
 
 /*
@@ -169,4 +253,10 @@ type XskSocket struct {
 	Ctx    *XskCtx
 	Config XskSocketConfig
 	Fd     int
+	// xskmaps 为本库新增的字段，记录通过 XskSocketUpdateXskmapKey 写入的调用者的 xskmap
+	xskmaps []xskmapEntry
+	// fanout 为本库新增的字段，记录 XSK_LIBBPF_FLAGS__FANOUT 程序中套接字占用的槽位
+	fanout *xskFanoutSocket
+	// wakeups 为本库新增的字段，记录 XskSocketKickTx 和 XskSocketWakeupRx 实际唤醒内核的次数
+	wakeups xskWakeupCounters
 }
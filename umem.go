@@ -53,7 +53,7 @@ func XskUmemCreateWithFd(fd int, umemArea unsafe.Pointer, size uint64, fill *Xsk
 	if fd < 0 {
 		umem.Fd, err = unix.Socket(unix.AF_XDP, unix.SOCK_RAW, 0)
 		if err != nil {
-			return nil, err
+			return nil, xskError("socket", "", 0, err)
 		}
 	} else {
 		umem.Fd = fd
@@ -67,6 +67,7 @@ func XskUmemCreateWithFd(fd int, umemArea unsafe.Pointer, size uint64, fill *Xsk
 	mr.Chunk_size = umem.Config.FrameSize
 	mr.Headroom = umem.Config.FrameHeadroom
 	mr.Flags = umem.Config.Flags
+	mr.Tx_metadata_len = umem.Config.TxMetadataLen
 
 	// 将 umem 注册给内核中对应的套接字 umem->fd
 	_, _, errno := unix.Syscall6(unix.SYS_SETSOCKOPT, uintptr(umem.Fd),
@@ -74,11 +75,11 @@ func XskUmemCreateWithFd(fd int, umemArea unsafe.Pointer, size uint64, fill *Xsk
 		uintptr(unsafe.Pointer(&mr)),
 		unsafe.Sizeof(mr), 0)
 	if errno != 0 {
-		err = fmt.Errorf("unix.Setsockopt XDP_UMEM_REG 失败: %v", errno)
+		err = xskError("umem reg", "", 0, errno)
 		goto out_socket
 	}
 	// 创建 fill_ring 和 completion_ring，绑定到 umem->fd 的套接字，使用 umem-> config 的信息
-	err = xskCreateUmemRings(umem, umem.Fd, fill, comp)
+	err = xskCreateUmemRings(umem, umem.Fd, "", 0, fill, comp)
 	if err != nil {
 		goto out_socket
 	}
@@ -105,6 +106,8 @@ func xskSetUmemConfig(cfg *XskUmemConfig, usrCfg *XskUmemConfig) {
 		cfg.FrameSize = XSK_UMEM__DEFAULT_FRAME_SIZE
 		cfg.FrameHeadroom = XSK_UMEM__DEFAULT_FRAME_HEADROOM
 		cfg.Flags = XSK_UMEM__DEFAULT_FLAGS
+		cfg.TxMetadataLen = 0
+		cfg.Logger = nil
 		return
 	}
 	cfg.FillSize = usrCfg.FillSize
@@ -112,6 +115,8 @@ func xskSetUmemConfig(cfg *XskUmemConfig, usrCfg *XskUmemConfig) {
 	cfg.FrameSize = usrCfg.FrameSize
 	cfg.FrameHeadroom = usrCfg.FrameHeadroom
 	cfg.Flags = usrCfg.Flags
+	cfg.TxMetadataLen = usrCfg.TxMetadataLen
+	cfg.Logger = usrCfg.Logger
 }
 
 // xskCreateUmemRings 创建并初始化 XDP UMEM 的 fill ring 和 completion ring。
@@ -119,35 +124,36 @@ func xskSetUmemConfig(cfg *XskUmemConfig, usrCfg *XskUmemConfig) {
 // 参数:
 // - umem: 指向 XskUmem 结构体的指针，包含 UMEM 的配置信息。
 // - fd: 套接字文件描述符。
+// - ifname、queueId: 套接字所在的网卡和队列，只用于错误信息，创建 umem 时为空。
 // - fill: 指向 XskRingProd 结构体的指针，用于 fill ring 的生产者环。
 // - comp: 指向 XskRingCons 结构体的指针，用于 completion ring 的消费者环。
 //
 // 返回:
-// - error: 如果操作失败，返回错误信息；成功则返回 nil。
+// - error: 如果操作失败，返回 *XskError；成功则返回 nil。
 //
 // 该函数执行以下操作:
 // 1. 设置 fill ring 和 completion ring 的大小。
 // 2. 获取各个 ring 中字段的偏移值。
 // 3. 将内核中分配的 fill ring 和 completion ring 的地址映射到用户态。
 // 4. 初始化用户态维护的 fill ring 和 completion ring 结构体。
-func xskCreateUmemRings(umem *XskUmem, fd int, fill *XskRingProd, comp *XskRingCons) error {
+func xskCreateUmemRings(umem *XskUmem, fd int, ifname string, queueId uint32, fill *XskRingProd, comp *XskRingCons) error {
 	// 获取偏移值，偏移值都是相对于结构体的起始位置的偏移
 	var off unix.XDPMmapOffsets
 	var err error
 	// 设置 fill ring 的大小，设置后内核会给 fd 对应的套接字分配 fill ring 的结构体
 	err = unix.SetsockoptInt(fd, unix.SOL_XDP, unix.XDP_UMEM_FILL_RING, int(umem.Config.FillSize))
 	if err != nil {
-		return fmt.Errorf("unix.SetsockoptInt XDP_UMEM_FILL_RING 失败: %v", err)
+		return xskError("fill ring", ifname, queueId, err)
 	}
 	// 设置 completion ring 的大小，设置后内核会给 fd 对应的套接字分配 completion ring 的结构体
 	err = unix.SetsockoptInt(fd, unix.SOL_XDP, unix.XDP_UMEM_COMPLETION_RING, int(umem.Config.CompSize))
 	if err != nil {
-		return fmt.Errorf("unix.SetsockoptInt XDP_UMEM_COMPLETION_RING 失败: %v", err)
+		return xskError("completion ring", ifname, queueId, err)
 	}
-	// 获取各个ring中各个字段的偏移值（内核版本 >= 5.4）
+	// 获取各个ring中各个字段的偏移值（内核版本 <= 5.3 时会自动转换）
 	off, err = xskGetMmapOffsets(fd)
 	if err != nil {
-		return err
+		return xskError("mmap offsets", ifname, queueId, err)
 	}
 	/*
 		将内核中分配的 fill ring 的地址，映射到 fillMap 中（现在 map 就相当于 fd 的 fill_ring 结构体的起始地址）
@@ -171,7 +177,7 @@ func xskCreateUmemRings(umem *XskUmem, fd int, fill *XskRingProd, comp *XskRingC
 		unix.PROT_READ|unix.PROT_WRITE,
 		unix.MAP_SHARED|unix.MAP_POPULATE)
 	if err != nil {
-		return fmt.Errorf("unix.Mmap fillMap 失败: %v", err)
+		return xskError("mmap fill ring", ifname, queueId, err)
 	}
 	// 设置用户态维护的 fill 结构体，其中和内核态 fill_ring 相关的部分使用偏移
 	fill.Mask = umem.Config.FillSize - 1
@@ -189,7 +195,7 @@ func xskCreateUmemRings(umem *XskUmem, fd int, fill *XskRingProd, comp *XskRingC
 		unix.MAP_SHARED|unix.MAP_POPULATE)
 	if err != nil {
 		unix.Munmap(fillMap)
-		return fmt.Errorf("unix.Mmap compMap 失败: %v", err)
+		return xskError("mmap completion ring", ifname, queueId, err)
 	}
 	comp.Mask = umem.Config.CompSize - 1
 	comp.Size = umem.Config.CompSize
@@ -200,14 +206,45 @@ func xskCreateUmemRings(umem *XskUmem, fd int, fill *XskRingProd, comp *XskRingC
 	return nil
 }
 
-// xskGetMmapOffsets 获取指定文件描述符的 XDP 内存映射偏移量（内核版本 >= 5.4）。
-// 注意，内核版本 <= 5.3 的系统中，getsocketopt 没有 flag 字段，需要进一步处理，这里暂不支持 <= 5.3 的内核
+// xskMmapOffsetsV1 将内核 <= 5.3 返回的 xdp_mmap_offsets_v1 转换为 >= 5.4 的格式。
+// 旧内核的 getsockopt 没有 flags 字段，这里与 libxdp 相同，把 flags 放在旧内核中它本应在的位置，
+// 即 consumer 之后的 4 个字节（旧内核中该位置始终为 0，XskRingProdNeedsWakeup 永远返回 false）。
+//
+// 参数:
+//   - off: 指向以 v1 格式填充的 unix.XDPMmapOffsets 的指针，转换结果直接写回。
+func xskMmapOffsetsV1(off *unix.XDPMmapOffsets) {
+	offV1 := *(*xdpMmapOffsetsV1)(unsafe.Pointer(off))
+
+	off.Rx.Producer = offV1.Rx.Producer
+	off.Rx.Consumer = offV1.Rx.Consumer
+	off.Rx.Desc = offV1.Rx.Desc
+	off.Rx.Flags = offV1.Rx.Consumer + uint64(unsafe.Sizeof(uint32(0)))
+
+	off.Tx.Producer = offV1.Tx.Producer
+	off.Tx.Consumer = offV1.Tx.Consumer
+	off.Tx.Desc = offV1.Tx.Desc
+	off.Tx.Flags = offV1.Tx.Consumer + uint64(unsafe.Sizeof(uint32(0)))
+
+	off.Fr.Producer = offV1.Fr.Producer
+	off.Fr.Consumer = offV1.Fr.Consumer
+	off.Fr.Desc = offV1.Fr.Desc
+	off.Fr.Flags = offV1.Fr.Consumer + uint64(unsafe.Sizeof(uint32(0)))
+
+	off.Cr.Producer = offV1.Cr.Producer
+	off.Cr.Consumer = offV1.Cr.Consumer
+	off.Cr.Desc = offV1.Cr.Desc
+	off.Cr.Flags = offV1.Cr.Consumer + uint64(unsafe.Sizeof(uint32(0)))
+}
+
+// xskGetMmapOffsets 获取指定文件描述符的 XDP 内存映射偏移量。
+// 内核版本 <= 5.3 的系统中，getsockopt 返回的结构体没有 flags 字段，
+// 此时根据返回的长度识别出 v1 格式，并通过 xskMmapOffsetsV1 转换为新格式。
 // 参数:
 //   - fd: 文件描述符。
 //
 // 返回值:
 //   - unix.XDPMmapOffsets: 包含内存映射偏移量的结构体。
-//   - error: 如果调用失败，返回错误信息。
+//   - error: 如果调用失败或返回的长度无法识别，返回错误信息。
 func xskGetMmapOffsets(fd int) (unix.XDPMmapOffsets, error) {
 	var offsets unix.XDPMmapOffsets
 	var vallen = uint32(unsafe.Sizeof(offsets))
@@ -216,9 +253,88 @@ func xskGetMmapOffsets(fd int) (unix.XDPMmapOffsets, error) {
 		uintptr(unsafe.Pointer(&offsets)),
 		uintptr(unsafe.Pointer(&vallen)), 0)
 	if errno != 0 {
-		return offsets, fmt.Errorf("unix.Syscall6 getsockopt XDP_MMAP_OFFSETS 失败: %v", errno)
+		return offsets, fmt.Errorf("getsockopt XDP_MMAP_OFFSETS 失败: %w", errno)
+	}
+	switch vallen {
+	case uint32(unsafe.Sizeof(offsets)):
+		return offsets, nil
+	case uint32(unsafe.Sizeof(xdpMmapOffsetsV1{})):
+		xskMmapOffsetsV1(&offsets)
+		return offsets, nil
+	}
+	return offsets, fmt.Errorf("getsockopt XDP_MMAP_OFFSETS 返回了未知的长度 %d: %w", vallen, unix.EINVAL)
+}
+
+// xskUmemIsUnaligned 判断 umem 是否以非对齐块模式（XDP_UMEM_UNALIGNED_CHUNK_FLAG）注册。
+func xskUmemIsUnaligned(umem *XskUmem) bool {
+	return umem.Config.Flags&unix.XDP_UMEM_UNALIGNED_CHUNK_FLAG != 0
+}
+
+// XskUmemFrameAddr 返回描述符地址 addr 所在帧的起始地址，用于把 RX/TX/完成描述符归还到 fill ring 或空闲帧列表。
+// 对齐模式下，内核返回的地址是帧起始地址加上偏移（例如 XDP_PACKET_HEADROOM），帧大小为 2 的幂，直接按帧大小取整；
+// 非对齐模式下，偏移被编码在地址的高 16 位，低 48 位即为帧起始地址。
+//
+// 参数:
+//   - umem: 指向 XskUmem 结构体的指针。
+//   - addr: 描述符中的地址。
+//
+// 返回值:
+//   - uint64: 帧起始地址。
+func XskUmemFrameAddr(umem *XskUmem, addr uint64) uint64 {
+	if xskUmemIsUnaligned(umem) {
+		return XskUmemExtractAddr(addr)
+	}
+	return addr &^ uint64(umem.Config.FrameSize-1)
+}
+
+// XskUmemDataAddr 返回描述符地址 addr 指向的数据在 umem 区域中的实际偏移。
+// 对齐模式下地址本身就是数据偏移；非对齐模式下需要把高 16 位中的偏移加到低 48 位的帧地址上。
+//
+// 参数:
+//   - umem: 指向 XskUmem 结构体的指针。
+//   - addr: 描述符中的地址。
+//
+// 返回值:
+//   - uint64: 数据在 umem 区域中的偏移。
+func XskUmemDataAddr(umem *XskUmem, addr uint64) uint64 {
+	if xskUmemIsUnaligned(umem) {
+		return XskUmemAddOffsetToAddr(addr)
+	}
+	return addr
+}
+
+// XskUmemAddrWithOffset 根据帧起始地址和帧内偏移构造描述符地址，是 XskUmemFrameAddr 和 XskUmemDataAddr 的逆操作。
+// 非对齐模式下偏移被编码到高 16 位，这样完成描述符仍然可以还原出帧起始地址。
+//
+// 参数:
+//   - umem: 指向 XskUmem 结构体的指针。
+//   - frameAddr: 帧起始地址。
+//   - offset: 数据相对帧起始地址的偏移。
+//
+// 返回值:
+//   - uint64: 可以填入 TX 描述符的地址。
+func XskUmemAddrWithOffset(umem *XskUmem, frameAddr uint64, offset uint64) uint64 {
+	if xskUmemIsUnaligned(umem) {
+		return frameAddr | offset<<XSK_UNALIGNED_BUF_OFFSET_SHIFT
+	}
+	return frameAddr + offset
+}
+
+// XskUmemTxMetadata 返回 TX 描述符地址 addr 对应的 TX 元数据，即数据之前 TxMetadataLen 字节处的 XskTxMetadata。
+// umem 没有配置 TxMetadataLen 时返回 nil。写入数据时需要在帧内预留至少 TxMetadataLen 字节的偏移。
+//
+// 参数:
+//   - umem: 指向 XskUmem 结构体的指针。
+//   - addr: TX 描述符或完成描述符中的地址。
+//
+// 返回值:
+//   - *XskTxMetadata: 指向 umem 区域中元数据的指针。
+func XskUmemTxMetadata(umem *XskUmem, addr uint64) *XskTxMetadata {
+	if umem.Config.TxMetadataLen == 0 {
+		return nil
 	}
-	return offsets, nil
+	data := XskUmemDataAddr(umem, addr)
+	return (*XskTxMetadata)(XskUmemGetData(umem.UmemArea, data-uint64(umem.Config.TxMetadataLen)))
 }
 
 func XskUmemDelete(umem *XskUmem) error {
@@ -232,13 +348,27 @@ func XskUmemDelete(umem *XskUmem) error {
 		return unix.EBUSY
 	}
 
-	off, err = xskGetMmapOffsets(umem.Fd)
-	if err == nil && umem.FillSave != nil && umem.CompSave != nil {
-		unix.Munmap(unsafe.Slice((*byte)(unsafe.Pointer(uintptr(umem.FillSave.Ring)-uintptr(off.Fr.Desc))),
-			int(off.Fr.Desc+uint64(umem.Config.FillSize)*uint64(unsafe.Sizeof(uint64(0))))))
-		unix.Munmap(unsafe.Slice((*byte)(unsafe.Pointer(uintptr(umem.CompSave.Ring)-uintptr(off.Cr.Desc))),
-			int(off.Cr.Desc+uint64(umem.Config.CompSize)*uint64(unsafe.Sizeof(uint64(0))))))
+	logger := xskLogger(umem.Config.Logger)
+	// 暂存的 fill 和 comp 没有被套接字用掉时由 umem 解除映射
+	if umem.FillSave != nil && umem.CompSave != nil {
+		off, err = xskGetMmapOffsets(umem.Fd)
+		if err != nil {
+			logger.Warn("get mmap offsets failed, fill and completion rings not unmapped", "err", err)
+		} else {
+			err = unix.Munmap(unsafe.Slice((*byte)(unsafe.Pointer(uintptr(umem.FillSave.Ring)-uintptr(off.Fr.Desc))),
+				int(off.Fr.Desc+uint64(umem.Config.FillSize)*uint64(unsafe.Sizeof(uint64(0))))))
+			if err != nil {
+				logger.Warn("munmap fill ring failed", "err", err)
+			}
+			err = unix.Munmap(unsafe.Slice((*byte)(unsafe.Pointer(uintptr(umem.CompSave.Ring)-uintptr(off.Cr.Desc))),
+				int(off.Cr.Desc+uint64(umem.Config.CompSize)*uint64(unsafe.Sizeof(uint64(0))))))
+			if err != nil {
+				logger.Warn("munmap completion ring failed", "err", err)
+			}
+		}
+	}
+	if err = unix.Close(umem.Fd); err != nil {
+		logger.Warn("close umem socket failed", "err", err)
 	}
-	unix.Close(umem.Fd)
 	return nil
 }
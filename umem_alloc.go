@@ -0,0 +1,160 @@
+package xsk
+
+import (
+	"errors"
+	"math/bits"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	HUGEPAGE_SIZE_2M = 2 << 20
+	HUGEPAGE_SIZE_1G = 1 << 30
+)
+
+// UmemAllocator 决定 SimpleXsk 和 ComplexXsk 的 umem 区域如何分配。
+// 为 nil 时使用 AnonUmemAllocator，与之前的行为相同。
+type UmemAllocator interface {
+	// Alloc 分配至少 size 字节、按页对齐的内存，返回的切片长度为 size。
+	Alloc(size int) ([]byte, error)
+	// Free 释放 Alloc 返回的内存。
+	Free(area []byte) error
+}
+
+// AnonUmemAllocator 使用匿名私有映射（MAP_POPULATE）分配 umem。
+type AnonUmemAllocator struct{}
+
+func (AnonUmemAllocator) Alloc(size int) ([]byte, error) {
+	return unix.Mmap(-1, 0, size,
+		unix.PROT_READ|unix.PROT_WRITE,
+		unix.MAP_PRIVATE|unix.MAP_ANONYMOUS|unix.MAP_POPULATE)
+}
+
+func (AnonUmemAllocator) Free(area []byte) error {
+	return unix.Munmap(area)
+}
+
+// HugepageUmemAllocator 使用 hugetlb 大页分配 umem，减少大量帧带来的 TLB 缺失。
+// PageSize 为 HUGEPAGE_SIZE_2M（默认）或 HUGEPAGE_SIZE_1G，分配大小会向上取整到页大小。
+// 请求的大页不可用时依次退回到 2M 大页和普通页，NoFallback 为 true 时直接返回错误。
+// 需要事先通过 /sys/kernel/mm/hugepages 或 vm.nr_hugepages 预留足够的大页。
+type HugepageUmemAllocator struct {
+	PageSize   int
+	NoFallback bool
+}
+
+func (a HugepageUmemAllocator) Alloc(size int) ([]byte, error) {
+	pageSize := a.PageSize
+	if pageSize == 0 {
+		pageSize = HUGEPAGE_SIZE_2M
+	}
+	if pageSize != HUGEPAGE_SIZE_2M && pageSize != HUGEPAGE_SIZE_1G {
+		return nil, unix.EINVAL
+	}
+	area, err := xskMmapHugepage(size, pageSize)
+	if err == nil || a.NoFallback {
+		return area, err
+	}
+	if pageSize != HUGEPAGE_SIZE_2M {
+		area, err = xskMmapHugepage(size, HUGEPAGE_SIZE_2M)
+		if err == nil {
+			return area, nil
+		}
+	}
+	return AnonUmemAllocator{}.Alloc(size)
+}
+
+// Free 解除整个映射，area 的容量为取整后的映射大小。
+func (HugepageUmemAllocator) Free(area []byte) error {
+	return unix.Munmap(area[:cap(area)])
+}
+
+// xskMmapHugepage 以 pageSize 大小的 hugetlb 页映射 size 字节，返回的切片长度为 size，容量为取整后的映射大小。
+func xskMmapHugepage(size int, pageSize int) ([]byte, error) {
+	mapSize := (size + pageSize - 1) &^ (pageSize - 1)
+	area, err := unix.Mmap(-1, 0, mapSize,
+		unix.PROT_READ|unix.PROT_WRITE,
+		unix.MAP_PRIVATE|unix.MAP_ANONYMOUS|unix.MAP_POPULATE|unix.MAP_HUGETLB|
+			bits.TrailingZeros(uint(pageSize))<<unix.MAP_HUGE_SHIFT)
+	if err != nil {
+		return nil, err
+	}
+	return area[:size], nil
+}
+
+// MemfdUmemAllocator 使用 memfd 分配 umem，Fd 可以传递给其他进程映射同一块 umem。
+// Hugetlb 为 true 时使用 2M 大页（MFD_HUGETLB），分配大小会向上取整到 2M。
+// 每个 MemfdUmemAllocator 只能用于一个 umem，Free 时关闭 Fd。
+type MemfdUmemAllocator struct {
+	Name    string
+	Hugetlb bool
+	Fd      int
+}
+
+func (a *MemfdUmemAllocator) Alloc(size int) ([]byte, error) {
+	name := a.Name
+	if name == "" {
+		name = "xsk_umem"
+	}
+	flags := unix.MFD_CLOEXEC
+	mapSize := size
+	if a.Hugetlb {
+		flags |= unix.MFD_HUGETLB | unix.MFD_HUGE_2MB
+		mapSize = (size + HUGEPAGE_SIZE_2M - 1) &^ (HUGEPAGE_SIZE_2M - 1)
+	}
+	fd, err := unix.MemfdCreate(name, flags)
+	if err != nil {
+		return nil, err
+	}
+	err = unix.Ftruncate(fd, int64(mapSize))
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	area, err := unix.Mmap(fd, 0, mapSize,
+		unix.PROT_READ|unix.PROT_WRITE,
+		unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	a.Fd = fd
+	// 容量保留完整的映射大小，Free 时据此解除整个映射
+	return area[:size], nil
+}
+
+// Free 解除整个映射并关闭 Fd，解除映射失败时不关闭 Fd，以便调用者重试。
+func (a *MemfdUmemAllocator) Free(area []byte) error {
+	err := unix.Munmap(area[:cap(area)])
+	if err != nil {
+		return err
+	}
+	err = unix.Close(a.Fd)
+	a.Fd = -1
+	return err
+}
+
+// UserUmemAllocator 使用调用者提供的内存作为 umem，Area 必须按页对齐且不小于所需大小。
+// Free 不做任何操作，内存由调用者负责释放，并且在 SimpleXsk 或 ComplexXsk 关闭前必须保持有效。
+type UserUmemAllocator struct {
+	Area []byte
+}
+
+// UserUmemAllocator 的错误
+var ErrUmemAreaNotAligned = errors.New("umem area is not page aligned")
+var ErrUmemAreaTooSmall = errors.New("umem area is too small")
+
+func (a UserUmemAllocator) Alloc(size int) ([]byte, error) {
+	if len(a.Area) < size || len(a.Area) == 0 {
+		return nil, ErrUmemAreaTooSmall
+	}
+	if !xskPageAligned(unsafe.Pointer(&a.Area[0])) {
+		return nil, ErrUmemAreaNotAligned
+	}
+	return a.Area[:size], nil
+}
+
+func (UserUmemAllocator) Free(area []byte) error {
+	return nil
+}
@@ -0,0 +1,61 @@
+package xsk
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestUmemAllocator(t *testing.T) {
+	allocators := []UmemAllocator{
+		AnonUmemAllocator{},
+		HugepageUmemAllocator{},
+		HugepageUmemAllocator{PageSize: HUGEPAGE_SIZE_1G},
+		&MemfdUmemAllocator{},
+		&MemfdUmemAllocator{Hugetlb: true},
+	}
+	// 第二个大小不是 2M 的整数倍，大页映射会向上取整
+	for _, size := range []int{4096 * 2048, 4096 * 3} {
+		for _, allocator := range allocators {
+			area, err := allocator.Alloc(size)
+			if err != nil {
+				t.Fatalf("%T: Failed to allocate umem: %v", allocator, err)
+			}
+			if len(area) != size {
+				t.Errorf("%T: Expected umem size to be %d, got %d", allocator, size, len(area))
+			}
+			area[0] = 1
+			area[size-1] = 1
+			if err := allocator.Free(area); err != nil {
+				t.Errorf("%T: Failed to free umem of size %d: %v", allocator, size, err)
+			}
+		}
+	}
+
+	if _, err := (HugepageUmemAllocator{PageSize: 4096}).Alloc(4096); !errors.Is(err, unix.EINVAL) {
+		t.Errorf("Expected EINVAL for invalid page size, got %v", err)
+	}
+}
+
+func TestUserUmemAllocator(t *testing.T) {
+	buf, err := AnonUmemAllocator{}.Alloc(2 * 4096)
+	if err != nil {
+		t.Fatalf("Failed to allocate buffer: %v", err)
+	}
+	defer unix.Munmap(buf)
+
+	area, err := UserUmemAllocator{Area: buf}.Alloc(4096)
+	if err != nil {
+		t.Fatalf("Failed to allocate umem: %v", err)
+	}
+	if &area[0] != &buf[0] || len(area) != 4096 {
+		t.Errorf("Expected umem to use the provided buffer")
+	}
+	if _, err := (UserUmemAllocator{Area: buf[1:]}).Alloc(4096); !errors.Is(err, ErrUmemAreaNotAligned) {
+		t.Errorf("Expected ErrUmemAreaNotAligned, got %v", err)
+	}
+	if _, err := (UserUmemAllocator{Area: buf}).Alloc(3 * 4096); !errors.Is(err, ErrUmemAreaTooSmall) {
+		t.Errorf("Expected ErrUmemAreaTooSmall, got %v", err)
+	}
+}
@@ -174,3 +174,49 @@ func TestXskUmemCreateWithFd(t *testing.T) {
 		t.Fatalf("XskUmemDelete failed: %v", err)
 	}
 }
+
+func TestXskMmapOffsetsV1(t *testing.T) {
+	var off unix.XDPMmapOffsets
+	offV1 := (*xdpMmapOffsetsV1)(unsafe.Pointer(&off))
+	offV1.Rx = xdpRingOffsetV1{Producer: 0, Consumer: 64, Desc: 128}
+	offV1.Tx = xdpRingOffsetV1{Producer: 0, Consumer: 64, Desc: 192}
+	offV1.Fr = xdpRingOffsetV1{Producer: 0, Consumer: 128, Desc: 256}
+	offV1.Cr = xdpRingOffsetV1{Producer: 0, Consumer: 128, Desc: 320}
+
+	xskMmapOffsetsV1(&off)
+
+	expected := unix.XDPMmapOffsets{
+		Rx: unix.XDPRingOffset{Producer: 0, Consumer: 64, Desc: 128, Flags: 68},
+		Tx: unix.XDPRingOffset{Producer: 0, Consumer: 64, Desc: 192, Flags: 68},
+		Fr: unix.XDPRingOffset{Producer: 0, Consumer: 128, Desc: 256, Flags: 132},
+		Cr: unix.XDPRingOffset{Producer: 0, Consumer: 128, Desc: 320, Flags: 132},
+	}
+	if off != expected {
+		t.Errorf("Expected offsets to be %+v, got %+v", expected, off)
+	}
+}
+
+func TestXskUmemFrameAddr(t *testing.T) {
+	aligned := &XskUmem{Config: XskUmemConfig{FrameSize: 2048}}
+	if addr := XskUmemFrameAddr(aligned, 3*2048+256); addr != 3*2048 {
+		t.Errorf("Expected aligned frame addr to be %d, got %d", 3*2048, addr)
+	}
+	if addr := XskUmemDataAddr(aligned, 3*2048+256); addr != 3*2048+256 {
+		t.Errorf("Expected aligned data addr to be %d, got %d", 3*2048+256, addr)
+	}
+	if addr := XskUmemAddrWithOffset(aligned, 3*2048, 256); addr != 3*2048+256 {
+		t.Errorf("Expected aligned desc addr to be %d, got %d", 3*2048+256, addr)
+	}
+
+	unaligned := &XskUmem{Config: XskUmemConfig{FrameSize: 3000, Flags: unix.XDP_UMEM_UNALIGNED_CHUNK_FLAG}}
+	descAddr := XskUmemAddrWithOffset(unaligned, 3*3000, 256)
+	if descAddr != 3*3000|256<<XSK_UNALIGNED_BUF_OFFSET_SHIFT {
+		t.Errorf("Expected unaligned desc addr to encode the offset, got %#x", descAddr)
+	}
+	if addr := XskUmemFrameAddr(unaligned, descAddr); addr != 3*3000 {
+		t.Errorf("Expected unaligned frame addr to be %d, got %d", 3*3000, addr)
+	}
+	if addr := XskUmemDataAddr(unaligned, descAddr); addr != 3*3000+256 {
+		t.Errorf("Expected unaligned data addr to be %d, got %d", 3*3000+256, addr)
+	}
+}
@@ -0,0 +1,104 @@
+package xsk
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// 以 XDP_USE_NEED_WAKEUP 绑定时，内核只在环的 flags 中设置了 XDP_RING_NEED_WAKEUP 后才需要用户态唤醒：
+//
+//	if (xsk_ring_prod__needs_wakeup(&xsk->tx))
+//		sendto(xsk_socket__fd(xsk->xsk), NULL, 0, MSG_DONTWAIT, NULL, 0);
+//	if (xsk_ring_prod__needs_wakeup(&umem->fq))
+//		recvfrom(xsk_socket__fd(xsk->xsk), NULL, 0, MSG_DONTWAIT, NULL, NULL);
+//
+// 未使用 XDP_USE_NEED_WAKEUP 时内核从不设置该标志，此时 tx ring 的描述符只有 sendto 才会发送（复制模式下 sendto 就是发送本身），
+// 而 fill ring 由驱动自行消费，不需要唤醒。
+
+// XskWakeupStats 为套接字唤醒内核的次数，只统计实际发起的系统调用（包括忙轮询）
+type XskWakeupStats struct {
+	TxKicks   uint64 // 为发送 tx ring 中的描述符调用 sendto 的次数
+	RxWakeups uint64 // 因 fill ring 需要唤醒调用 recvfrom 的次数
+}
+
+type xskWakeupCounters struct {
+	txKicks   atomic.Uint64
+	rxWakeups atomic.Uint64
+}
+
+// xskWakeupErrorIgnored 判断唤醒失败是否只是内核暂时无法处理（与 libxdp 示例中的 kick_tx 相同），下次唤醒时会重试。
+func xskWakeupErrorIgnored(errno unix.Errno) bool {
+	switch errno {
+	case 0, unix.EAGAIN, unix.EBUSY, unix.ENOBUFS, unix.ENETDOWN:
+		return true
+	}
+	return false
+}
+
+// XskSocketKickTx 通知内核发送 tx ring 中已提交的描述符。
+// 以 XDP_USE_NEED_WAKEUP 绑定时只在 tx ring 设置了 XDP_RING_NEED_WAKEUP 时调用 sendto，否则以及忙轮询模式下每次都调用。
+// 内核暂时无法发送（EAGAIN、EBUSY、ENOBUFS、ENETDOWN）时不返回错误。
+func XskSocketKickTx(xsk *XskSocket) error {
+	if xsk.Tx == nil {
+		return nil
+	}
+	if xsk.Ctx.Umem.needWakeup && !XskRingProdNeedsWakeup(xsk.Tx) && !XskSocketBusyPoll(xsk) {
+		return nil
+	}
+	xsk.wakeups.txKicks.Add(1)
+	_, _, errno := unix.Syscall6(unix.SYS_SENDTO, uintptr(xsk.Fd), 0, 0, unix.MSG_DONTWAIT, 0, 0)
+	if xskWakeupErrorIgnored(errno) {
+		return nil
+	}
+	return errno
+}
+
+// XskSocketWakeupRx 在 fill ring 设置了 XDP_RING_NEED_WAKEUP 时调用 recvfrom，让驱动继续从 fill ring 中取帧接收数据包。
+// 忙轮询模式下每次都调用 recvfrom 驱动 NAPI，否则未以 XDP_USE_NEED_WAKEUP 绑定时什么也不做。
+func XskSocketWakeupRx(xsk *XskSocket) error {
+	if !XskSocketBusyPoll(xsk) && (!xsk.Ctx.Umem.needWakeup || !XskRingProdNeedsWakeup(xsk.Ctx.Fill)) {
+		return nil
+	}
+	xsk.wakeups.rxWakeups.Add(1)
+	_, _, errno := unix.Syscall6(unix.SYS_RECVFROM, uintptr(xsk.Fd), 0, 0, unix.MSG_DONTWAIT, 0, 0)
+	if xskWakeupErrorIgnored(errno) {
+		return nil
+	}
+	return errno
+}
+
+// xskDrainInterval 为等待发送完成时检查 completion ring 的间隔，completion ring 的更新不会唤醒 poll
+const xskDrainInterval = time.Millisecond
+
+// xskDrainTx 不断通知内核发送 tx ring 中的描述符，直到 pending 返回 0 或 ctx 结束。
+// pending 返回尚未完成发送的描述符数量，可以在其中回收 completion ring。
+func xskDrainTx(ctx context.Context, xsk *XskSocket, pending func() uint32) error {
+	ticker := time.NewTicker(xskDrainInterval)
+	defer ticker.Stop()
+	for {
+		n := pending()
+		if n == 0 {
+			return nil
+		}
+		if err := XskSocketKickTx(xsk); err != nil {
+			return fmt.Errorf("%d tx descriptors not completed: %w", n, err)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d tx descriptors not completed: %w", n, context.Cause(ctx))
+		case <-ticker.C:
+		}
+	}
+}
+
+// XskSocketGetWakeupStats 返回套接字唤醒内核的次数。
+func XskSocketGetWakeupStats(xsk *XskSocket) XskWakeupStats {
+	return XskWakeupStats{
+		TxKicks:   xsk.wakeups.txKicks.Load(),
+		RxWakeups: xsk.wakeups.rxWakeups.Load(),
+	}
+}
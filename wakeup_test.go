@@ -0,0 +1,85 @@
+package xsk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestXskSocketWakeup(t *testing.T) {
+	fd, err := unix.Socket(unix.AF_XDP, unix.SOCK_RAW, 0)
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	defer unix.Close(fd)
+
+	var txFlags, fillFlags uint32
+	xsk := &XskSocket{
+		Tx:  &XskRingProd{Flags: &txFlags},
+		Ctx: &XskCtx{Fill: &XskRingProd{Flags: &fillFlags}, Umem: &XskUmem{needWakeup: true}},
+		Fd:  fd,
+	}
+
+	// 环没有设置 XDP_RING_NEED_WAKEUP 时不唤醒
+	if err := XskSocketKickTx(xsk); err != nil {
+		t.Errorf("KickTx failed: %v", err)
+	}
+	if err := XskSocketWakeupRx(xsk); err != nil {
+		t.Errorf("WakeupRx failed: %v", err)
+	}
+	if stats := XskSocketGetWakeupStats(xsk); stats != (XskWakeupStats{}) {
+		t.Errorf("Expected no wakeups, got %+v", stats)
+	}
+
+	// 未绑定的套接字返回 ENXIO，说明确实发起了系统调用
+	txFlags = unix.XDP_RING_NEED_WAKEUP
+	fillFlags = unix.XDP_RING_NEED_WAKEUP
+	if err := XskSocketKickTx(xsk); !errors.Is(err, unix.ENXIO) {
+		t.Errorf("Expected ENXIO from KickTx, got %v", err)
+	}
+	if err := XskSocketWakeupRx(xsk); !errors.Is(err, unix.ENXIO) {
+		t.Errorf("Expected ENXIO from WakeupRx, got %v", err)
+	}
+	if stats := XskSocketGetWakeupStats(xsk); stats != (XskWakeupStats{TxKicks: 1, RxWakeups: 1}) {
+		t.Errorf("Unexpected wakeup stats %+v", stats)
+	}
+
+	// 未使用 XDP_USE_NEED_WAKEUP 时每次都调用 sendto，fill ring 不需要唤醒
+	txFlags = 0
+	xsk.Ctx.Umem.needWakeup = false
+	XskSocketKickTx(xsk)
+	XskSocketWakeupRx(xsk)
+	if stats := XskSocketGetWakeupStats(xsk); stats != (XskWakeupStats{TxKicks: 2, RxWakeups: 1}) {
+		t.Errorf("Unexpected wakeup stats %+v", stats)
+	}
+}
+
+func TestXskDrainTx(t *testing.T) {
+	const ringSize = 8
+	tx, txCons := newTestRings(ringSize, unsafe.Sizeof(XDPDesc{}))
+	compProd, comp := newTestRings(ringSize, 8)
+	xsk := &ComplexXsk{comp: comp, tx: *tx}
+	xsk.xsk = &XskSocket{Tx: &xsk.tx, Ctx: &XskCtx{Umem: &XskUmem{needWakeup: true}}, Fd: -1}
+
+	pos := uint32(0)
+	XskRingProdSubmit(&xsk.tx, XskRingProdReserve(&xsk.tx, 3, &pos))
+	if n := xsk.txPending(); n != 3 {
+		t.Fatalf("Expected 3 pending descs, got %d", n)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := xskDrainTx(ctx, xsk.xsk, xsk.txPending); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// 内核取走描述符并写入 completion ring 后完成
+	XskRingConsRelease(txCons, XskRingConsPeek(txCons, ringSize, &pos))
+	XskRingProdSubmit(compProd, XskRingProdReserve(compProd, 3, &pos))
+	if err := xskDrainTx(context.Background(), xsk.xsk, xsk.txPending); err != nil {
+		t.Errorf("xskDrainTx failed: %v", err)
+	}
+}
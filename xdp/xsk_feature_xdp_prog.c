@@ -0,0 +1,69 @@
+/* SPDX-License-Identifier: GPL-2.0 */
+
+#include <linux/bpf.h>
+#include <bpf/bpf_helpers.h>
+
+#include "xsk_def_xdp_prog.h"
+#include "xsk_features.h"
+
+#define DEFAULT_QUEUE_IDS 64
+
+/* 设置 XSK_LIBBPF_FLAGS__FANOUT 时为每个队列保留 XSK_FANOUT_MAX_SOCKETS 项，载入时按队列数修改大小 */
+struct {
+	__uint(type, BPF_MAP_TYPE_XSKMAP);
+	__uint(key_size, sizeof(int));
+	__uint(value_size, sizeof(int));
+	__uint(max_entries, DEFAULT_QUEUE_IDS);
+} xsks_map SEC(".maps");
+
+/* Program refcount, in order to work properly,
+ * must be declared before any other global variables
+ * and initialized with '1'.
+ */
+volatile int refcnt = 1;
+
+/* 程序附加的处理，共享程序的套接字必须请求相同的处理 */
+volatile __u32 features SEC(".data") = 0;
+
+/* 载入时改写，校验器会删除未启用的处理 */
+volatile const __u32 xsk_features = 0;
+/* 内核是否支持 bpf_redirect_map 的 flags（5.3 及以上） */
+volatile const __u32 xsk_redirect_flags = 1;
+
+SEC("xdp")
+int __attribute__((btf_decl_tag("entry_func"))) xsk_def_prog(struct xdp_md *ctx)
+{
+	__u32 index, key;
+
+	/* Make sure refcount is referenced by the program */
+	if (!refcnt)
+		return XDP_PASS;
+
+	if ((xsk_features & XSK_LIBBPF_FLAGS__FILTER) && !xsk_filter_match(ctx))
+		return XDP_PASS;
+	if ((xsk_features & XSK_LIBBPF_FLAGS__SAMPLE) && !xsk_sample_match(ctx))
+		return XDP_PASS;
+	if (xsk_features & XSK_LIBBPF_FLAGS__RX_METADATA)
+		xsk_rx_metadata(ctx);
+
+	if (xsk_features & XSK_LIBBPF_FLAGS__FANOUT) {
+		if (!xsk_fanout_select(ctx, &xsks_map, &key))
+			return XDP_PASS;
+		return bpf_redirect_map(&xsks_map, key, 0);
+	}
+
+	/* A set entry here means that the corresponding queue_id
+	 * has an active AF_XDP socket bound to it.
+	 */
+	if (xsk_redirect_flags)
+		return bpf_redirect_map(&xsks_map, ctx->rx_queue_index, XDP_PASS);
+
+	/* 与 xsk_def_xdp_prog_5.3.c 相同 */
+	index = ctx->rx_queue_index;
+	if (bpf_map_lookup_elem(&xsks_map, &index))
+		return bpf_redirect_map(&xsks_map, index, 0);
+	return XDP_PASS;
+}
+
+char _license[] SEC("license") = "GPL";
+__uint(xsk_prog_version, XSK_PROG_VERSION) SEC(XDP_METADATA_SECTION);
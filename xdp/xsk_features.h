@@ -0,0 +1,422 @@
+// SPDX-License-Identifier: (GPL-2.0 OR BSD-2-Clause)
+
+/* 默认程序的可选处理（过滤、采样、分发和 RX 元数据），对应 LibbpfFlags 中的 XSK_LIBBPF_FLAGS__*。
+ * map 的名称和大小与 filter.go、sample.go、fanout.go 中创建的 map 相同，载入时由 Go 创建的 map 替换。
+ */
+
+#ifndef __XSK_FEATURES_H
+#define __XSK_FEATURES_H
+
+#include <linux/bpf.h>
+#include <linux/if_ether.h>
+#include <linux/in.h>
+#include <linux/ip.h>
+#include <linux/ipv6.h>
+#include <bpf/bpf_helpers.h>
+#include <bpf/bpf_endian.h>
+
+/* 与 const.go 相同 */
+#define XSK_LIBBPF_FLAGS__RX_METADATA (1 << 1)
+#define XSK_LIBBPF_FLAGS__FILTER (1 << 3)
+#define XSK_LIBBPF_FLAGS__SAMPLE (1 << 4)
+#define XSK_LIBBPF_FLAGS__FANOUT (1 << 5)
+
+#define XSK_RX_METADATA_MAGIC 0x78736b6d
+#define XSK_RX_METADATA__TIMESTAMP (1 << 0)
+#define XSK_RX_METADATA__HASH (1 << 1)
+#define XSK_RX_METADATA__VLAN_TAG (1 << 2)
+
+#define XSK_SAMPLE_MODE__ALL 0
+#define XSK_SAMPLE_MODE__ONE_IN_N 1
+#define XSK_SAMPLE_MODE__PER_SECOND 2
+
+#define XSK_FILTER_MAX_RULES 64
+#define XSK_FANOUT_MAX_SOCKETS 64
+#define XSK_FANOUT_MAX_STEERING 4096
+
+/* 采样和分发的 map 以队列号为键，载入时按队列数修改大小 */
+#define XSK_DEFAULT_QUEUE_IDS 64
+
+#define NSEC_PER_SEC 1000000000ULL
+#define IP_OFFSET 0x1fff
+
+/* 过滤（见 filter.go）：规则以掩码的形式保存在 map 中，第 i 位表示第 i 条规则 */
+struct xsk_filter_config {
+	__u64 active;
+	__u64 any_eth;
+	__u64 any_proto;
+	__u64 any_src;
+	__u64 any_dst;
+	__u64 any_sport;
+	__u64 any_dport;
+};
+
+struct xsk_filter_port {
+	__u64 src;
+	__u64 dst;
+};
+
+/* struct bpf_lpm_trie_key，IPv4 地址保存为 IPv4 映射的 IPv6 地址 */
+struct xsk_filter_lpm_key {
+	__u32 prefixlen;
+	__u8 addr[16];
+};
+
+/* 第 0 项为 struct xsk_filter_config，第 1 项起保存规则，仅由用户态读写 */
+struct {
+	__uint(type, BPF_MAP_TYPE_ARRAY);
+	__uint(key_size, sizeof(__u32));
+	__uint(value_size, sizeof(struct xsk_filter_config));
+	__uint(max_entries, 1 + XSK_FILTER_MAX_RULES);
+} xsk_filter SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(key_size, sizeof(__be16));
+	__uint(value_size, sizeof(__u64));
+	__uint(max_entries, XSK_FILTER_MAX_RULES);
+} xsk_filt_eth SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_ARRAY);
+	__uint(key_size, sizeof(__u32));
+	__uint(value_size, sizeof(__u64));
+	__uint(max_entries, 256);
+} xsk_filt_proto SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_LPM_TRIE);
+	__uint(key_size, sizeof(struct xsk_filter_lpm_key));
+	__uint(value_size, sizeof(__u64));
+	__uint(max_entries, XSK_FILTER_MAX_RULES + 1);
+	__uint(map_flags, BPF_F_NO_PREALLOC);
+} xsk_filt_src SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_LPM_TRIE);
+	__uint(key_size, sizeof(struct xsk_filter_lpm_key));
+	__uint(value_size, sizeof(__u64));
+	__uint(max_entries, XSK_FILTER_MAX_RULES + 1);
+	__uint(map_flags, BPF_F_NO_PREALLOC);
+} xsk_filt_dst SEC(".maps");
+
+/* 以主机字节序的端口为键 */
+struct {
+	__uint(type, BPF_MAP_TYPE_ARRAY);
+	__uint(key_size, sizeof(__u32));
+	__uint(value_size, sizeof(struct xsk_filter_port));
+	__uint(max_entries, 1 << 16);
+} xsk_filt_port SEC(".maps");
+
+/* 采样（见 sample.go） */
+struct xsk_sample_config {
+	__u32 mode;
+	__u32 rate;
+};
+
+struct xsk_sample_state {
+	__u64 counter;
+	__u64 window_start;
+	__u64 window_count;
+	__u64 sampled;
+	__u64 skipped;
+};
+
+struct {
+	__uint(type, BPF_MAP_TYPE_ARRAY);
+	__uint(key_size, sizeof(__u32));
+	__uint(value_size, sizeof(struct xsk_sample_config));
+	__uint(max_entries, XSK_DEFAULT_QUEUE_IDS);
+} xsk_sample SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_ARRAY);
+	__uint(key_size, sizeof(__u32));
+	__uint(value_size, sizeof(struct xsk_sample_state));
+	__uint(max_entries, XSK_DEFAULT_QUEUE_IDS);
+} xsk_sample_st SEC(".maps");
+
+/* 分发（见 fanout.go）：xsks_map 的键为 queue * XSK_FANOUT_MAX_SOCKETS + slot */
+struct xsk_fanout_config {
+	__u32 num;
+	__u8 slots[XSK_FANOUT_MAX_SOCKETS];
+};
+
+struct xsk_fanout_steer_key {
+	__u32 queue;
+	__be16 dport;
+	__u16 pad;
+};
+
+struct {
+	__uint(type, BPF_MAP_TYPE_ARRAY);
+	__uint(key_size, sizeof(__u32));
+	__uint(value_size, sizeof(struct xsk_fanout_config));
+	__uint(max_entries, XSK_DEFAULT_QUEUE_IDS);
+} xsk_fanout SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(key_size, sizeof(struct xsk_fanout_steer_key));
+	__uint(value_size, sizeof(__u32));
+	__uint(max_entries, XSK_FANOUT_MAX_STEERING);
+} xsk_fan_steer SEC(".maps");
+
+/* RX 元数据，与 rx_metadata.go 中 XskGetRxMetadata 的解码一致 */
+struct xsk_rx_meta {
+	__u64 timestamp;
+	__u32 hash;
+	__u32 hash_type;
+	__be16 vlan_proto;
+	__u16 vlan_tci;
+	__u32 flags;
+	__u32 magic;
+	__u32 pad;
+};
+
+/* 只有绑定设备的程序可以调用，载入时由 Go 替换为 kfunc 的 BTF ID，不能调用时替换为 r0 = -EOPNOTSUPP */
+extern int bpf_xdp_metadata_rx_timestamp(const struct xdp_md *ctx, __u64 *timestamp) __ksym __weak;
+extern int bpf_xdp_metadata_rx_hash(const struct xdp_md *ctx, __u32 *hash, __u32 *rss_type) __ksym __weak;
+extern int bpf_xdp_metadata_rx_vlan_tag(const struct xdp_md *ctx, __be16 *vlan_proto, __u16 *vlan_tci) __ksym __weak;
+
+/* xsk_has_ports 返回 L4 头部是否以源端口和目的端口开头 */
+static __always_inline int xsk_has_ports(__u32 proto, void *l4, void *data_end)
+{
+	if (proto != IPPROTO_TCP && proto != IPPROTO_UDP && proto != IPPROTO_SCTP)
+		return 0;
+	return l4 && l4 + 4 <= data_end;
+}
+
+/* xsk_filter_match 返回数据包是否匹配至少一条规则 */
+static __always_inline int xsk_filter_match(struct xdp_md *ctx)
+{
+	void *data = (void *)(long)ctx->data;
+	void *data_end = (void *)(long)ctx->data_end;
+	struct xsk_filter_lpm_key src = { .prefixlen = 128 };
+	struct xsk_filter_lpm_key dst = { .prefixlen = 128 };
+	struct xsk_filter_config *conf;
+	struct xsk_filter_port *port;
+	struct ethhdr *eth = data;
+	__u32 zero = 0, proto = 0, sport, dport;
+	void *l4 = NULL;
+	__be16 h_proto;
+	__u64 match, *val;
+
+	conf = bpf_map_lookup_elem(&xsk_filter, &zero);
+	if (!conf)
+		return 0;
+	match = conf->active;
+	if (!match || (void *)(eth + 1) > data_end)
+		return 0;
+	h_proto = eth->h_proto;
+	val = bpf_map_lookup_elem(&xsk_filt_eth, &h_proto);
+	match &= conf->any_eth | (val ? *val : 0);
+	if (!match)
+		return 0;
+
+	if (h_proto == bpf_htons(ETH_P_IP)) {
+		struct iphdr *iph = (void *)(eth + 1);
+
+		if ((void *)(iph + 1) > data_end)
+			goto noip;
+		proto = iph->protocol;
+		src.addr[10] = dst.addr[10] = 0xff;
+		src.addr[11] = dst.addr[11] = 0xff;
+		__builtin_memcpy(&src.addr[12], &iph->saddr, 4);
+		__builtin_memcpy(&dst.addr[12], &iph->daddr, 4);
+		/* 后续分片没有端口 */
+		if (!(iph->frag_off & bpf_htons(IP_OFFSET)))
+			l4 = (void *)iph + iph->ihl * 4;
+	} else if (h_proto == bpf_htons(ETH_P_IPV6)) {
+		struct ipv6hdr *ip6h = (void *)(eth + 1);
+
+		if ((void *)(ip6h + 1) > data_end)
+			goto noip;
+		proto = ip6h->nexthdr;
+		__builtin_memcpy(src.addr, &ip6h->saddr, 16);
+		__builtin_memcpy(dst.addr, &ip6h->daddr, 16);
+		l4 = ip6h + 1;
+	} else {
+		goto noip;
+	}
+
+	val = bpf_map_lookup_elem(&xsk_filt_proto, &proto);
+	match &= conf->any_proto | (val ? *val : 0);
+	if (!match)
+		return 0;
+	val = bpf_map_lookup_elem(&xsk_filt_src, &src);
+	match &= val ? *val : 0;
+	if (!match)
+		return 0;
+	val = bpf_map_lookup_elem(&xsk_filt_dst, &dst);
+	match &= val ? *val : 0;
+	if (!match)
+		return 0;
+
+	if (!xsk_has_ports(proto, l4, data_end)) {
+		match &= conf->any_sport & conf->any_dport;
+		return match != 0;
+	}
+	sport = bpf_ntohs(((__be16 *)l4)[0]);
+	dport = bpf_ntohs(((__be16 *)l4)[1]);
+	port = bpf_map_lookup_elem(&xsk_filt_port, &sport);
+	match &= conf->any_sport | (port ? port->src : 0);
+	if (!match)
+		return 0;
+	port = bpf_map_lookup_elem(&xsk_filt_port, &dport);
+	match &= conf->any_dport | (port ? port->dst : 0);
+	return match != 0;
+
+noip:
+	/* 非 IP 数据包只匹配不限制协议号、地址和端口的规则 */
+	match &= conf->any_proto & conf->any_src & conf->any_dst & conf->any_sport & conf->any_dport;
+	return match != 0;
+}
+
+/* xsk_sample_match 按队列的采样配置返回是否重定向数据包，没有配置时重定向 */
+static __always_inline int xsk_sample_match(struct xdp_md *ctx)
+{
+	__u32 queue = ctx->rx_queue_index;
+	struct xsk_sample_config *conf;
+	struct xsk_sample_state *st;
+	__u64 now;
+
+	conf = bpf_map_lookup_elem(&xsk_sample, &queue);
+	st = bpf_map_lookup_elem(&xsk_sample_st, &queue);
+	if (!conf || !st)
+		return 1;
+
+	/* 同一个队列的数据包由同一个 CPU 处理，counter 和 window_* 不需要原子操作 */
+	switch (conf->mode) {
+	case XSK_SAMPLE_MODE__ONE_IN_N:
+		if (++st->counter < conf->rate)
+			goto skipped;
+		st->counter = 0;
+		break;
+	case XSK_SAMPLE_MODE__PER_SECOND:
+		now = bpf_ktime_get_ns();
+		if (now - st->window_start >= NSEC_PER_SEC) {
+			st->window_start = now;
+			st->window_count = 0;
+		}
+		if (st->window_count >= conf->rate)
+			goto skipped;
+		st->window_count++;
+		break;
+	}
+	__sync_fetch_and_add(&st->sampled, 1);
+	return 1;
+
+skipped:
+	__sync_fetch_and_add(&st->skipped, 1);
+	return 0;
+}
+
+static __always_inline __u32 xsk_fanout_mix(__u32 hash, __u32 v)
+{
+	return (hash ^ v) * 0x9e3779b1;
+}
+
+/* murmur3 的 fmix32，使哈希的高位也影响取模的结果 */
+static __always_inline __u32 xsk_fanout_final(__u32 hash)
+{
+	hash ^= hash >> 16;
+	hash *= 0x85ebca6b;
+	hash ^= hash >> 13;
+	hash *= 0xc2b2ae35;
+	hash ^= hash >> 16;
+	return hash;
+}
+
+/* xsk_fanout_select 为数据包选择队列中的套接字，xsks 中有对应的套接字时把键保存在 *key 中并返回 1。
+ * 导向规则指定的槽位上有套接字时使用该槽位，否则按五元组的哈希选择正在使用的槽位。
+ */
+static __always_inline int xsk_fanout_select(struct xdp_md *ctx, void *xsks, __u32 *key)
+{
+	void *data = (void *)(long)ctx->data;
+	void *data_end = (void *)(long)ctx->data_end;
+	struct xsk_fanout_steer_key steer = {};
+	__u32 queue = ctx->rx_queue_index;
+	struct xsk_fanout_config *conf;
+	struct ethhdr *eth = data;
+	__u32 hash = 0, proto, idx, i, *slot;
+	void *l4 = NULL;
+
+	conf = bpf_map_lookup_elem(&xsk_fanout, &queue);
+	if (!conf || !conf->num)
+		return 0;
+	if ((void *)(eth + 1) > data_end)
+		goto hash;
+	if (eth->h_proto == bpf_htons(ETH_P_IP)) {
+		struct iphdr *iph = (void *)(eth + 1);
+
+		if ((void *)(iph + 1) > data_end)
+			goto hash;
+		hash = xsk_fanout_mix(hash, iph->saddr);
+		hash = xsk_fanout_mix(hash, iph->daddr);
+		proto = iph->protocol;
+		if (!(iph->frag_off & bpf_htons(IP_OFFSET)))
+			l4 = (void *)iph + iph->ihl * 4;
+	} else if (eth->h_proto == bpf_htons(ETH_P_IPV6)) {
+		struct ipv6hdr *ip6h = (void *)(eth + 1);
+
+		if ((void *)(ip6h + 1) > data_end)
+			goto hash;
+		for (i = 0; i < 4; i++)
+			hash = xsk_fanout_mix(hash, ip6h->saddr.in6_u.u6_addr32[i]);
+		for (i = 0; i < 4; i++)
+			hash = xsk_fanout_mix(hash, ip6h->daddr.in6_u.u6_addr32[i]);
+		proto = ip6h->nexthdr;
+		l4 = ip6h + 1;
+	} else {
+		goto hash;
+	}
+	/* 后续分片没有端口，只按地址计算哈希 */
+	if (!l4)
+		goto hash;
+	hash = xsk_fanout_mix(hash, proto);
+	if (!xsk_has_ports(proto, l4, data_end))
+		goto hash;
+	hash = xsk_fanout_mix(hash, *(__u32 *)l4);
+
+	steer.queue = queue;
+	steer.dport = ((__be16 *)l4)[1];
+	slot = bpf_map_lookup_elem(&xsk_fan_steer, &steer);
+	if (slot && *slot < XSK_FANOUT_MAX_SOCKETS) {
+		*key = queue * XSK_FANOUT_MAX_SOCKETS + *slot;
+		if (bpf_map_lookup_elem(xsks, key))
+			return 1;
+	}
+
+hash:
+	idx = xsk_fanout_final(hash) % conf->num;
+	if (idx >= XSK_FANOUT_MAX_SOCKETS)
+		return 0;
+	*key = queue * XSK_FANOUT_MAX_SOCKETS + conf->slots[idx];
+	return bpf_map_lookup_elem(xsks, key) != NULL;
+}
+
+/* xsk_rx_metadata 把 RX 硬件提示写入数据包之前的元数据区域，不可用的提示对应的标志位为 0 */
+static __always_inline void xsk_rx_metadata(struct xdp_md *ctx)
+{
+	struct xsk_rx_meta meta = {};
+	void *data, *data_meta;
+
+	if (bpf_xdp_adjust_meta(ctx, -(int)sizeof(meta)))
+		return;
+	if (!bpf_xdp_metadata_rx_timestamp(ctx, &meta.timestamp))
+		meta.flags |= XSK_RX_METADATA__TIMESTAMP;
+	if (!bpf_xdp_metadata_rx_hash(ctx, &meta.hash, &meta.hash_type))
+		meta.flags |= XSK_RX_METADATA__HASH;
+	if (!bpf_xdp_metadata_rx_vlan_tag(ctx, &meta.vlan_proto, &meta.vlan_tci))
+		meta.flags |= XSK_RX_METADATA__VLAN_TAG;
+	meta.magic = XSK_RX_METADATA_MAGIC;
+
+	data_meta = (void *)(long)ctx->data_meta;
+	data = (void *)(long)ctx->data;
+	if (data_meta + sizeof(meta) > data)
+		return;
+	__builtin_memcpy(data_meta, &meta, sizeof(meta));
+}
+
+#endif /* __XSK_FEATURES_H */
@@ -0,0 +1,115 @@
+// Code generated by bpf2go; DO NOT EDIT.
+//go:build mips || mips64 || ppc64 || s390x
+
+package xsk
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+
+	"github.com/cilium/ebpf"
+)
+
+// loadXdp_dispatcher returns the embedded CollectionSpec for xdp_dispatcher.
+func loadXdp_dispatcher() (*ebpf.CollectionSpec, error) {
+	reader := bytes.NewReader(_Xdp_dispatcherBytes)
+	spec, err := ebpf.LoadCollectionSpecFromReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("can't load xdp_dispatcher: %w", err)
+	}
+
+	return spec, err
+}
+
+// loadXdp_dispatcherObjects loads xdp_dispatcher and converts it into a struct.
+//
+// The following types are suitable as obj argument:
+//
+//	*xdp_dispatcherObjects
+//	*xdp_dispatcherPrograms
+//	*xdp_dispatcherMaps
+//
+// See ebpf.CollectionSpec.LoadAndAssign documentation for details.
+func loadXdp_dispatcherObjects(obj interface{}, opts *ebpf.CollectionOptions) error {
+	spec, err := loadXdp_dispatcher()
+	if err != nil {
+		return err
+	}
+
+	return spec.LoadAndAssign(obj, opts)
+}
+
+// xdp_dispatcherSpecs contains maps and programs before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type xdp_dispatcherSpecs struct {
+	xdp_dispatcherProgramSpecs
+	xdp_dispatcherMapSpecs
+}
+
+// xdp_dispatcherSpecs contains programs before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type xdp_dispatcherProgramSpecs struct {
+	XdpDispatcher *ebpf.ProgramSpec `ebpf:"xdp_dispatcher"`
+}
+
+// xdp_dispatcherMapSpecs contains maps before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type xdp_dispatcherMapSpecs struct {
+}
+
+// xdp_dispatcherObjects contains all objects after they have been loaded into the kernel.
+//
+// It can be passed to loadXdp_dispatcherObjects or ebpf.CollectionSpec.LoadAndAssign.
+type xdp_dispatcherObjects struct {
+	xdp_dispatcherPrograms
+	xdp_dispatcherMaps
+}
+
+func (o *xdp_dispatcherObjects) Close() error {
+	return _Xdp_dispatcherClose(
+		&o.xdp_dispatcherPrograms,
+		&o.xdp_dispatcherMaps,
+	)
+}
+
+// xdp_dispatcherMaps contains all maps after they have been loaded into the kernel.
+//
+// It can be passed to loadXdp_dispatcherObjects or ebpf.CollectionSpec.LoadAndAssign.
+type xdp_dispatcherMaps struct {
+}
+
+func (m *xdp_dispatcherMaps) Close() error {
+	return _Xdp_dispatcherClose()
+}
+
+// xdp_dispatcherPrograms contains all programs after they have been loaded into the kernel.
+//
+// It can be passed to loadXdp_dispatcherObjects or ebpf.CollectionSpec.LoadAndAssign.
+type xdp_dispatcherPrograms struct {
+	XdpDispatcher *ebpf.Program `ebpf:"xdp_dispatcher"`
+}
+
+func (p *xdp_dispatcherPrograms) Close() error {
+	return _Xdp_dispatcherClose(
+		p.XdpDispatcher,
+	)
+}
+
+func _Xdp_dispatcherClose(closers ...io.Closer) error {
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Do not access this directly.
+//
+//go:embed xdp_dispatcher_bpfeb.o
+var _Xdp_dispatcherBytes []byte
@@ -1,9 +1,14 @@
 package xsk
 
 import (
-	"net"
+	"errors"
+	"fmt"
+	"log/slog"
 	"unsafe"
 
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
 )
 
@@ -69,7 +74,7 @@ func XskSocketCreateShared(ifname string, queueId uint32, umem *XskUmem, rx *Xsk
 		ctx                      *XskCtx
 		netnsCookie              uint64
 		err                      error
-		iface                    *net.Interface
+		ifLink                   netlink.Link
 		unmap                    bool
 	)
 
@@ -84,7 +89,7 @@ func XskSocketCreateShared(ifname string, queueId uint32, umem *XskUmem, rx *Xsk
 		return nil, err
 	}
 
-	iface, err = net.InterfaceByName(ifname)
+	ifLink, err = xskLinkByName("find interface", ifname, queueId)
 	if err != nil {
 		return nil, err
 	}
@@ -93,7 +98,7 @@ func XskSocketCreateShared(ifname string, queueId uint32, umem *XskUmem, rx *Xsk
 		// 如果引用次数大于 1，说明初始化 umem 时创建的套接字已经被使用了，这里创建一个新的套接字
 		xsk.Fd, err = unix.Socket(unix.AF_XDP, unix.SOCK_RAW, 0)
 		if err != nil {
-			return nil, err
+			return nil, xskError("socket", ifname, queueId, err)
 		}
 	} else {
 		// 如果引用次数为 0，会使用 umem 中已经创建了的套接字 fd
@@ -112,7 +117,7 @@ func XskSocketCreateShared(ifname string, queueId uint32, umem *XskUmem, rx *Xsk
 	}
 	// 获取ctx，一个ctx对应一个 netns_cookie、ifindex、queue_id 的组合，每一种这样的组合都需要一对 fill 和 comp ring
 	// 如果获取到了，则 ctx 引用 +1
-	ctx = xskGetCtx(umem, netnsCookie, iface.Index, queueId)
+	ctx = xskGetCtx(umem, netnsCookie, ifLink.Attrs().Index, queueId)
 	if ctx == nil {
 		// 获取失败，并且 fill 和 comp 都为 NULL，无法存放后续创建的 fill 和 comp
 		if fill == nil || comp == nil {
@@ -120,7 +125,7 @@ func XskSocketCreateShared(ifname string, queueId uint32, umem *XskUmem, rx *Xsk
 			goto outSocket
 		}
 		// 创建 ctx
-		ctx, err = xskCreateCtx(xsk, umem, netnsCookie, iface.Index, iface.Name, queueId, fill, comp)
+		ctx, err = xskCreateCtx(xsk, umem, netnsCookie, ifLink.Attrs().Index, ifname, queueId, fill, comp)
 		if err != nil {
 			goto outSocket
 		}
@@ -131,6 +136,7 @@ func XskSocketCreateShared(ifname string, queueId uint32, umem *XskUmem, rx *Xsk
 		// 设置 rx ring 大小
 		err = unix.SetsockoptInt(xsk.Fd, unix.SOL_XDP, unix.XDP_RX_RING, int(xsk.Config.RxSize))
 		if err != nil {
+			err = xskError("rx ring", ifname, queueId, err)
 			goto outPutCtx
 		}
 		if xsk.Fd == umem.Fd {
@@ -142,6 +148,7 @@ func XskSocketCreateShared(ifname string, queueId uint32, umem *XskUmem, rx *Xsk
 		// 设置 tx ring 大小
 		err = unix.SetsockoptInt(xsk.Fd, unix.SOL_XDP, unix.XDP_TX_RING, int(xsk.Config.TxSize))
 		if err != nil {
+			err = xskError("tx ring", ifname, queueId, err)
 			goto outPutCtx
 		}
 		// 如果是使用 umem 中的，则 umem->tx_ring_setup_done = true
@@ -152,6 +159,7 @@ func XskSocketCreateShared(ifname string, queueId uint32, umem *XskUmem, rx *Xsk
 	// 获取偏移量，用户后面用户态维护的 rx ring 和 tx ring 的映射
 	off, err = xskGetMmapOffsets(xsk.Fd)
 	if err != nil {
+		err = xskError("mmap offsets", ifname, queueId, err)
 		goto outPutCtx
 	}
 	// 如果 rx 不为 NULL，则设置 rx，并做映射
@@ -160,6 +168,7 @@ func XskSocketCreateShared(ifname string, queueId uint32, umem *XskUmem, rx *Xsk
 			int(off.Rx.Desc+uint64(xsk.Config.RxSize)*uint64(unsafe.Sizeof(unix.XDPDesc{}))),
 			unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
 		if err != nil {
+			err = xskError("mmap rx ring", ifname, queueId, err)
 			goto outPutCtx
 		}
 		rx.Mask = xsk.Config.RxSize - 1
@@ -178,6 +187,7 @@ func XskSocketCreateShared(ifname string, queueId uint32, umem *XskUmem, rx *Xsk
 			int(off.Tx.Desc+uint64(xsk.Config.TxSize)*uint64(unsafe.Sizeof(unix.XDPDesc{}))),
 			unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
 		if err != nil {
+			err = xskError("mmap tx ring", ifname, queueId, err)
 			goto outMmapRx
 		}
 		tx.Mask = xsk.Config.TxSize - 1
@@ -192,6 +202,12 @@ func XskSocketCreateShared(ifname string, queueId uint32, umem *XskUmem, rx *Xsk
 	}
 	xsk.Tx = tx
 
+	err = xskSetBusyPollOpts(xsk.Fd, &xsk.Config)
+	if err != nil {
+		err = xskError("busy poll", ifname, queueId, err)
+		goto outMmapTx
+	}
+
 	// 准备 bind
 	sxdp.Ifindex = uint32(ctx.Ifindex)
 	sxdp.QueueID = ctx.QueueId
@@ -202,14 +218,24 @@ func XskSocketCreateShared(ifname string, queueId uint32, umem *XskUmem, rx *Xsk
 		sxdp.Flags = xsk.Config.BindFlags
 	}
 	// 这里的 bind 可以理解成绑定之前设置的umem（或共享的）、fill、comp到套接字（最开始设置时fill和comp只是暂存，实际内核在这个阶段创建了pool）
-	err = unix.Bind(xsk.Fd, &sxdp)
+	if umem.Refcount > 1 {
+		// 共享 umem 的套接字沿用第一个套接字的模式
+		err = unix.Bind(xsk.Fd, &sxdp)
+	} else {
+		err = xskBind(xsk.Fd, &sxdp, xsk.Config.BindMode)
+	}
 	if err != nil {
+		err = xskError("bind", ctx.Ifname, ctx.QueueId, err)
 		goto outMmapTx
 	}
+	if umem.Refcount == 1 {
+		umem.needWakeup = sxdp.Flags&unix.XDP_USE_NEED_WAKEUP != 0
+	}
 	// 如果不禁止 prog 加载，则自动载入默认xdp程序
 	if xsk.Config.LibbpfFlags&XSK_LIBBPF_FLAGS__INHIBIT_PROG_LOAD == 0 {
 		err = xskSetupXdpProg(xsk, nil)
 		if err != nil {
+			err = xskError("attach prog", ctx.Ifname, ctx.QueueId, err)
 			goto outMmapTx
 		}
 	}
@@ -229,7 +255,8 @@ outMmapRx:
 	}
 
 outPutCtx:
-	unmap = umem.FillSave != fill
+	// 暂存的 fill 和 comp 还没被用掉时，ctx 中的环就是暂存的环，不能解除映射，否则重试时会使用已解除映射的环
+	unmap = umem.FillSave == nil
 	xskPutCtx(ctx, unmap)
 
 outSocket:
@@ -257,9 +284,17 @@ func xskSetXdpSocketConfig(cfg *XskSocketConfig, usrCfg *XskSocketConfig) error
 		cfg.LibbpfFlags = 0
 		cfg.XdpFlags = 0
 		cfg.BindFlags = 0
+		cfg.BindMode = XSK_BIND_MODE__DEFAULT
+		cfg.BusyPoll = 0
+		cfg.BusyPollBudget = 0
+		cfg.PreferBusyPoll = false
+		cfg.Logger = nil
 		return nil
 	}
-	if usrCfg.LibbpfFlags & ^XSK_LIBBPF_FLAGS__INHIBIT_PROG_LOAD != 0 {
+	if usrCfg.LibbpfFlags & ^(XSK_LIBBPF_FLAGS__INHIBIT_PROG_LOAD|XSK_LIBBPF_FLAGS__XDP_DISPATCHER|xskProgFeatureFlags) != 0 {
+		return unix.EINVAL
+	}
+	if usrCfg.BindMode > XSK_BIND_MODE__COPY_ONLY {
 		return unix.EINVAL
 	}
 	cfg.RxSize = usrCfg.RxSize
@@ -267,10 +302,52 @@ func xskSetXdpSocketConfig(cfg *XskSocketConfig, usrCfg *XskSocketConfig) error
 	cfg.LibbpfFlags = usrCfg.LibbpfFlags
 	cfg.XdpFlags = usrCfg.XdpFlags
 	cfg.BindFlags = usrCfg.BindFlags
+	cfg.BindMode = usrCfg.BindMode
+	cfg.BusyPoll = usrCfg.BusyPoll
+	cfg.BusyPollBudget = usrCfg.BusyPollBudget
+	cfg.PreferBusyPoll = usrCfg.PreferBusyPoll
+	cfg.Logger = usrCfg.Logger
 
 	return nil
 }
 
+// 绑定模式为 XSK_BIND_MODE__ZEROCOPY_REQUIRED（或 XSK_BIND_MODE__DEFAULT 且 BindFlags 中有 XDP_ZEROCOPY）时，驱动不支持零拷贝的错误
+var ErrZeroCopyNotSupported = errors.New("zero-copy mode is not supported by the driver")
+
+// xskBind 按照绑定模式 mode 绑定套接字（见 XSK_BIND_MODE__*）。
+// XSK_BIND_MODE__ZEROCOPY_PREFERRED 在以 XDP_ZEROCOPY 绑定失败且错误为 EOPNOTSUPP 时，改为以 XDP_COPY 重试，
+// 绑定失败时内核会保留 fill ring 和 completion ring，可以直接重新绑定。
+func xskBind(fd int, sxdp *unix.SockaddrXDP, mode uint32) error {
+	flags := sxdp.Flags &^ (unix.XDP_ZEROCOPY | unix.XDP_COPY)
+	switch mode {
+	case XSK_BIND_MODE__DEFAULT:
+		err := unix.Bind(fd, sxdp)
+		if err == unix.EOPNOTSUPP && sxdp.Flags&unix.XDP_ZEROCOPY != 0 {
+			return fmt.Errorf("%w: %w", ErrZeroCopyNotSupported, err)
+		}
+		return err
+	case XSK_BIND_MODE__ZEROCOPY_REQUIRED:
+		sxdp.Flags = flags | unix.XDP_ZEROCOPY
+		err := unix.Bind(fd, sxdp)
+		if err == unix.EOPNOTSUPP {
+			return fmt.Errorf("%w: %w", ErrZeroCopyNotSupported, err)
+		}
+		return err
+	case XSK_BIND_MODE__ZEROCOPY_PREFERRED:
+		sxdp.Flags = flags | unix.XDP_ZEROCOPY
+		err := unix.Bind(fd, sxdp)
+		if err != unix.EOPNOTSUPP {
+			return err
+		}
+		sxdp.Flags = flags | unix.XDP_COPY
+		return unix.Bind(fd, sxdp)
+	case XSK_BIND_MODE__COPY_ONLY:
+		sxdp.Flags = flags | unix.XDP_COPY
+		return unix.Bind(fd, sxdp)
+	}
+	return unix.EINVAL
+}
+
 // xskGetCtx 从提供的 XskUmem 的上下文列表中检索与指定的网络命名空间 cookie、接口索引和队列 ID 匹配的 XskCtx。
 // 如果找到匹配的上下文，则其引用计数递增并返回该上下文。如果没有找到匹配的上下文，则函数返回 nil。
 //
@@ -314,7 +391,7 @@ func xskCreateCtx(xsk *XskSocket, umem *XskUmem, netnsCookie uint64, ifindex int
 	// 检查暂存的 fill 和 comp 是否被用掉了
 	if umem.FillSave == nil {
 		// 被用掉了，创建新的 fill 和 comp
-		err = xskCreateUmemRings(umem, xsk.Fd, fill, comp)
+		err = xskCreateUmemRings(umem, xsk.Fd, ifname, queueId, fill, comp)
 		if err != nil {
 			return nil, err
 		}
@@ -351,12 +428,13 @@ func xskPutCtx(ctx *XskCtx, ummap bool) {
 	var umem = ctx.Umem
 	var off unix.XDPMmapOffsets
 	var err error
-	var fillMapPtr uintptr
+	var fillMapPtr unsafe.Pointer
 	var fillMapLen int
 	var fillMap []byte
-	var compMapPtr uintptr
+	var compMapPtr unsafe.Pointer
 	var compMapLen int
 	var compMap []byte
+	var logger *slog.Logger
 
 	// 还有人在用
 	if ctx.Refcount--; ctx.Refcount != 0 {
@@ -366,21 +444,27 @@ func xskPutCtx(ctx *XskCtx, ummap bool) {
 	if !ummap {
 		goto outFree
 	}
+	logger = xskLogger(umem.Config.Logger).With("ifname", ctx.Ifname, "queue", ctx.QueueId)
 	// 这里应该是用哪个套接字都可以，毕竟布局相同
 	off, err = xskGetMmapOffsets(umem.Fd)
 	if err != nil {
+		logger.Warn("get mmap offsets failed, fill and completion rings not unmapped", "err", err)
 		goto outFree
 	}
 	// 解除 fill 和 comp 的映射
-	fillMapPtr = uintptr(ctx.Fill.Ring) - uintptr(off.Fr.Desc)
+	fillMapPtr = unsafe.Add(ctx.Fill.Ring, -int(off.Fr.Desc))
 	fillMapLen = int(off.Fr.Desc + uint64(umem.Config.FillSize)*uint64(unsafe.Sizeof(uint64(0))))
-	fillMap = unsafe.Slice((*byte)(unsafe.Pointer(fillMapPtr)), fillMapLen)
-	unix.Munmap(fillMap)
+	fillMap = unsafe.Slice((*byte)(fillMapPtr), fillMapLen)
+	if err = unix.Munmap(fillMap); err != nil {
+		logger.Warn("munmap fill ring failed", "err", err)
+	}
 
-	compMapPtr = uintptr(ctx.Comp.Ring) - uintptr(off.Cr.Desc)
+	compMapPtr = unsafe.Add(ctx.Comp.Ring, -int(off.Cr.Desc))
 	compMapLen = int(off.Cr.Desc + uint64(umem.Config.CompSize)*uint64(unsafe.Sizeof(uint64(0))))
-	compMap = unsafe.Slice((*byte)(unsafe.Pointer(compMapPtr)), compMapLen)
-	unix.Munmap(compMap)
+	compMap = unsafe.Slice((*byte)(compMapPtr), compMapLen)
+	if err = unix.Munmap(compMap); err != nil {
+		logger.Warn("munmap completion ring failed", "err", err)
+	}
 outFree:
 	for e := umem.CtxList.Front(); e != nil; e = e.Next() {
 		if ctxValue, ok := e.Value.(*XskCtx); ok && ctxValue == ctx {
@@ -398,7 +482,8 @@ outFree:
 // 该函数执行以下操作:
 //  1. 检查提供的 XskSocket 实例 (xsk) 是否为 nil。如果是，函数立即返回。
 //  2. 检索与 XskSocket 实例关联的上下文 (ctx) 和 umem。
-//  3. 如果上下文中附加了 XDP 程序，则从 XsksMap 中删除 XDP 程序，关闭 XsksMap，并释放 XDP 程序。
+//  3. 如果上下文中附加了 XDP 程序，则从 XsksMap 中删除套接字（XSK_LIBBPF_FLAGS__FANOUT 时释放槽位），
+//     上下文的最后一个套接字关闭 XsksMap 并释放 XDP 程序。同时从通过 XskSocketUpdateXskmap 写入的调用者的 xskmap 中删除套接字。
 //  4. 检索 XskSocket 文件描述符 (Fd) 的内存映射偏移量。如果成功，则在 Rx 和 Tx 环不为 nil 的情况下取消映射它们。
 //  5. 释放与 XskSocket 实例关联的上下文。
 //  6. 减少 umem 的引用计数。
@@ -410,23 +495,41 @@ func XskSocketDelete(xsk *XskSocket) {
 
 	ctx := xsk.Ctx
 	umem := ctx.Umem
+	logger := xskSocketLogger(xsk)
+	xskUnregisterFanoutSocket(xsk)
 	if ctx.XdpProg != nil {
-		ctx.XsksMap.Delete(&ctx.QueueId)
-		ctx.XsksMap.Close()
-		ctx.XsksMap = nil
-		xskReleaseXdpProg(xsk)
+		if xsk.Config.LibbpfFlags&(XSK_LIBBPF_FLAGS__INHIBIT_PROG_LOAD|XSK_LIBBPF_FLAGS__FANOUT) == 0 {
+			if err := ctx.XsksMap.Delete(&ctx.QueueId); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+				logger.Warn("delete socket from xsks_map failed", "err", err)
+			}
+		}
+		// 同一个（网卡、队列）上的其他套接字仍在使用程序
+		if ctx.Refcount == 1 {
+			ctx.XsksMap.Close()
+			ctx.XsksMap = nil
+			xskReleaseXdpProg(xsk)
+		}
 	}
+	xskDeleteXskmapEntries(xsk)
 
 	off, err := xskGetMmapOffsets(xsk.Fd)
 	if err == nil {
 		if xsk.Rx != nil {
-			unix.Munmap(unsafe.Slice((*byte)(unsafe.Pointer(uintptr(xsk.Rx.Ring)-uintptr(off.Rx.Desc))),
+			err = unix.Munmap(unsafe.Slice((*byte)(unsafe.Pointer(uintptr(xsk.Rx.Ring)-uintptr(off.Rx.Desc))),
 				int(off.Rx.Desc+uint64(xsk.Config.RxSize)*uint64(unsafe.Sizeof(unix.XDPDesc{})))))
+			if err != nil {
+				logger.Warn("munmap rx ring failed", "err", err)
+			}
 		}
 		if xsk.Tx != nil {
-			unix.Munmap(unsafe.Slice((*byte)(unsafe.Pointer(uintptr(xsk.Tx.Ring)-uintptr(off.Tx.Desc))),
+			err = unix.Munmap(unsafe.Slice((*byte)(unsafe.Pointer(uintptr(xsk.Tx.Ring)-uintptr(off.Tx.Desc))),
 				int(off.Tx.Desc+uint64(xsk.Config.TxSize)*uint64(unsafe.Sizeof(unix.XDPDesc{})))))
+			if err != nil {
+				logger.Warn("munmap tx ring failed", "err", err)
+			}
 		}
+	} else {
+		logger.Warn("get mmap offsets failed, rx and tx rings not unmapped", "err", err)
 	}
 
 	xskPutCtx(ctx, true)
@@ -434,6 +537,85 @@ func XskSocketDelete(xsk *XskSocket) {
 	umem.Refcount--
 	// 不要关闭与 umem 关联的 fd
 	if xsk.Fd != umem.Fd {
-		unix.Close(xsk.Fd)
+		if err = unix.Close(xsk.Fd); err != nil {
+			logger.Warn("close socket failed", "err", err)
+		}
+	}
+}
+
+// xskGetOptions 通过 XDP_OPTIONS 获取套接字绑定后的选项，目前只有 XDP_OPTIONS_ZEROCOPY。
+func xskGetOptions(fd int) (uint32, error) {
+	var flags uint32
+	optlen := uint32(unsafe.Sizeof(flags))
+	_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, uintptr(fd),
+		unix.SOL_XDP, unix.XDP_OPTIONS,
+		uintptr(unsafe.Pointer(&flags)),
+		uintptr(unsafe.Pointer(&optlen)), 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return flags, nil
+}
+
+// xskIsZeroCopy 通过 XDP_OPTIONS 查询套接字是否以零拷贝模式绑定。
+// 内核不支持 XDP_OPTIONS（< 5.3）时视为复制模式。
+func xskIsZeroCopy(fd int) bool {
+	flags, err := xskGetOptions(fd)
+	if err != nil {
+		return false
 	}
+	return flags&unix.XDP_OPTIONS_ZEROCOPY != 0
+}
+
+// Options 返回内核通过 XDP_OPTIONS 报告的套接字选项，内核版本 < 5.3 时返回错误。
+func (xsk *XskSocket) Options() (uint32, error) {
+	return xskGetOptions(xsk.Fd)
+}
+
+// ZeroCopy 返回内核实际为套接字选择的模式是否为零拷贝。
+// 绑定时没有指定 XDP_ZEROCOPY 或 XDP_COPY 时，驱动不支持零拷贝会静默退回复制模式，可以通过它确认。
+func (xsk *XskSocket) ZeroCopy() bool {
+	return xskIsZeroCopy(xsk.Fd)
+}
+
+// XdpAttachMode 通过 netlink 读取网卡上 XDP 程序实际的挂载模式（link.XDPGenericMode、link.XDPDriverMode 或 link.XDPOffloadMode），
+// 没有挂载程序时返回 0。设置了 XSK_LIBBPF_FLAGS__INHIBIT_PROG_LOAD 时返回网卡上当前程序的挂载模式。
+func (xsk *XskSocket) XdpAttachMode() (link.XDPAttachFlags, error) {
+	var progID uint32
+	if xsk.Ctx.XdpProg != nil {
+		info, err := xsk.Ctx.XdpProg.Info()
+		if err == nil {
+			if id, ok := info.ID(); ok {
+				progID = uint32(id)
+			}
+		}
+	}
+	return xskGetXdpAttachMode(xsk.Ctx.Ifindex, progID)
+}
+
+// xskGetStatistics 通过 XDP_STATISTICS 获取套接字的统计信息。
+// 内核版本 < 5.9 的系统中 getsockopt 只返回 xdp_statistics_v1，此时 Rx_ring_full、
+// Rx_fill_ring_empty_descs 和 Tx_ring_empty_descs 始终为 0。
+func xskGetStatistics(fd int) (unix.XDPStatistics, error) {
+	var stats unix.XDPStatistics
+	var vallen = uint32(unsafe.Sizeof(stats))
+	_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, uintptr(fd),
+		unix.SOL_XDP, unix.XDP_STATISTICS,
+		uintptr(unsafe.Pointer(&stats)),
+		uintptr(unsafe.Pointer(&vallen)), 0)
+	if errno != 0 {
+		return stats, errno
+	}
+	switch vallen {
+	case uint32(unsafe.Sizeof(stats)), uint32(unsafe.Sizeof(xdpStatisticsV1{})):
+		return stats, nil
+	}
+	// 无法识别的长度
+	return stats, unix.EINVAL
+}
+
+// Statistics 返回套接字的统计信息：因 rx ring 已满或 fill ring 为空而丢弃的数据包、无效的描述符等。
+// 内核版本 < 5.9 时只有 Rx_dropped、Rx_invalid_descs 和 Tx_invalid_descs 有效。
+func (xsk *XskSocket) Statistics() (unix.XDPStatistics, error) {
+	return xskGetStatistics(xsk.Fd)
 }
@@ -0,0 +1,149 @@
+// Code generated by bpf2go; DO NOT EDIT.
+//go:build mips || mips64 || ppc64 || s390x
+
+package xsk
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+
+	"github.com/cilium/ebpf"
+)
+
+// loadXsk_feature_xdp_prog returns the embedded CollectionSpec for xsk_feature_xdp_prog.
+func loadXsk_feature_xdp_prog() (*ebpf.CollectionSpec, error) {
+	reader := bytes.NewReader(_Xsk_feature_xdp_progBytes)
+	spec, err := ebpf.LoadCollectionSpecFromReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("can't load xsk_feature_xdp_prog: %w", err)
+	}
+
+	return spec, err
+}
+
+// loadXsk_feature_xdp_progObjects loads xsk_feature_xdp_prog and converts it into a struct.
+//
+// The following types are suitable as obj argument:
+//
+//	*xsk_feature_xdp_progObjects
+//	*xsk_feature_xdp_progPrograms
+//	*xsk_feature_xdp_progMaps
+//
+// See ebpf.CollectionSpec.LoadAndAssign documentation for details.
+func loadXsk_feature_xdp_progObjects(obj interface{}, opts *ebpf.CollectionOptions) error {
+	spec, err := loadXsk_feature_xdp_prog()
+	if err != nil {
+		return err
+	}
+
+	return spec.LoadAndAssign(obj, opts)
+}
+
+// xsk_feature_xdp_progSpecs contains maps and programs before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type xsk_feature_xdp_progSpecs struct {
+	xsk_feature_xdp_progProgramSpecs
+	xsk_feature_xdp_progMapSpecs
+}
+
+// xsk_feature_xdp_progSpecs contains programs before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type xsk_feature_xdp_progProgramSpecs struct {
+	XskDefProg *ebpf.ProgramSpec `ebpf:"xsk_def_prog"`
+}
+
+// xsk_feature_xdp_progMapSpecs contains maps before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type xsk_feature_xdp_progMapSpecs struct {
+	XskFanSteer  *ebpf.MapSpec `ebpf:"xsk_fan_steer"`
+	XskFanout    *ebpf.MapSpec `ebpf:"xsk_fanout"`
+	XskFiltDst   *ebpf.MapSpec `ebpf:"xsk_filt_dst"`
+	XskFiltEth   *ebpf.MapSpec `ebpf:"xsk_filt_eth"`
+	XskFiltPort  *ebpf.MapSpec `ebpf:"xsk_filt_port"`
+	XskFiltProto *ebpf.MapSpec `ebpf:"xsk_filt_proto"`
+	XskFiltSrc   *ebpf.MapSpec `ebpf:"xsk_filt_src"`
+	XskFilter    *ebpf.MapSpec `ebpf:"xsk_filter"`
+	XskSample    *ebpf.MapSpec `ebpf:"xsk_sample"`
+	XskSampleSt  *ebpf.MapSpec `ebpf:"xsk_sample_st"`
+	XsksMap      *ebpf.MapSpec `ebpf:"xsks_map"`
+}
+
+// xsk_feature_xdp_progObjects contains all objects after they have been loaded into the kernel.
+//
+// It can be passed to loadXsk_feature_xdp_progObjects or ebpf.CollectionSpec.LoadAndAssign.
+type xsk_feature_xdp_progObjects struct {
+	xsk_feature_xdp_progPrograms
+	xsk_feature_xdp_progMaps
+}
+
+func (o *xsk_feature_xdp_progObjects) Close() error {
+	return _Xsk_feature_xdp_progClose(
+		&o.xsk_feature_xdp_progPrograms,
+		&o.xsk_feature_xdp_progMaps,
+	)
+}
+
+// xsk_feature_xdp_progMaps contains all maps after they have been loaded into the kernel.
+//
+// It can be passed to loadXsk_feature_xdp_progObjects or ebpf.CollectionSpec.LoadAndAssign.
+type xsk_feature_xdp_progMaps struct {
+	XskFanSteer  *ebpf.Map `ebpf:"xsk_fan_steer"`
+	XskFanout    *ebpf.Map `ebpf:"xsk_fanout"`
+	XskFiltDst   *ebpf.Map `ebpf:"xsk_filt_dst"`
+	XskFiltEth   *ebpf.Map `ebpf:"xsk_filt_eth"`
+	XskFiltPort  *ebpf.Map `ebpf:"xsk_filt_port"`
+	XskFiltProto *ebpf.Map `ebpf:"xsk_filt_proto"`
+	XskFiltSrc   *ebpf.Map `ebpf:"xsk_filt_src"`
+	XskFilter    *ebpf.Map `ebpf:"xsk_filter"`
+	XskSample    *ebpf.Map `ebpf:"xsk_sample"`
+	XskSampleSt  *ebpf.Map `ebpf:"xsk_sample_st"`
+	XsksMap      *ebpf.Map `ebpf:"xsks_map"`
+}
+
+func (m *xsk_feature_xdp_progMaps) Close() error {
+	return _Xsk_feature_xdp_progClose(
+		m.XskFanSteer,
+		m.XskFanout,
+		m.XskFiltDst,
+		m.XskFiltEth,
+		m.XskFiltPort,
+		m.XskFiltProto,
+		m.XskFiltSrc,
+		m.XskFilter,
+		m.XskSample,
+		m.XskSampleSt,
+		m.XsksMap,
+	)
+}
+
+// xsk_feature_xdp_progPrograms contains all programs after they have been loaded into the kernel.
+//
+// It can be passed to loadXsk_feature_xdp_progObjects or ebpf.CollectionSpec.LoadAndAssign.
+type xsk_feature_xdp_progPrograms struct {
+	XskDefProg *ebpf.Program `ebpf:"xsk_def_prog"`
+}
+
+func (p *xsk_feature_xdp_progPrograms) Close() error {
+	return _Xsk_feature_xdp_progClose(
+		p.XskDefProg,
+	)
+}
+
+func _Xsk_feature_xdp_progClose(closers ...io.Closer) error {
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Do not access this directly.
+//
+//go:embed xsk_feature_xdp_prog_bpfeb.o
+var _Xsk_feature_xdp_progBytes []byte
@@ -178,3 +178,22 @@ func TestXskProgRel(t *testing.T) {
 	time.Sleep(100000 * time.Second)
 
 }
+
+func TestXskGetStatistics(t *testing.T) {
+	// 未绑定的套接字也可以查询统计信息，所有计数均为 0
+	fd, err := unix.Socket(unix.AF_XDP, unix.SOCK_RAW, 0)
+	if err != nil {
+		t.Fatalf("socket failed: %v", err)
+	}
+	defer unix.Close(fd)
+	stats, err := xskGetStatistics(fd)
+	if err != nil {
+		t.Fatalf("xskGetStatistics failed: %v", err)
+	}
+	if stats != (unix.XDPStatistics{}) {
+		t.Errorf("Expected empty statistics, got %+v", stats)
+	}
+	if unsafe.Sizeof(xdpStatisticsV1{}) != 24 {
+		t.Errorf("Unexpected xdp_statistics_v1 size %d", unsafe.Sizeof(xdpStatisticsV1{}))
+	}
+}
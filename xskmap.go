@@ -0,0 +1,167 @@
+package xsk
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"golang.org/x/sys/unix"
+)
+
+// xskmapEntry 记录套接字写入调用者 xskmap 的位置，删除套接字时据此移除。
+type xskmapEntry struct {
+	xsksMap *ebpf.Map
+	key     uint32
+}
+
+// XskXdpProg 是调用者提供并挂载到网卡上的 XDP 程序（相当于 libxdp 的 xsk_setup_xdp_prog）。
+// 程序自行决定哪些数据包通过 bpf_redirect_map 重定向到 XsksMap 中的套接字，其余数据包可以交给内核协议栈。
+// 使用时在套接字的 LibbpfFlags 中设置 XSK_LIBBPF_FLAGS__INHIBIT_PROG_LOAD，再通过 XskSocketUpdateXskmap 注册套接字。
+type XskXdpProg struct {
+	Prog    *ebpf.Program
+	XsksMap *ebpf.Map
+	link    link.Link
+}
+
+// XskSetupXdpProg 把调用者已经载入的 prog 挂载到 ifname 上，并在 prog 使用的 map 中查找名为 mapName 的 BPF_MAP_TYPE_XSKMAP。
+// mapName 为空时使用 prog 的第一个 XSKMAP；内核会把 map 名称截断为 15 个字节。
+// xdpFlags 的含义与 XskSocketConfig.XdpFlags 相同，为 XDP_MODE_AUTO 时先尝试驱动模式。
+// 返回的 XskXdpProg 持有 prog 和 map 的副本，调用者可以关闭自己的 prog。
+func XskSetupXdpProg(ifname string, prog *ebpf.Program, mapName string, xdpFlags link.XDPAttachFlags) (*XskXdpProg, error) {
+	xsksMap, err := xskLookupMap(prog, func(mapInfo *ebpf.MapInfo) bool {
+		return mapInfo.Type == ebpf.XSKMap && (mapName == "" || mapInfo.Name == xskKernelObjName(mapName))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if xsksMap == nil {
+		return nil, fmt.Errorf("XDP 程序中没有名为 %q 的 XSKMAP: %w", mapName, unix.ENOENT)
+	}
+	xdpProg, err := xskAttachUserXdpProg(ifname, prog, xsksMap, xdpFlags)
+	if err != nil {
+		xsksMap.Close()
+		return nil, err
+	}
+	return xdpProg, nil
+}
+
+// XskSetupXdpProgSpec 从 spec 中载入名为 progName 的程序并挂载到 ifname 上，mapName 为 spec 中 BPF_MAP_TYPE_XSKMAP 的名称。
+// spec 中的其他程序和 map 在返回前关闭，仍被 progName 引用的 map 由程序持有。
+func XskSetupXdpProgSpec(ifname string, spec *ebpf.CollectionSpec, progName string, mapName string, xdpFlags link.XDPAttachFlags) (*XskXdpProg, error) {
+	mapSpec, ok := spec.Maps[mapName]
+	if !ok || mapSpec.Type != ebpf.XSKMap {
+		return nil, fmt.Errorf("CollectionSpec 中没有名为 %q 的 XSKMAP: %w", mapName, unix.ENOENT)
+	}
+	if _, ok := spec.Programs[progName]; !ok {
+		return nil, fmt.Errorf("CollectionSpec 中没有名为 %q 的程序: %w", progName, unix.ENOENT)
+	}
+	coll, err := ebpf.NewCollection(spec)
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	xsksMap, err := coll.Maps[mapName].Clone()
+	if err != nil {
+		return nil, err
+	}
+	xdpProg, err := xskAttachUserXdpProg(ifname, coll.Programs[progName], xsksMap, xdpFlags)
+	if err != nil {
+		xsksMap.Close()
+		return nil, err
+	}
+	return xdpProg, nil
+}
+
+// xskAttachUserXdpProg 挂载调用者的程序，成功时返回的 XskXdpProg 接管 xsksMap。
+func xskAttachUserXdpProg(ifname string, prog *ebpf.Program, xsksMap *ebpf.Map, xdpFlags link.XDPAttachFlags) (*XskXdpProg, error) {
+	ifLink, err := xskLinkByName("find interface", ifname, 0)
+	if err != nil {
+		return nil, err
+	}
+	xdpProg := &XskXdpProg{XsksMap: xsksMap}
+	xdpProg.Prog, xdpProg.link, err = xskAttachXdpProg(ifLink.Attrs().Index, xdpFlags,
+		func(link.XDPAttachFlags) (*ebpf.Program, error) {
+			return prog.Clone()
+		})
+	if err != nil {
+		return nil, xskError("attach prog", ifname, 0, err)
+	}
+	return xdpProg, nil
+}
+
+// AttachMode 返回程序实际的挂载模式（link.XDPGenericMode、link.XDPDriverMode 或 link.XDPOffloadMode）。
+func (xdpProg *XskXdpProg) AttachMode() (link.XDPAttachFlags, error) {
+	info, err := xdpProg.link.Info()
+	if err != nil {
+		return 0, err
+	}
+	xdpInfo := info.XDP()
+	if xdpInfo == nil {
+		return 0, unix.EINVAL
+	}
+	bpfInfo, err := xdpProg.Prog.Info()
+	if err != nil {
+		return 0, err
+	}
+	progID, _ := bpfInfo.ID()
+	return xskGetXdpAttachMode(int(xdpInfo.Ifindex), uint32(progID))
+}
+
+// Close 从网卡上卸载程序并关闭程序和 map。
+func (xdpProg *XskXdpProg) Close() error {
+	var err error
+	if xdpProg.link != nil {
+		err = xdpProg.link.Close()
+		xdpProg.link = nil
+	}
+	if xdpProg.Prog != nil {
+		xdpProg.Prog.Close()
+		xdpProg.Prog = nil
+	}
+	if xdpProg.XsksMap != nil {
+		xdpProg.XsksMap.Close()
+		xdpProg.XsksMap = nil
+	}
+	return err
+}
+
+// XskSocketUpdateXskmap 以套接字的队列号为键把套接字写入调用者的 xsksMap（相当于 libxdp 的 xsk_socket__update_xskmap）。
+func XskSocketUpdateXskmap(xsk *XskSocket, xsksMap *ebpf.Map) error {
+	return XskSocketUpdateXskmapKey(xsk, xsksMap, xsk.Ctx.QueueId)
+}
+
+// XskSocketUpdateXskmapKey 以 key 为键把套接字写入调用者的 xsksMap，XDP 程序以 key 调用 bpf_redirect_map 即可把数据包交给该套接字。
+// 同一个套接字可以写入多个 map 或多个键，XskSocketDelete 时这些项会被删除。
+func XskSocketUpdateXskmapKey(xsk *XskSocket, xsksMap *ebpf.Map, key uint32) error {
+	m, err := xsksMap.Clone()
+	if err != nil {
+		return err
+	}
+	err = m.Update(key, uint32(xsk.Fd), ebpf.UpdateAny)
+	if err != nil {
+		m.Close()
+		return xskError("update xskmap", xsk.Ctx.Ifname, xsk.Ctx.QueueId, fmt.Errorf("key %d: %w", key, err))
+	}
+	xsk.xskmaps = append(xsk.xskmaps, xskmapEntry{xsksMap: m, key: key})
+	return nil
+}
+
+// xskDeleteXskmapEntries 从调用者的 xskmap 中删除套接字。
+func xskDeleteXskmapEntries(xsk *XskSocket) {
+	for _, entry := range xsk.xskmaps {
+		if err := entry.xsksMap.Delete(&entry.key); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			xskSocketLogger(xsk).Warn("delete socket from xskmap failed", "key", entry.key, "err", err)
+		}
+		entry.xsksMap.Close()
+	}
+	xsk.xskmaps = nil
+}
+
+// xskKernelObjName 返回内核中保存的对象名称，内核只保留前 BPF_OBJ_NAME_LEN-1 个字节。
+func xskKernelObjName(name string) string {
+	if len(name) >= unix.BPF_OBJ_NAME_LEN {
+		return name[:unix.BPF_OBJ_NAME_LEN-1]
+	}
+	return name
+}
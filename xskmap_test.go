@@ -0,0 +1,94 @@
+package xsk
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf/link"
+	"golang.org/x/sys/unix"
+)
+
+func TestXskSetupXdpProg(t *testing.T) {
+	spec, err := xskLoadDefXdpProg()
+	if err != nil {
+		t.Fatalf("Failed to load spec: %v", err)
+	}
+	if _, err := XskSetupXdpProgSpec("lo", spec, "xsk_def_prog", "no_such_map", XDP_MODE_AUTO); !errors.Is(err, unix.ENOENT) {
+		t.Errorf("Expected ENOENT for a missing map, got %v", err)
+	}
+	// lo 不支持驱动模式，XDP_MODE_AUTO 退回通用模式
+	xdpProg, err := XskSetupXdpProgSpec("lo", spec, "xsk_def_prog", "xsks_map", XDP_MODE_AUTO)
+	if err != nil {
+		t.Fatalf("XskSetupXdpProgSpec failed: %v", err)
+	}
+	defer xdpProg.Close()
+	mode, err := xdpProg.AttachMode()
+	if err != nil || mode != link.XDPGenericMode {
+		t.Errorf("Expected generic mode, got %v (%v)", mode, err)
+	}
+	// 通过程序查找同一个 map
+	other, err := XskSetupXdpProg("lo", xdpProg.Prog, "xsks_map", link.XDPDriverMode)
+	if err == nil {
+		other.Close()
+		t.Errorf("Expected driver mode attach on lo to fail")
+	}
+
+	config := DefaultComplexXskConfig()
+	config.SocketConfig.LibbpfFlags = XSK_LIBBPF_FLAGS__INHIBIT_PROG_LOAD
+	var xsk *ComplexXsk
+	var descs []XDPDesc
+	err = retryOnBusy(func() (err error) {
+		xsk, descs, err = NewComplexXsk("lo", 0, config)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("NewComplexXsk failed: %v", err)
+	}
+	defer xsk.Close()
+	if err := xsk.UpdateXskmap(xdpProg.XsksMap, 0); err != nil {
+		t.Fatalf("UpdateXskmap failed: %v", err)
+	}
+	if err := xsk.UpdateXskmap(xdpProg.XsksMap, 5); err != nil {
+		t.Fatalf("UpdateXskmap failed: %v", err)
+	}
+	xsk.FillBatch(descs[:1024])
+
+	// 发往 lo 的数据包在接收时经过 XDP 程序，被重定向到 0 号队列的套接字
+	iface, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(fd)
+	pkt := make([]byte, 64)
+	copy(pkt[12:], []byte{0x88, 0xb5})
+	for i := 0; i < 8; i++ {
+		if err := unix.Sendto(fd, pkt, 0, &unix.SockaddrLinklayer{Ifindex: iface.Index}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recv := make([]XDPDesc, 64)
+	n := 0
+	for i := 0; i < 100 && n < 8; i++ {
+		n += xsk.RecvBatch(recv[n:])
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n != 8 {
+		t.Errorf("Expected 8 packets, got %d", n)
+	}
+
+	// 关闭套接字后 map 中的项被删除（xskmap 删除不存在的键时同样成功，也不支持从用户态查找，这里只检查记录）
+	socket := xsk.xsk
+	if len(socket.xskmaps) != 2 {
+		t.Fatalf("Expected 2 xskmap entries, got %d", len(socket.xskmaps))
+	}
+	xsk.Close()
+	if socket.xskmaps != nil {
+		t.Errorf("Expected xskmap entries to be removed on Close")
+	}
+}